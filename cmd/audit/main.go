@@ -0,0 +1,13 @@
+package main
+
+import (
+	"cloud/internal/app/audit"
+	"os"
+)
+
+func main() {
+	a := audit.New()
+	if err := a.Run(); err != nil {
+		os.Exit(1)
+	}
+}
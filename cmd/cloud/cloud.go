@@ -1,8 +1,26 @@
 package main
 
-import "cloud/internal/app/cloud"
+import (
+	"cloud/internal/app/cloud"
+	"os"
+)
 
 func main() {
+	if len(os.Args) > 1 {
+		subcommands := map[string]func([]string) error{
+			"config":  cloud.RunConfig,
+			"fsck":    cloud.RunFsck,
+			"backup":  cloud.RunBackup,
+			"restore": cloud.RunRestore,
+		}
+		if run, ok := subcommands[os.Args[1]]; ok {
+			if err := run(os.Args[2:]); err != nil {
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	c := cloud.New()
 	c.Run()
 }
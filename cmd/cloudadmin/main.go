@@ -0,0 +1,13 @@
+package main
+
+import (
+	"cloud/internal/app/cloudadmin"
+	"os"
+)
+
+func main() {
+	a := cloudadmin.New()
+	if err := a.Run(); err != nil {
+		os.Exit(1)
+	}
+}
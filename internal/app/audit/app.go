@@ -0,0 +1,136 @@
+package audit
+
+import (
+	"cloud/internal/audit"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// keyEnv is variable with the audit log key, the same as the server reads.
+const keyEnv = "CLOUD_AUDIT_KEY"
+
+// App queries and verifies audit log.
+type App struct {
+	log     *slog.Logger
+	path    string
+	verify  bool
+	asJSON  bool
+	filter  audit.Filter
+	flagErr error
+}
+
+func New() *App {
+	path := flag.String("path", "", "audit log file, rotated files next to it are read too")
+	verify := flag.Bool("verify", false, "verify hash chain instead of printing events, the key is read from "+keyEnv)
+	asJSON := flag.Bool("json", false, "print events as json lines")
+	principal := flag.String("principal", "", "filter by principal")
+	tenant := flag.String("tenant", "", "filter by tenant")
+	op := flag.String("op", "", "filter by operation, e.g. Upload")
+	target := flag.String("target", "", "filter by image or folder name substring")
+	result := flag.String("result", "", "filter by result code, e.g. OK or PermissionDenied")
+	since := flag.String("since", "", "events at or after time: 2006-01-02 or RFC3339")
+	until := flag.String("until", "", "events before time: 2006-01-02 or RFC3339")
+
+	flag.Parse()
+
+	a := &App{
+		log: slog.New(
+			slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo}),
+		),
+		path:   *path,
+		verify: *verify,
+		asJSON: *asJSON,
+		filter: audit.Filter{
+			Principal: *principal,
+			Tenant:    *tenant,
+			Operation: *op,
+			Target:    *target,
+			Result:    *result,
+		},
+	}
+	a.filter.Since, a.flagErr = parseTime(*since)
+	if a.flagErr == nil {
+		a.filter.Until, a.flagErr = parseTime(*until)
+	}
+	return a
+}
+
+func (a *App) Run() error {
+	err := a.run()
+	if err != nil {
+		a.log.Error(err.Error())
+	}
+	return err
+}
+
+func (a *App) run() error {
+	if a.flagErr != nil {
+		return a.flagErr
+	}
+	if a.path == "" {
+		return errors.New("-path is required")
+	}
+
+	files, err := audit.Files(a.path)
+	if err != nil {
+		return err
+	}
+
+	if a.verify {
+		res, err := audit.Verify(a.path, os.Getenv(keyEnv))
+		if err != nil {
+			return err
+		}
+		if res.Torn {
+			a.log.Warn("torn record at the end of the log skipped, it is cut off when the server starts")
+		}
+		a.log.Info("audit log is intact", slog.Int("files", len(files)), slog.Int("events", res.Events))
+		return nil
+	}
+
+	if a.asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		return audit.Read(files, func(e audit.Event) error {
+			if !a.filter.Match(e) {
+				return nil
+			}
+			return enc.Encode(e)
+		})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Seq\tTime\tPrincipal\tTenant\tPeer\tOperation\tTarget\tResult\tIn\tOut\tMs")
+	err = audit.Read(files, func(e audit.Event) error {
+		if !a.filter.Match(e) {
+			return nil
+		}
+		_, err := fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\n", e.Seq,
+			e.Time.Local().Format("02.01.2006 15:04:05"), e.Principal, e.Tenant, e.Peer, e.Operation,
+			e.Target, e.Result, e.BytesIn, e.BytesOut, e.DurationMs)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, want 2006-01-02 or RFC3339", s)
+	}
+	return t, nil
+}
@@ -2,8 +2,10 @@ package client
 
 import (
 	"cloud/internal/app/client/client"
+	"cloud/internal/app/client/params"
+	"cloud/internal/config"
+	"cloud/internal/logging"
 	"log/slog"
-	"os"
 )
 
 type App struct {
@@ -12,8 +14,9 @@ type App struct {
 }
 
 func New() *App {
-	log := setupLogger()
-	clientApp, err := client.New(log)
+	p := params.New()
+	log := setupLogger(p)
+	clientApp, err := client.New(log, p)
 	if err != nil {
 		panic(err)
 	}
@@ -27,8 +30,11 @@ func (a *App) Run() {
 	a.clientApp.Run()
 }
 
-func setupLogger() *slog.Logger {
-	return slog.New(
-		slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
-	)
+func setupLogger(p *params.Params) *slog.Logger {
+	// stdout needs no closing
+	log, _, err := logging.New(config.LogConfig{Level: p.LogLevel, Format: p.LogFormat})
+	if err != nil {
+		panic(err)
+	}
+	return log
 }
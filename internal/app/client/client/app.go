@@ -2,45 +2,140 @@ package client
 
 import (
 	"cloud/internal/app/client/params"
+	"cloud/internal/certs"
 	"cloud/internal/clients/cloud/cloudgrpc"
+	"cloud/internal/config"
+	"cloud/internal/logging"
+	"cloud/internal/tracing"
+	"context"
+	"crypto/tls"
 	"fmt"
+	"go.opentelemetry.io/otel"
 	"log/slog"
+	"time"
 )
 
 const (
 	uploadMethod   = "upload"
 	downloadMethod = "download"
 	listMethod     = "list"
+	similarMethod  = "similar"
+	setMetaMethod  = "set-meta"
+	addTagsMethod  = "add-tags"
+	rmTagsMethod   = "remove-tags"
+	mkdirMethod    = "mkdir"
+	lsMethod       = "ls"
+	mvMethod       = "mv"
+	searchMethod   = "search"
+	deleteMethod   = "delete"
+	shareMethod    = "share"
 )
 
+// tracingShutdownTimeout is how long spans of the call may be exported before exit.
+const tracingShutdownTimeout = 5 * time.Second
+
+var tracer = otel.Tracer("cloud/internal/app/client")
+
 type App struct {
-	params *params.Params
-	api    *cloudgrpc.Client
+	params      *params.Params
+	api         *cloudgrpc.Client
+	log         *slog.Logger
+	stopTracing func(ctx context.Context) error
 }
 
-func New(log *slog.Logger) (*App, error) {
-	p := params.New()
+func New(log *slog.Logger, p *params.Params) (*App, error) {
+	var tlsCfg *tls.Config
+	if p.TLS {
+		var err error
+		tlsCfg, err = certs.ClientConfig(p.CAFile, p.CertFile, p.KeyFile, p.ServerName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	api, err := cloudgrpc.New(p.Addr, p.Token, p.Tenant, tlsCfg, log)
+	if err != nil {
+		return nil, err
+	}
 
-	api, err := cloudgrpc.New(p.Addr, log)
+	stopTracing, err := tracing.Setup(context.Background(), "cloud-client", config.TracingConfig{
+		Enabled:     p.Trace != "",
+		Exporter:    p.Trace,
+		Endpoint:    p.TraceEndpoint,
+		SampleRatio: 1,
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	return &App{
-		params: p,
-		api:    api,
+		params:      p,
+		api:         api,
+		log:         log,
+		stopTracing: stopTracing,
 	}, nil
 }
 
 func (c *App) Run() error {
+	// server logs of the call are found by the request id
+	ctx := logging.WithRequestID(context.Background(), logging.NewRequestID())
+	ctx, span := tracer.Start(ctx, "client."+c.params.Method)
+	err := c.run(ctx)
+	span.End()
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancel()
+	if stopErr := c.stopTracing(stopCtx); stopErr != nil {
+		c.log.Error(stopErr.Error())
+	}
+
+	return err
+}
+
+func (c *App) run(ctx context.Context) error {
 	var err = fmt.Errorf("unknown method")
 	switch c.params.Method {
 	case uploadMethod:
-		err = c.api.Upload(c.params.Src)
+		err = c.api.Upload(ctx, c.params.Src, cloudgrpc.UploadOptions{
+			RejectSimilar:       c.params.RejectSimilar,
+			SimilarityThreshold: c.threshold(),
+			Tags:                c.params.Tags,
+			Metadata:            c.params.Metadata,
+			Folder:              c.params.Folder,
+		})
 	case downloadMethod:
-		err = c.api.Download(c.params.Dest, c.params.Filename)
+		err = c.api.Download(ctx, c.params.Dest, c.params.Filename)
 	case listMethod:
-		err = c.api.List()
+		err = c.api.List(ctx, c.params.Filter)
+	case similarMethod:
+		err = c.api.FindSimilar(ctx, c.params.Filename, c.threshold())
+	case setMetaMethod:
+		err = c.api.SetMetadata(ctx, c.params.Filename, c.params.Metadata, c.params.Replace)
+	case addTagsMethod:
+		err = c.api.AddTags(ctx, c.params.Filename, c.params.Tags)
+	case rmTagsMethod:
+		err = c.api.RemoveTags(ctx, c.params.Filename, c.params.Tags)
+	case mkdirMethod:
+		err = c.api.CreateFolder(ctx, c.params.Folder)
+	case lsMethod:
+		err = c.api.ListFolder(ctx, c.params.Folder, c.params.Recursive)
+	case mvMethod:
+		err = c.api.MoveToFolder(ctx, c.params.Filename, c.params.Folder)
+	case searchMethod:
+		err = c.api.Search(ctx, c.params.Query, uint32(c.params.Limit))
+	case deleteMethod:
+		err = c.api.Delete(ctx, c.params.Filename)
+	case shareMethod:
+		err = c.api.CreateShareLink(ctx, c.params.Filename, c.params.TTL, uint32(c.params.MaxDownloads))
 	}
 	return err
 }
+
+// threshold returns similarity threshold to send, nil lets the server use its default.
+func (c *App) threshold() *uint32 {
+	if c.params.Threshold < 0 {
+		return nil
+	}
+	t := uint32(c.params.Threshold)
+	return &t
+}
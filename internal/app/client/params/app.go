@@ -1,29 +1,140 @@
 package params
 
-import "flag"
+import (
+	"flag"
+	"strings"
+	"time"
+)
 
 type Params struct {
 	Addr     string
+	Token    string
+	Tenant   string
 	Src      string
 	Dest     string
 	Filename string
 	Method   string
+
+	RejectSimilar bool
+	// Threshold is max perceptual hash distance, negative - server default.
+	Threshold int
+
+	Tags     []string
+	Metadata map[string]string
+	Replace  bool
+	Filter   string
+
+	Folder    string
+	Recursive bool
+
+	Query string
+	Limit uint
+
+	TTL          time.Duration
+	MaxDownloads uint
+
+	Trace         string
+	TraceEndpoint string
+
+	LogFormat string
+	LogLevel  string
+
+	TLS        bool
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	ServerName string
 }
 
 func New() *Params {
 	addr := flag.String("a", "localhost:44044", "the address to connect to")
+	token := flag.String("token", "", "bearer token: api key or jwt")
+	tenant := flag.String("tenant", "", "tenant namespace, server resolves it from the principal by default")
+	useTLS := flag.Bool("tls", false, "connect with tls, enabled by any of -ca, -cert flags")
+	caFile := flag.String("ca", "", "CA bundle to verify server certificate, system roots by default")
+	certFile := flag.String("cert", "", "client certificate for mutual tls")
+	keyFile := flag.String("key", "", "client certificate key for mutual tls")
+	serverName := flag.String("server-name", "", "override server name for certificate verification")
 	src := flag.String("src", "./images/client/test.png", "the source image path")
 	dest := flag.String("dest", "./images/client/", "path for download images")
 	filename := flag.String("fname", "", "download image with this filename from server")
 	method := flag.String("m", "list", "grpc api method")
+	rejectSimilar := flag.Bool("reject-similar", false, "reject upload if a visually similar image exists")
+	threshold := flag.Int("threshold", -1, "max perceptual hash distance of similar images, 0 - exact matches only, -1 - server default")
+	tags := flag.String("tags", "", "comma separated image tags")
+	metadata := flag.String("meta", "", "comma separated image metadata: key=value,key2=value2")
+	replace := flag.Bool("replace", false, "replace all image metadata instead of merging")
+	folder := flag.String("folder", "", "folder path on server, e.g. albums/2024")
+	recursive := flag.Bool("r", false, "list folder recursively")
+	query := flag.String("q", "", "search query, e.g. \"cat tag:red ext:png size>1MB created>2024-01-01\"")
+	limit := flag.Uint("limit", 0, "max number of search results, 0 - no limit")
+	ttl := flag.Duration("ttl", 0, "share link lifetime, e.g. 1h, 0 - server default")
+	maxDownloads := flag.Uint("max-downloads", 0, "share link download limit, 0 - no limit")
+	trace := flag.String("trace", "", "export spans of the call: otlp or stdout, empty - disabled")
+	traceEndpoint := flag.String("trace-endpoint", "", "OTLP collector URL, e.g. http://localhost:4318")
+	logFormat := flag.String("log-format", "text", "log format: text or json")
+	logLevel := flag.String("log-level", "debug", "log level: debug, info, warn or error")
+	filter := flag.String("filter", "", "list filter: tag:name, !tag:name, key=value, key!=value, key, !key")
 
 	flag.Parse()
 
 	return &Params{
 		Addr:     *addr,
+		Token:    *token,
+		Tenant:   *tenant,
 		Src:      *src,
 		Dest:     *dest,
 		Filename: *filename,
 		Method:   *method,
+
+		RejectSimilar: *rejectSimilar,
+		Threshold:     *threshold,
+
+		Tags:     splitList(*tags),
+		Metadata: parseMetadata(*metadata),
+		Replace:  *replace,
+		Filter:   *filter,
+
+		Folder:    *folder,
+		Recursive: *recursive,
+
+		Query: *query,
+		Limit: *limit,
+
+		TTL:          *ttl,
+		MaxDownloads: *maxDownloads,
+
+		Trace:         *trace,
+		TraceEndpoint: *traceEndpoint,
+
+		LogFormat: *logFormat,
+		LogLevel:  *logLevel,
+
+		TLS:        *useTLS || *caFile != "" || *certFile != "",
+		CAFile:     *caFile,
+		CertFile:   *certFile,
+		KeyFile:    *keyFile,
+		ServerName: *serverName,
+	}
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func parseMetadata(s string) map[string]string {
+	pairs := splitList(s)
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	res := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		k, v, _ := strings.Cut(pair, "=")
+		res[k] = v
 	}
+	return res
 }
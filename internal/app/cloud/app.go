@@ -3,27 +3,43 @@ package cloud
 import (
 	"cloud/internal/app/cloud/cloud"
 	"cloud/internal/config"
+	"cloud/internal/logging"
+	"context"
+	"io"
 	"log/slog"
 	"os"
 	"os/signal"
+	"regexp"
+	"slices"
+	"strings"
 	"syscall"
+	"time"
 )
 
-const envDev = "dev"
+// httpShutdownTimeout is how long active share downloads may finish on shutdown.
+const httpShutdownTimeout = 10 * time.Second
+
+// tracingShutdownTimeout is how long pending spans may be exported on shutdown.
+const tracingShutdownTimeout = 5 * time.Second
+
+// policyChange matches diff lines of cloud policies, which are reloaded without restart.
+var policyChange = regexp.MustCompile(`^(cloud|tenants\[\d+\]\.cloud)[.\[:]`)
 
 type App struct {
-	cfg   *config.Config
-	log   *slog.Logger
-	cloud *cloud.App
+	cfg       *config.Config
+	log       *slog.Logger
+	logCloser io.Closer
+	cloud     *cloud.App
 }
 
 func New() *App {
 	cfg := config.MustLoad()
-	log := setupLogger(cfg.Env)
+	log, logCloser := setupLogger(cfg.Env, cfg.Log)
 	return &App{
-		cfg:   cfg,
-		log:   log,
-		cloud: cloud.New(log, cfg),
+		cfg:       cfg,
+		log:       log,
+		logCloser: logCloser,
+		cloud:     cloud.New(log, cfg),
 	}
 }
 
@@ -31,22 +47,126 @@ func (a *App) Run() {
 	a.log.Info("start", slog.Any("config", a.cfg))
 
 	go a.cloud.GRPCServer.MustRun()
+	if a.cloud.HTTPServer != nil {
+		go a.cloud.HTTPServer.MustRun()
+	}
+	if a.cloud.MetricsServer != nil {
+		go a.cloud.MetricsServer.MustRun()
+	}
+	if a.cloud.AdminServer != nil {
+		go a.cloud.AdminServer.MustRun()
+	}
+
+	scrubCtx, stopScrub := context.WithCancel(context.Background())
+	if a.cloud.Scrubber != nil {
+		go a.cloud.Scrubber.Run(scrubCtx)
+	}
+
+	// SIGHUP and changes of the file reload cloud policy
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+
+	ctx, stopWatch := context.WithCancel(context.Background())
+	if a.cfg.ReloadInterval > 0 {
+		go config.Watch(ctx, a.log, a.cfg.Path, a.cfg.ReloadInterval, func() {
+			select {
+			case signals <- syscall.SIGHUP:
+			default:
+			}
+		})
+	}
+
+	sign := <-signals
+	for sign == syscall.SIGHUP {
+		a.reload()
+		sign = <-signals
+	}
+	stopWatch()
+	stopScrub()
 
 	// gracefull shutdown
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
-	sign := <-stop
 
+	a.cloud.GRPCServer.Drain()
+	if a.cloud.HTTPServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+		a.cloud.HTTPServer.Stop(ctx)
+		cancel()
+	}
+	// admin service stays available while transfers drain
 	a.cloud.GRPCServer.Stop()
+	if a.cloud.AdminServer != nil {
+		a.cloud.AdminServer.Stop()
+	}
+	if a.cloud.MetricsServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+		a.cloud.MetricsServer.Stop(ctx)
+		cancel()
+	}
+	if a.cloud.Audit != nil {
+		if err := a.cloud.Audit.Close(); err != nil {
+			a.log.Error(err.Error())
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	if err := a.cloud.StopTracing(ctx); err != nil {
+		a.log.Error(err.Error())
+	}
+	cancel()
 	a.log.Info("app stopped by signal " + sign.String())
+	_ = a.logCloser.Close()
 }
 
-func setupLogger(env string) *slog.Logger {
-	level := slog.LevelInfo
-	if env == envDev {
-		level = slog.LevelDebug
+// reload applies cloud policies from the config file, changes of other values need restart.
+// Invalid config is ignored.
+func (a *App) reload() {
+	const fn = "app.reload"
+	log := a.log.With(slog.String("fn", fn))
+
+	cfg, err := config.Load(a.cfg.Path)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+
+	var restart []string
+	for _, change := range config.Diff(a.cfg, cfg) {
+		if !policyChange.MatchString(change) {
+			restart = append(restart, change)
+		}
+	}
+	if len(restart) > 0 {
+		log.Warn("config changes need restart", slog.String("changes", strings.Join(restart, "; ")))
+	}
+
+	if err := a.cloud.UpdatePolicies(cfg); err != nil {
+		log.Error(err.Error())
+	}
+
+	// the running config has new policies only, it's copied as admin service may be reading it
+	running := *a.cfg
+	running.Cloud = cfg.Cloud
+	running.Tenants = slices.Clone(a.cfg.Tenants)
+	for i := range running.Tenants {
+		for _, t := range cfg.Tenants {
+			if t.Name == running.Tenants[i].Name {
+				running.Tenants[i].Cloud = t.Cloud
+			}
+		}
+	}
+	a.cfg = &running
+	if a.cloud.AdminServer != nil {
+		a.cloud.AdminServer.SetConfig(a.cfg)
+	}
+}
+
+// setupLogger creates logger of the config, the level defaults to debug in dev env.
+func setupLogger(env string, cfg config.LogConfig) (*slog.Logger, io.Closer) {
+	if cfg.Level == "" && env == config.EnvDev {
+		cfg.Level = "debug"
+	}
+	log, closer, err := logging.New(cfg)
+	if err != nil {
+		panic(err)
 	}
-	return slog.New(
-		slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level}),
-	)
+	return log, closer
 }
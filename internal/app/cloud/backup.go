@@ -0,0 +1,203 @@
+package cloud
+
+import (
+	"cloud/internal/backup"
+	"cloud/internal/config"
+	"cloud/internal/storage/drive"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+var ErrStoreNotEmpty = errors.New("store isn't empty, restore needs an empty store")
+
+// RunBackup runs backup subcommand, which writes snapshot of completed images and their metadata.
+// It may run while the server serves uploads: images still uploading aren't included.
+func RunBackup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("CONFIG_PATH"), "path to config file, CONFIG_PATH by default")
+	output := fs.String("o", "", "archive to write, .tar or .tar.zst; its manifest is written to <archive>.manifest.json")
+	base := fs.String("base", "", "manifest of the previous snapshot, makes the snapshot incremental")
+	tenant := fs.String("tenant", "", "tenant to back up, empty - all tenants")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	err := runBackup(*configPath, *output, *base, *tenant)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	return err
+}
+
+func runBackup(configPath string, output string, basePath string, tenant string) error {
+	if configPath == "" {
+		return errors.New("config path is not set, use -config flag or CONFIG_PATH")
+	}
+	if output == "" {
+		return errors.New("archive is not set, use -o flag")
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+
+	var base *backup.Manifest
+	if basePath != "" {
+		base, err = backup.ReadManifest(basePath)
+		if err != nil {
+			return err
+		}
+	}
+
+	var sources []backup.Source
+	for _, t := range cfg.AllTenants() {
+		if tenant != "" && t.Name != tenant {
+			continue
+		}
+		storage, err := drive.New(t.Storage)
+		if err != nil {
+			return fmt.Errorf("tenant %s: %w", t.Name, err)
+		}
+		sources = append(sources, backup.Source{Tenant: t.Name, Storage: storage})
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("unknown tenant %q", tenant)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	manifest, err := backup.Backup(ctx, output, sources, base)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s snapshot %s written to %s\n", manifest.Kind, manifest.ID, output)
+	if err := printManifest(manifest); err != nil {
+		return err
+	}
+	for _, s := range manifest.Skipped {
+		fmt.Fprintf(os.Stderr, "skipped corrupt image %s of tenant %s: %s\n", s.Path, s.Tenant, s.Detail)
+	}
+	// the archive is usable, corrupt images are reported like fsck does
+	if len(manifest.Skipped) > 0 {
+		return fmt.Errorf("%w: %d images weren't backed up, run cloud fsck", ErrCorruptImages, len(manifest.Skipped))
+	}
+	return nil
+}
+
+// RunRestore runs restore subcommand, which rebuilds empty stores from a full snapshot and its
+// incremental snapshots. The server must be stopped.
+func RunRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("CONFIG_PATH"), "path to config file, CONFIG_PATH by default")
+	tenant := fs.String("tenant", "", "tenant to restore, empty - all tenants of the snapshot")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: cloud restore [flags] full.tar.zst [incremental.tar.zst ...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	err := runRestore(*configPath, *tenant, fs.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	return err
+}
+
+func runRestore(configPath string, tenant string, archives []string) error {
+	if configPath == "" {
+		return errors.New("config path is not set, use -config flag or CONFIG_PATH")
+	}
+	if len(archives) == 0 {
+		return errors.New("archives are not set, pass the full snapshot and its incremental snapshots in order")
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	targets := make(map[string]backup.Restorer)
+	for _, t := range cfg.AllTenants() {
+		if tenant != "" && t.Name != tenant {
+			continue
+		}
+		storage, err := drive.New(t.Storage)
+		if err != nil {
+			return fmt.Errorf("tenant %s: %w", t.Name, err)
+		}
+		images, err := storage.List(ctx)
+		if err != nil {
+			return fmt.Errorf("tenant %s: %w", t.Name, err)
+		}
+		if len(images) > 0 {
+			return fmt.Errorf("tenant %s: %w", t.Name, ErrStoreNotEmpty)
+		}
+		targets[t.Name] = storage
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("unknown tenant %q", tenant)
+	}
+
+	manifest, err := backup.Restore(ctx, archives, targets)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("restored snapshot %s\n", manifest.ID)
+	if err := printManifest(manifest); err != nil {
+		return err
+	}
+
+	// tenants of the snapshot missing in config aren't restored
+	var skipped []string
+	for name := range manifest.Tenants {
+		if _, ok := targets[name]; !ok && tenant == "" {
+			skipped = append(skipped, name)
+		}
+	}
+	if len(skipped) > 0 {
+		slices.Sort(skipped)
+		return fmt.Errorf("tenants %s of the snapshot aren't configured, they weren't restored",
+			strings.Join(skipped, ", "))
+	}
+	return nil
+}
+
+func printManifest(m *backup.Manifest) error {
+	tenants := make([]string, 0, len(m.Tenants))
+	for name := range m.Tenants {
+		tenants = append(tenants, name)
+	}
+	sort.Strings(tenants)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Tenant\tImages\tBytes\tIn this snapshot")
+	for _, name := range tenants {
+		var size int64
+		var own int
+		for _, e := range m.Tenants[name] {
+			size += e.Size
+			if e.Snapshot == m.ID {
+				own++
+			}
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", name, len(m.Tenants[name]), size, own)
+	}
+	return w.Flush()
+}
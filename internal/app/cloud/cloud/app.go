@@ -2,33 +2,167 @@ package cloud
 
 import (
 	grpcapp "cloud/internal/app/cloud/grpc"
+	httpapp "cloud/internal/app/cloud/http"
+	"cloud/internal/audit"
 	"cloud/internal/config"
+	grpcaudit "cloud/internal/grpc/audit"
+	grpccloud "cloud/internal/grpc/cloud"
+	grpchealth "cloud/internal/grpc/health"
+	"cloud/internal/grpc/tenancy"
+	sharehttp "cloud/internal/http/share"
+	"cloud/internal/metrics"
+	"cloud/internal/scrub"
 	"cloud/internal/services/cloud"
+	"cloud/internal/share"
 	"cloud/internal/storage/drive"
+	"cloud/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"net/http"
 )
 
 type App struct {
 	GRPCServer *grpcapp.App
+	// HTTPServer serves share links, nil if they are disabled.
+	HTTPServer *httpapp.App
+	// MetricsServer serves Prometheus metrics, nil if they are disabled.
+	MetricsServer *httpapp.App
+	// AdminServer serves CloudAdmin service, nil if it is disabled.
+	AdminServer *grpcapp.Admin
+	// Scrubber checks stored images in background, nil if it is disabled.
+	Scrubber *scrub.Scrubber
+	// Audit is audit log, nil if it is disabled.
+	Audit *audit.Log
+	// StopTracing flushes pending spans.
+	StopTracing func(ctx context.Context) error
+}
+
+// UpdatePolicies applies cloud policies of cfg to running tenants.
+func (a *App) UpdatePolicies(cfg *config.Config) error {
+	var errs []error
+	for name, policy := range cfg.Policies() {
+		errs = append(errs, a.GRPCServer.UpdatePolicy(name, policy))
+	}
+	return errors.Join(errs...)
 }
 
 func New(
 	log *slog.Logger,
 	cfg *config.Config,
 ) *App {
-	// data layer
-	storage, err := drive.New(cfg.Storage)
+	stopTracing, err := tracing.Setup(context.Background(), "cloud", cfg.Tracing)
 	if err != nil {
 		panic(err)
 	}
 
-	// service layer
-	cloudService := cloud.New(log, storage)
+	tenantsCfg := cfg.AllTenants()
+
+	tenants := make([]grpccloud.Tenant, 0, len(tenantsCfg))
+	shared := make(map[string]sharehttp.Cloud, len(tenantsCfg))
+	checkers := make(map[string]grpchealth.Checker, len(tenantsCfg))
+	principals := make(map[string][]string, len(tenantsCfg))
+	targets := make([]scrub.Target, 0, len(tenantsCfg))
+	for _, t := range tenantsCfg {
+		if _, ok := principals[t.Name]; ok || t.Name == "" {
+			panic(fmt.Sprintf("invalid or duplicate tenant name %q", t.Name))
+		}
+		principals[t.Name] = t.Principals
+
+		policy := cfg.Cloud
+		if t.Cloud != nil {
+			policy = *t.Cloud
+		}
+
+		// data layer
+		storage, err := drive.New(t.Storage)
+		if err != nil {
+			panic(fmt.Sprintf("tenant %s: %s", t.Name, err))
+		}
+
+		// service layer
+		cloudService := cloud.New(log.With(slog.String("tenant", t.Name)), storage)
+
+		shared[t.Name] = cloudService
+		checkers[t.Name] = cloudService
+		tenants = append(tenants, grpccloud.Tenant{
+			Name:  t.Name,
+			Cloud: cloudService,
+			Cfg:   policy,
+		})
+		targets = append(targets, scrub.Target{
+			Tenant:  t.Name,
+			Checker: cloudService,
+			Opts: drive.FsckOptions{
+				Exts:   policy.StoredExts(),
+				TmpAge: cfg.Scrub.TmpAge,
+				Repair: cfg.Scrub.Repair,
+			},
+		})
+	}
+
+	var (
+		auditWriter grpcaudit.Writer
+		auditLog    *audit.Log
+	)
+	if cfg.Audit.Enabled {
+		var err error
+		auditLog, err = audit.Open(log, cfg.Audit.Path, string(cfg.Audit.Key), cfg.Audit.MaxSize)
+		if err != nil {
+			panic(err)
+		}
+		auditWriter = auditLog
+	}
 
 	// transport layer
-	grpcApp := grpcapp.New(log, cloudService, cfg.GRPC.Port, cfg.Cloud)
+	var (
+		links   grpccloud.ShareLinks
+		httpApp *httpapp.App
+	)
+	if cfg.Share.Enabled {
+		shareLinks, err := share.New(string(cfg.Share.Secret), cfg.Share.BaseURL, cfg.Share.DefaultTTL, cfg.Share.MaxTTL,
+			cfg.Share.StatePath)
+		if err != nil {
+			panic(err)
+		}
+		links = shareLinks
+
+		mux := http.NewServeMux()
+		sharehttp.Register(mux, sharehttp.New(log, shareLinks, shared, auditWriter))
+		httpApp = httpapp.New(log, mux, cfg.Share.Port)
+	}
+
+	reg := metrics.NewRegistry()
+	var metricsApp *httpapp.App
+	if cfg.Metrics.Enabled {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", reg.Handler())
+		metricsApp = httpapp.New(log, mux, cfg.Metrics.Port)
+	}
+
+	resolver := tenancy.NewResolver(config.DefaultTenant, principals)
+	healthService := grpchealth.New(log, checkers, cfg.Health.CheckInterval, cfg.Health.MinFreeSpace)
+	grpcApp := grpcapp.New(log, tenants, resolver, links, auditWriter, reg, healthService, cfg.GRPC, cfg.Log, cfg.Auth,
+		cfg.Health)
+
+	var adminApp *grpcapp.Admin
+	if cfg.Admin.Enabled {
+		adminApp = grpcapp.NewAdmin(log, grpcApp, cfg)
+	}
+
+	var scrubber *scrub.Scrubber
+	if cfg.Scrub.Enabled {
+		scrubber = scrub.New(log, targets, cfg.Scrub.Interval, cfg.Scrub.ReportPath)
+	}
 
 	return &App{
-		GRPCServer: grpcApp,
+		GRPCServer:    grpcApp,
+		HTTPServer:    httpApp,
+		MetricsServer: metricsApp,
+		AdminServer:   adminApp,
+		Scrubber:      scrubber,
+		Audit:         auditLog,
+		StopTracing:   stopTracing,
 	}
 }
@@ -0,0 +1,38 @@
+package cloud
+
+import (
+	"cloud/internal/config"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// RunConfig runs config subcommand, "check" validates config without starting the server.
+func RunConfig(args []string) error {
+	if len(args) == 0 || args[0] != "check" {
+		err := errors.New("usage: cloud config check [-config path]")
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+
+	fs := flag.NewFlagSet("config check", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("CONFIG_PATH"), "path to config file, CONFIG_PATH by default")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *configPath == "" {
+		err := errors.New("config path is not set, use -config flag or CONFIG_PATH")
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+
+	// environment overrides are applied, so the effective config is checked
+	if _, err := config.Load(*configPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+
+	fmt.Printf("%s is valid\n", *configPath)
+	return nil
+}
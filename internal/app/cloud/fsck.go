@@ -0,0 +1,137 @@
+package cloud
+
+import (
+	"cloud/internal/config"
+	"cloud/internal/scrub"
+	"cloud/internal/storage/drive"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+)
+
+var ErrCorruptImages = errors.New("corrupt images found")
+
+// RunFsck runs fsck subcommand, which verifies stored images of tenants and writes the report.
+// Repair changes files the server holds in memory, so it's run with the server stopped,
+// the running server repairs with scrub.repair instead.
+func RunFsck(args []string) error {
+	fs := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("CONFIG_PATH"), "path to config file, CONFIG_PATH by default")
+	repair := fs.Bool("repair", false, "quarantine corrupt images and invalid metadata, remove orphaned tmp and metadata files, save missing checksums")
+	tenant := fs.String("tenant", "", "tenant to check, empty - all tenants")
+	tmpAge := fs.Duration("tmp-age", time.Hour, "tmp files older than this are orphaned, 0 - all tmp files")
+	reportPath := fs.String("report", "", "file to write JSON report to")
+	asJSON := fs.Bool("json", false, "print JSON report instead of table")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *configPath == "" {
+		err := errors.New("config path is not set, use -config flag or CONFIG_PATH")
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+
+	err := runFsck(*configPath, *tenant, *reportPath, *asJSON, drive.FsckOptions{
+		TmpAge: *tmpAge,
+		Repair: *repair,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	return err
+}
+
+func runFsck(configPath string, tenant string, reportPath string, asJSON bool, opts drive.FsckOptions) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+
+	policies := cfg.Policies()
+	var targets []scrub.Target
+	for _, t := range cfg.AllTenants() {
+		if tenant != "" && t.Name != tenant {
+			continue
+		}
+		storage, err := drive.New(t.Storage)
+		if err != nil {
+			return fmt.Errorf("tenant %s: %w", t.Name, err)
+		}
+
+		tenantOpts := opts
+		tenantOpts.Exts = policies[t.Name].StoredExts()
+		targets = append(targets, scrub.Target{Tenant: t.Name, Checker: storage, Opts: tenantOpts})
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("unknown tenant %q", tenant)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	reports, checkErr := scrub.Check(ctx, targets)
+
+	if reportPath != "" {
+		if err := scrub.WriteReport(reportPath, reports); err != nil {
+			return err
+		}
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			return err
+		}
+	} else if err := printFsck(reports); err != nil {
+		return err
+	}
+
+	if checkErr != nil {
+		return checkErr
+	}
+	// corrupt images left in place are an error, quarantined ones are not served anymore
+	for _, r := range reports {
+		for _, p := range r.Problems {
+			if p.Corrupt() && p.Action == "" {
+				return ErrCorruptImages
+			}
+		}
+	}
+	return nil
+}
+
+func printFsck(reports []scrub.Report) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Tenant\tImages\tBytes\tProblems\tCorrupt\tRepaired\tDuration")
+	for _, r := range reports {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%s\n", r.Tenant, r.Images, r.Bytes, len(r.Problems),
+			r.Corrupt(), r.Repaired(), time.Duration(r.DurationMs)*time.Millisecond)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	var problems int
+	for _, r := range reports {
+		problems += len(r.Problems)
+	}
+	if problems == 0 {
+		return nil
+	}
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Tenant\tKind\tPath\tDetail\tAction")
+	for _, r := range reports {
+		for _, p := range r.Problems {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Tenant, p.Kind, p.Path, p.Detail, p.Action)
+		}
+	}
+	return w.Flush()
+}
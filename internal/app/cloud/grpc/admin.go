@@ -0,0 +1,108 @@
+package grpcapp
+
+import (
+	"cloud/internal/config"
+	"cloud/internal/grpc/accesslog"
+	"cloud/internal/grpc/audit"
+	"cloud/internal/grpc/auth"
+	"cloud/internal/grpc/cloud"
+	"context"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+	"log/slog"
+	"net"
+)
+
+// Admin serves CloudAdmin service of the cloud server on a separate port.
+type Admin struct {
+	log        *slog.Logger
+	gRPCServer *grpc.Server
+	admin      *cloud.Admin
+	port       int
+	stopWatch  context.CancelFunc
+}
+
+// NewAdmin creates admin server of the app. Only admin api keys are accepted, with tls enabled
+// the server certificate of the cloud service is used without client certificates.
+func NewAdmin(log *slog.Logger, app *App, cfg *config.Config) *Admin {
+	var opts []grpc.ServerOption
+
+	ctx, stopWatch := context.WithCancel(context.Background())
+	if cfg.GRPC.TLS.Enabled {
+		tlsCfg := cfg.GRPC.TLS
+		tlsCfg.ClientCAFile = ""
+		tlsCfg.RequireClientCert = false
+
+		tlsOpt, err := tlsOption(ctx, log, tlsCfg)
+		if err != nil {
+			panic(err)
+		}
+		opts = append(opts, tlsOpt)
+	}
+
+	keys := make([]auth.APIKey, 0, len(cfg.Admin.APIKeys))
+	for _, k := range cfg.Admin.APIKeys {
+		keys = append(keys, auth.APIKey{Name: k.Name, Key: string(k.Key)})
+	}
+	authenticator := auth.New(true, keys, "", "")
+
+	opts = append(opts, grpc.ChainUnaryInterceptor(accesslog.UnaryServerInterceptor(log, cfg.Log.AccessLog)))
+	// audit runs before authentication, so calls with rejected admin keys are recorded
+	if app.audit != nil {
+		opts = append(opts, grpc.ChainUnaryInterceptor(audit.UnaryServerInterceptor(app.audit, log)))
+	}
+	opts = append(opts, grpc.ChainUnaryInterceptor(auth.UnaryServerInterceptor(authenticator, log)))
+
+	admin := cloud.NewAdmin(log, app.cloud, cfg)
+
+	gRPCServer := grpc.NewServer(opts...)
+	cloud.RegisterAdmin(gRPCServer, admin)
+	reflection.Register(gRPCServer)
+
+	return &Admin{
+		log:        log,
+		gRPCServer: gRPCServer,
+		admin:      admin,
+		port:       cfg.Admin.Port,
+		stopWatch:  stopWatch,
+	}
+}
+
+// MustRun runs admin server and panics if any error occurs.
+func (a *Admin) MustRun() {
+	if err := a.Run(); err != nil {
+		panic(err)
+	}
+}
+
+// Run runs admin server.
+func (a *Admin) Run() error {
+	const fn = "grpcapp.Admin.Run"
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", a.port))
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	a.log.Info("admin grpc server started", slog.String("addr", lis.Addr().String()))
+
+	if err := a.gRPCServer.Serve(lis); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return nil
+}
+
+// SetConfig replaces config dumped by the admin service.
+func (a *Admin) SetConfig(cfg *config.Config) {
+	a.admin.SetConfig(cfg)
+}
+
+// Stop stops admin server, admin calls are short so they aren't waited for.
+func (a *Admin) Stop() {
+	const fn = "grpcapp.Admin.Stop"
+
+	a.log.Info("stopping admin gRPC server", slog.String("fn", fn), slog.Int("port", a.port))
+	a.gRPCServer.Stop()
+	a.stopWatch()
+}
@@ -1,39 +1,175 @@
 package grpcapp
 
 import (
+	"cloud/internal/certs"
 	"cloud/internal/config"
+	"cloud/internal/grpc/accesslog"
+	"cloud/internal/grpc/audit"
+	"cloud/internal/grpc/auth"
 	"cloud/internal/grpc/cloud"
+	"cloud/internal/grpc/health"
+	grpcmetrics "cloud/internal/grpc/metrics"
+	"cloud/internal/grpc/rbac"
+	"cloud/internal/grpc/tenancy"
+	"cloud/internal/metrics"
+	"context"
 	"fmt"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/reflection"
 	"log/slog"
 	"net"
+	"time"
 )
 
+// cutOffWait is how long stop waits for cut off transfers to clean up.
+const cutOffWait = 5 * time.Second
+
 type App struct {
 	log        *slog.Logger
 	gRPCServer *grpc.Server
-	port       int
+	cloud      *cloud.Server
+	health     *health.Health
+	// audit is audit log, nil if it is disabled, admin server records its calls too.
+	audit         audit.Writer
+	shutdownDelay time.Duration
+	drainTimeout  time.Duration
+	port          int
+	stopWatch     context.CancelFunc
 }
 
 func New(
 	log *slog.Logger,
-	cloudService cloud.Cloud,
-	port int,
-	cfg config.CloudConfig,
+	tenants []cloud.Tenant,
+	resolver *tenancy.Resolver,
+	links cloud.ShareLinks,
+	auditLog audit.Writer,
+	reg *metrics.Registry,
+	healthService *health.Health,
+	grpcCfg config.GRPCConfig,
+	logCfg config.LogConfig,
+	authCfg config.AuthConfig,
+	healthCfg config.HealthConfig,
 ) *App {
-	gRPCServer := grpc.NewServer()
-	gRPCCloudServer := cloud.New(cloudService, log, cfg)
+	var opts []grpc.ServerOption
+
+	ctx, stopWatch := context.WithCancel(context.Background())
+	if grpcCfg.TLS.Enabled {
+		tlsOpt, err := tlsOption(ctx, log, grpcCfg.TLS)
+		if err != nil {
+			panic(err)
+		}
+		opts = append(opts, tlsOpt)
+	}
+
+	// spans of calls continue traces propagated by clients
+	opts = append(opts, grpc.StatsHandler(otelgrpc.NewServerHandler()))
+
+	// metrics run first to observe calls rejected by any interceptor
+	rpcMetrics := grpcmetrics.New(reg)
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(grpcmetrics.UnaryServerInterceptor(rpcMetrics)),
+		grpc.ChainStreamInterceptor(grpcmetrics.StreamServerInterceptor(rpcMetrics)),
+	)
+
+	// request id is put into context before any interceptor logs, rejected calls are logged too
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(accesslog.UnaryServerInterceptor(log, logCfg.AccessLog)),
+		grpc.ChainStreamInterceptor(accesslog.StreamServerInterceptor(log, logCfg.AccessLog)),
+	)
+
+	// audit runs before authentication, so calls rejected by authentication, tenancy or rbac are recorded
+	if auditLog != nil {
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(audit.UnaryServerInterceptor(auditLog, log)),
+			grpc.ChainStreamInterceptor(audit.StreamServerInterceptor(auditLog, log)),
+		)
+	}
+
+	// with mutual tls the client certificate identity is the principal even if auth is disabled
+	mTLS := grpcCfg.TLS.Enabled && grpcCfg.TLS.ClientCAFile != ""
+	if authCfg.Enabled || mTLS {
+		keys := make([]auth.APIKey, 0, len(authCfg.APIKeys))
+		for _, k := range authCfg.APIKeys {
+			keys = append(keys, auth.APIKey{Name: k.Name, Key: string(k.Key)})
+		}
+		authenticator := auth.New(authCfg.Enabled, keys, string(authCfg.JWTSecret), authCfg.JWTIssuer)
+
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(auth.UnaryServerInterceptor(authenticator, log)),
+			grpc.ChainStreamInterceptor(auth.StreamServerInterceptor(authenticator, log)),
+		)
+	}
+
+	// tenant is resolved from the principal, so it runs after authentication
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(tenancy.UnaryServerInterceptor(resolver)),
+		grpc.ChainStreamInterceptor(tenancy.StreamServerInterceptor(resolver)),
+	)
+
+	if authCfg.PolicyPath != "" {
+		policy, err := rbac.LoadPolicy(authCfg.PolicyPath)
+		if err != nil {
+			panic(err)
+		}
+		authorizer := rbac.New(policy, log)
+
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(rbac.UnaryServerInterceptor(authorizer)),
+			grpc.ChainStreamInterceptor(rbac.StreamServerInterceptor(authorizer)),
+		)
+	}
+
+	gRPCCloudServer := cloud.New(log, tenants, links, reg)
+
+	// per client request rate of the tenant
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(gRPCCloudServer.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(gRPCCloudServer.StreamServerInterceptor()),
+	)
+
+	gRPCServer := grpc.NewServer(opts...)
 
 	cloud.Register(gRPCServer, gRPCCloudServer)
 
+	health.Register(gRPCServer, healthService)
+	go healthService.Run(ctx)
+
 	reflection.Register(gRPCServer)
 
 	return &App{
-		log:        log,
-		gRPCServer: gRPCServer,
-		port:       port,
+		log:           log,
+		gRPCServer:    gRPCServer,
+		cloud:         gRPCCloudServer,
+		health:        healthService,
+		audit:         auditLog,
+		shutdownDelay: healthCfg.ShutdownDelay,
+		drainTimeout:  grpcCfg.DrainTimeout,
+		port:          grpcCfg.Port,
+		stopWatch:     stopWatch,
+	}
+}
+
+// tlsOption creates server credentials and starts watching certificate files.
+func tlsOption(ctx context.Context, log *slog.Logger, cfg config.TLSConfig) (grpc.ServerOption, error) {
+	const fn = "grpcapp.tlsOption"
+
+	reloader, err := certs.NewReloader(log, cfg.CertFile, cfg.KeyFile, cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	tlsCfg, err := certs.ServerConfig(cfg, reloader)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
 	}
+
+	if cfg.ReloadInterval > 0 {
+		go reloader.Watch(ctx, cfg.ReloadInterval)
+	}
+
+	return grpc.Creds(credentials.NewTLS(tlsCfg)), nil
 }
 
 // MustRun runs gRPC server and panics if any error occurs.
@@ -60,11 +196,64 @@ func (a *App) Run() error {
 	return nil
 }
 
-// Stop stops gRPC server.
+// UpdatePolicy swaps cloud policy of the tenant.
+func (a *App) UpdatePolicy(tenant string, cfg config.CloudConfig) error {
+	return a.cloud.UpdatePolicy(tenant, cfg)
+}
+
+// Drain reports NOT_SERVING to health checks and waits shutdown delay, so load balancers
+// stop sending new calls before the server stops.
+func (a *App) Drain() {
+	const fn = "grpcapp.Drain"
+
+	a.health.Shutdown()
+	a.log.Info("health status is NOT_SERVING, draining", slog.String("fn", fn),
+		slog.Duration("delay", a.shutdownDelay))
+	time.Sleep(a.shutdownDelay)
+}
+
+// Stop stops gRPC server gracefully. Uploads and downloads still running after drain timeout are
+// cut off, aborted uploads remove their tmp files.
 func (a *App) Stop() {
 	const fn = "grpcapp.Stop"
+	log := a.log.With(slog.String("fn", fn))
 
-	a.log.With(slog.String("fn", fn)).Info("stopping gRPC server", slog.Int("port", a.port))
+	inFlight, before := a.cloud.Transfers()
+	log.Info("stopping gRPC server", slog.Int("port", a.port), slog.Int("transfers", inFlight),
+		slog.Duration("drain_timeout", a.drainTimeout))
+
+	stopped := make(chan struct{})
+	go func() {
+		a.gRPCServer.GracefulStop()
+		close(stopped)
+	}()
+
+	if a.drainTimeout > 0 {
+		select {
+		case <-stopped:
+		case <-time.After(a.drainTimeout):
+			n := a.cloud.CutOffTransfers()
+			log.Warn("drain timeout exceeded, cutting off transfers", slog.Int("transfers", n))
+
+			// stop closes streams blocked on receive, handlers return afterwards
+			a.gRPCServer.Stop()
+
+			ctx, cancel := context.WithTimeout(context.Background(), cutOffWait)
+			if err := a.cloud.WaitTransfers(ctx); err != nil {
+				log.Warn("transfers didn't return after cut off", slog.Duration("wait", cutOffWait))
+			}
+			cancel()
+		}
+	}
+	<-stopped
+	a.stopWatch()
 
-	a.gRPCServer.GracefulStop()
+	running, after := a.cloud.Transfers()
+	log.Info("gRPC server stopped",
+		slog.Int("in_flight", inFlight),
+		slog.Int("completed", after.Completed-before.Completed),
+		slog.Int("failed", after.Failed-before.Failed),
+		slog.Int("cut_off", after.CutOff-before.CutOff),
+		slog.Int("unfinished", running),
+	)
 }
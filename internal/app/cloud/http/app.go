@@ -0,0 +1,70 @@
+package httpapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// readHeaderTimeout protects from clients holding connections without sending request.
+const readHeaderTimeout = 10 * time.Second
+
+type App struct {
+	log        *slog.Logger
+	httpServer *http.Server
+	port       int
+}
+
+func New(
+	log *slog.Logger,
+	handler http.Handler,
+	port int,
+) *App {
+	return &App{
+		log: log,
+		httpServer: &http.Server{
+			Handler:           handler,
+			ReadHeaderTimeout: readHeaderTimeout,
+		},
+		port: port,
+	}
+}
+
+// MustRun runs HTTP server and panics if any error occurs.
+func (a *App) MustRun() {
+	if err := a.Run(); err != nil {
+		panic(err)
+	}
+}
+
+// Run runs HTTP server.
+func (a *App) Run() error {
+	const fn = "httpapp.Run"
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", a.port))
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	a.log.Info("http server started", slog.String("addr", lis.Addr().String()))
+
+	if err := a.httpServer.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return nil
+}
+
+// Stop stops HTTP server waiting for active requests until ctx is done.
+func (a *App) Stop(ctx context.Context) {
+	const fn = "httpapp.Stop"
+
+	a.log.With(slog.String("fn", fn)).Info("stopping HTTP server", slog.Int("port", a.port))
+
+	if err := a.httpServer.Shutdown(ctx); err != nil {
+		a.log.Error(err.Error(), slog.String("fn", fn))
+	}
+}
@@ -0,0 +1,231 @@
+package cloudadmin
+
+import (
+	"cloud/internal/certs"
+	"cloud/pkg/cloudv1"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"log/slog"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	transfersMethod = "transfers"
+	cancelMethod    = "cancel"
+	readOnlyMethod  = "read-only"
+	writableMethod  = "writable"
+	configMethod    = "config"
+	cleanTmpMethod  = "clean-tmp"
+	reindexMethod   = "reindex"
+	limitsMethod    = "limits"
+)
+
+// callTimeout bounds admin calls, reindex of large stores takes the longest.
+const callTimeout = 5 * time.Minute
+
+// App calls CloudAdmin service of a running server.
+type App struct {
+	log        *slog.Logger
+	addr       string
+	token      string
+	useTLS     bool
+	caFile     string
+	serverName string
+	method     string
+	id         uint64
+	tenant     string
+	olderThan  time.Duration
+}
+
+func New() *App {
+	addr := flag.String("a", "localhost:44045", "admin address of the server")
+	token := flag.String("token", "", "admin api key")
+	useTLS := flag.Bool("tls", false, "connect with tls, enabled by -ca flag")
+	caFile := flag.String("ca", "", "CA bundle to verify server certificate, system roots by default")
+	serverName := flag.String("server-name", "", "override server name for certificate verification")
+	method := flag.String("m", transfersMethod,
+		"admin method: transfers, cancel, read-only, writable, config, clean-tmp, reindex or limits")
+	id := flag.Uint64("id", 0, "transfer id to cancel")
+	tenant := flag.String("tenant", "", "tenant of clean-tmp, reindex and limits, empty - all tenants")
+	olderThan := flag.Duration("older-than", time.Hour, "clean-tmp removes files older than this, must be positive")
+
+	flag.Parse()
+
+	return &App{
+		log: slog.New(
+			slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo}),
+		),
+		addr:       *addr,
+		token:      *token,
+		useTLS:     *useTLS || *caFile != "",
+		caFile:     *caFile,
+		serverName: *serverName,
+		method:     *method,
+		id:         *id,
+		tenant:     *tenant,
+		olderThan:  *olderThan,
+	}
+}
+
+func (a *App) Run() error {
+	err := a.run()
+	if err != nil {
+		a.log.Error(err.Error())
+	}
+	return err
+}
+
+func (a *App) run() error {
+	creds := insecure.NewCredentials()
+	if a.useTLS {
+		tlsCfg, err := certs.ClientConfig(a.caFile, "", "", a.serverName)
+		if err != nil {
+			return err
+		}
+		creds = credentials.NewTLS(tlsCfg)
+	}
+
+	conn, err := grpc.Dial(a.addr,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithPerRPCCredentials(tokenCredentials{token: a.token, secure: a.useTLS}),
+	)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	api := cloudv1.NewCloudAdminClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+
+	switch a.method {
+	case transfersMethod:
+		return a.transfers(ctx, api)
+	case cancelMethod:
+		if a.id == 0 {
+			return errors.New("-id is required")
+		}
+		if _, err := api.CancelTransfer(ctx, &cloudv1.CancelTransferRequest{Id: a.id}); err != nil {
+			return err
+		}
+		a.log.Info("transfer cancelled", slog.Uint64("id", a.id))
+	case readOnlyMethod, writableMethod:
+		state, err := api.SetReadOnly(ctx, &cloudv1.SetReadOnlyRequest{ReadOnly: a.method == readOnlyMethod})
+		if err != nil {
+			return err
+		}
+		a.log.Info("mode set", slog.Bool("read_only", state.GetReadOnly()))
+	case configMethod:
+		resp, err := api.GetConfig(ctx, &cloudv1.GetConfigRequest{})
+		if err != nil {
+			return err
+		}
+		fmt.Print(resp.GetYaml())
+	case cleanTmpMethod:
+		resp, err := api.CleanTmp(ctx, &cloudv1.CleanTmpRequest{
+			Tenant:           a.tenant,
+			OlderThanSeconds: uint32(a.olderThan.Seconds()),
+		})
+		if err != nil {
+			return err
+		}
+		return printCounts("Tenant\tRemoved", resp.GetRemoved())
+	case reindexMethod:
+		resp, err := api.Reindex(ctx, &cloudv1.ReindexRequest{Tenant: a.tenant})
+		if err != nil {
+			return err
+		}
+		return printCounts("Tenant\tImages", resp.GetImages())
+	case limitsMethod:
+		return a.limits(ctx, api)
+	default:
+		return fmt.Errorf("unknown method %q", a.method)
+	}
+	return nil
+}
+
+func (a *App) transfers(ctx context.Context, api cloudv1.CloudAdminClient) error {
+	resp, err := api.ListTransfers(ctx, &cloudv1.ListTransfersRequest{})
+	if err != nil {
+		return err
+	}
+
+	if resp.GetReadOnly() {
+		fmt.Println("server is in read-only mode")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tDirection\tTenant\tClient\tPeer\tName\tProgress\tStarted")
+	for _, t := range resp.GetTransfers() {
+		progress := fmt.Sprintf("%d", t.GetBytes())
+		if t.GetSize() > 0 {
+			progress = fmt.Sprintf("%d/%d (%d%%)", t.GetBytes(), t.GetSize(), t.GetBytes()*100/t.GetSize())
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", t.GetId(), t.GetDirection(), t.GetTenant(),
+			t.GetClient(), t.GetPeer(), t.GetName(), progress, t.GetStartedAt())
+	}
+	return w.Flush()
+}
+
+func (a *App) limits(ctx context.Context, api cloudv1.CloudAdminClient) error {
+	resp, err := api.GetLimits(ctx, &cloudv1.GetLimitsRequest{Tenant: a.tenant})
+	if err != nil {
+		return err
+	}
+
+	for _, t := range resp.GetTenants() {
+		fmt.Printf("tenant %s\n", t.GetTenant())
+		printSlots("upload/download", t.GetUploadDownload())
+		printSlots("list", t.GetList())
+		for _, client := range t.GetClients() {
+			fmt.Printf("  %s: request tokens %.1f, bandwidth tokens %.0f\n", client.GetClient(),
+				client.GetRequestTokens(), client.GetBandwidthTokens())
+		}
+	}
+	return nil
+}
+
+func printSlots(name string, slots *cloudv1.SlotsState) {
+	fmt.Printf("  %s slots: %d/%d, waiting %d\n", name, slots.GetInUse(), slots.GetCapacity(), slots.GetWaiting())
+	for _, client := range slots.GetClients() {
+		fmt.Printf("    %s: held %d, waiting %d\n", client.GetClient(), client.GetHeld(), client.GetWaiting())
+	}
+}
+
+func printCounts(header string, counts map[string]uint32) error {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, header)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s\t%d\n", name, counts[name])
+	}
+	return w.Flush()
+}
+
+// tokenCredentials sends admin api key with every call.
+type tokenCredentials struct {
+	token  string
+	secure bool
+}
+
+func (t tokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return t.secure
+}
@@ -0,0 +1,279 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testKey = "key"
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// writeLog writes n events with rotation after every few of them and returns the log path.
+func writeLog(t *testing.T, n int) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := Open(discard, path, testKey, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for i := 0; i < n; i++ {
+		if err := l.Write(Event{Time: time.Now(), Operation: "Upload", Target: "a.png", Result: "OK"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func readLines(t *testing.T, name string) []string {
+	t.Helper()
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.SplitAfter(string(data), "\n")
+}
+
+func writeLines(t *testing.T, name string, lines []string) {
+	t.Helper()
+
+	if err := os.WriteFile(name, []byte(strings.Join(lines, "")), filePerm); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func appendData(t *testing.T, name string, data string) {
+	t.Helper()
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	const events = 10
+
+	tests := []struct {
+		name string
+		// tamper changes the written log
+		tamper    func(t *testing.T, path string)
+		key       string
+		wantErr   error
+		wantTorn  bool
+		wantCount int
+	}{
+		{name: "intact", wantCount: events},
+		{name: "wrong key", key: "other", wantErr: ErrTampered},
+		{name: "modified event", wantErr: ErrTampered, tamper: func(t *testing.T, path string) {
+			lines := readLines(t, path)
+			lines[0] = strings.Replace(lines[0], `"Upload"`, `"Delete"`, 1)
+			writeLines(t, path, lines)
+		}},
+		{name: "rewritten chain", wantErr: ErrTampered, tamper: func(t *testing.T, path string) {
+			// without the key the rewritten events can only be hashed unkeyed
+			files, err := Files(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var prev string
+			for _, name := range files {
+				var lines []string
+				err := Read([]string{name}, func(e Event) error {
+					e.Principal = "mallory"
+					e.PrevHash = prev
+					hash, err := e.computeHash(nil)
+					if err != nil {
+						return err
+					}
+					e.Hash, prev = hash, hash
+					data, err := json.Marshal(e)
+					lines = append(lines, string(data)+"\n")
+					return err
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				writeLines(t, name, lines)
+			}
+		}},
+		{name: "truncated tail", wantErr: ErrTampered, tamper: func(t *testing.T, path string) {
+			lines := readLines(t, path)
+			writeLines(t, path, lines[:len(lines)-2])
+		}},
+		{name: "removed current file", wantErr: ErrTampered, tamper: func(t *testing.T, path string) {
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{name: "removed oldest file", wantErr: ErrTampered, tamper: func(t *testing.T, path string) {
+			files, err := Files(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Remove(files[0]); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{name: "removed head", wantErr: ErrTampered, tamper: func(t *testing.T, path string) {
+			if err := os.Remove(HeadPath(path)); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{name: "forged head", wantErr: ErrTampered, tamper: func(t *testing.T, path string) {
+			head, err := ReadHead(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.Marshal(newHead([]byte("other"), head.Seq-1, head.Hash))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(HeadPath(path), data, filePerm); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{name: "torn last record", wantTorn: true, wantCount: events, tamper: func(t *testing.T, path string) {
+			appendData(t, path, `{"seq":11,"ti`)
+		}},
+		{name: "unrelated files", wantCount: events, tamper: func(t *testing.T, path string) {
+			for _, name := range []string{"audit-notes.jsonl", "audit-2024.jsonl", "audit-20240102T150405.jsonl"} {
+				if err := os.WriteFile(filepath.Join(filepath.Dir(path), name), []byte("notes\n"), filePerm); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}},
+		{name: "unterminated last record", wantCount: events, tamper: func(t *testing.T, path string) {
+			lines := readLines(t, path)
+			lines[len(lines)-2] = strings.TrimSuffix(lines[len(lines)-2], "\n")
+			writeLines(t, path, lines)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeLog(t, events)
+			files, err := Files(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) < 3 {
+				t.Fatalf("log has %d files, want rotated ones", len(files))
+			}
+			if tt.tamper != nil {
+				tt.tamper(t, path)
+			}
+			key := tt.key
+			if key == "" {
+				key = testKey
+			}
+
+			res, err := Verify(path, key)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if res.Events != tt.wantCount || res.Torn != tt.wantTorn {
+				t.Fatalf("Verify() = %+v, want %d events, torn %v", res, tt.wantCount, tt.wantTorn)
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(t *testing.T, path string)
+		wantErr error
+	}{
+		{name: "intact"},
+		{name: "torn last record", tamper: func(t *testing.T, path string) {
+			appendData(t, path, `{"seq":4,"ti`)
+		}},
+		{name: "head behind by crash", tamper: func(t *testing.T, path string) {
+			// crash after the event is written but before the head is saved
+			l, err := Open(discard, filepath.Join(t.TempDir(), "other.jsonl"), testKey, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			lines := readLines(t, path)
+			var e Event
+			if err := json.Unmarshal([]byte(lines[len(lines)-3]), &e); err != nil {
+				t.Fatal(err)
+			}
+			l.seq, l.lastHash = e.Seq, e.Hash
+			if err := l.writeHead(); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(HeadPath(l.path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(HeadPath(path), data, filePerm); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{name: "truncated tail", wantErr: ErrTampered, tamper: func(t *testing.T, path string) {
+			lines := readLines(t, path)
+			writeLines(t, path, lines[:len(lines)-2])
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.jsonl")
+			l, err := Open(discard, path, testKey, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 3; i++ {
+				if err := l.Write(Event{Operation: "Upload", Result: "OK"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := l.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if tt.tamper != nil {
+				tt.tamper(t, path)
+			}
+
+			l, err = Open(discard, path, testKey, 0)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Open() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			// the chain continues after reopening
+			if err := l.Write(Event{Operation: "Download", Result: "OK"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := l.Close(); err != nil {
+				t.Fatal(err)
+			}
+			res, err := Verify(path, testKey)
+			if err != nil || res.Events != 4 || res.Torn {
+				t.Fatalf("Verify() = %+v, %v, want 4 events", res, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Event is one audit record. Hash covers all other fields including PrevHash,
+// so records form a chain and modifying or removing any of them is detectable.
+// Keyed hash can't be recomputed without the key, so the chain can't be rewritten either.
+type Event struct {
+	Seq        uint64    `json:"seq"`
+	Time       time.Time `json:"time"`
+	Principal  string    `json:"principal,omitempty"`
+	AuthMethod string    `json:"auth_method,omitempty"`
+	Tenant     string    `json:"tenant,omitempty"`
+	Peer       string    `json:"peer,omitempty"`
+	Operation  string    `json:"operation"`
+	Target     string    `json:"target,omitempty"`
+	// Result is grpc status code name, e.g. "OK" or "PermissionDenied", or http status text
+	// without spaces for share downloads, e.g. "PartialContent".
+	Result     string `json:"result"`
+	Error      string `json:"error,omitempty"`
+	BytesIn    int64  `json:"bytes_in"`
+	BytesOut   int64  `json:"bytes_out"`
+	DurationMs int64  `json:"duration_ms"`
+	PrevHash   string `json:"prev_hash"`
+	Hash       string `json:"hash"`
+}
+
+// computeHash returns HMAC-SHA256 of the event without its Hash field, SHA256 if key is empty.
+func (e Event) computeHash(key []byte) (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	return mac(key, data), nil
+}
+
+// Head is the last written event, saved next to the log, so truncated log is detectable.
+type Head struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+	// MAC is keyed hash of Seq and Hash.
+	MAC string `json:"mac"`
+}
+
+func newHead(key []byte, seq uint64, hash string) Head {
+	return Head{Seq: seq, Hash: hash, MAC: headMAC(key, seq, hash)}
+}
+
+func (h Head) valid(key []byte) bool {
+	return hmac.Equal([]byte(h.MAC), []byte(headMAC(key, h.Seq, h.Hash)))
+}
+
+func headMAC(key []byte, seq uint64, hash string) string {
+	return mac(key, []byte(strconv.FormatUint(seq, 10)+":"+hash))
+}
+
+func mac(key []byte, data []byte) string {
+	if len(key) == 0 {
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:])
+	}
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,232 @@
+package audit
+
+import (
+	"cloud/internal/logging"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	filePerm = 0o640
+	dirPerm  = 0o750
+)
+
+// Log is append-only JSON-lines audit log with size based rotation.
+// Rotated files are kept, the hash chain continues across them. Head of the chain is saved
+// next to the log after every event, see HeadPath.
+type Log struct {
+	path string
+	key  []byte
+
+	mu       sync.Mutex
+	file     *logging.File
+	seq      uint64
+	lastHash string
+}
+
+// Open opens audit log and restores the chain from the last record. Events are hashed with the key.
+// Zero maxSize disables rotation. Record torn by a crash at the end of the log is cut off, the log
+// ending before its saved head is refused as tampered.
+func Open(log *slog.Logger, path string, key string, maxSize int64) (*Log, error) {
+	const fn = "audit.Open"
+
+	if err := os.MkdirAll(filepath.Dir(path), dirPerm); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	files, err := Files(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	if len(files) > 0 {
+		torn, err := truncateTorn(files[len(files)-1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+		if torn > 0 {
+			log.Warn("torn audit record cut off", slog.String("fn", fn), slog.String("file", files[len(files)-1]),
+				slog.Int64("bytes", torn))
+		}
+	}
+	last, err := lastEvent(files)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	l := &Log{
+		path:     path,
+		key:      []byte(key),
+		seq:      last.Seq,
+		lastHash: last.Hash,
+	}
+
+	head, err := ReadHead(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist) && last.Seq > 0:
+		log.Warn("audit head is missing, saving the last event as head", slog.String("fn", fn),
+			slog.Uint64("seq", last.Seq))
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	default:
+		if err := checkHead(l.key, head, last); err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+	}
+	// anchors logs written before heads were saved
+	if err := l.writeHead(); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	l.file, err = logging.OpenFile(path, maxSize, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	return l, nil
+}
+
+// Write appends event to the log filling its sequence number and hashes.
+func (l *Log) Write(e Event) error {
+	const fn = "audit.Write"
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e.Seq = l.seq + 1
+	e.Time = e.Time.UTC()
+	e.PrevHash = l.lastHash
+	hash, err := e.computeHash(l.key)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	e.Hash = hash
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	line = append(line, '\n')
+
+	// rotated files are kept, the chain continues across them
+	if _, err := l.file.Write(line); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	l.seq = e.Seq
+	l.lastHash = e.Hash
+	if err := l.writeHead(); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	return nil
+}
+
+// Close closes the log file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.file.Close()
+}
+
+// writeHead replaces saved head with the last event, mu must be held or log not shared yet.
+func (l *Log) writeHead() error {
+	data, err := json.Marshal(newHead(l.key, l.seq, l.lastHash))
+	if err != nil {
+		return err
+	}
+	tmp := HeadPath(l.path) + ".tmp"
+	if err := os.WriteFile(tmp, data, filePerm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, HeadPath(l.path)); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// HeadPath returns path of the file the head of the log is saved to.
+func HeadPath(path string) string {
+	return path + ".head"
+}
+
+// ReadHead reads saved head of the log.
+func ReadHead(path string) (Head, error) {
+	data, err := os.ReadFile(HeadPath(path))
+	if err != nil {
+		return Head{}, err
+	}
+	var h Head
+	if err := json.Unmarshal(data, &h); err != nil {
+		return Head{}, fmt.Errorf("%w: head: %w", ErrTampered, err)
+	}
+	return h, nil
+}
+
+// checkHead checks the last event of the log reaches the saved head. The head may be one event behind:
+// the server could crash after writing the event but before saving the head.
+func checkHead(key []byte, head Head, last Event) error {
+	switch {
+	case !head.valid(key):
+		return fmt.Errorf("%w: head signature mismatch", ErrTampered)
+	case last.Seq < head.Seq:
+		return fmt.Errorf("%w: log ends at event %d, head is event %d", ErrTampered, last.Seq, head.Seq)
+	case last.Seq == head.Seq && last.Hash != head.Hash:
+		return fmt.Errorf("%w: event %d differs from head", ErrTampered, last.Seq)
+	case last.Seq == head.Seq+1 && last.PrevHash != head.Hash:
+		return fmt.Errorf("%w: event %d doesn't follow head", ErrTampered, last.Seq)
+	case last.Seq > head.Seq+1:
+		return fmt.Errorf("%w: log ends at event %d, head is event %d", ErrTampered, last.Seq, head.Seq)
+	}
+	return nil
+}
+
+// truncateTorn cuts off the last line of the file if it isn't terminated, which is left by a crash
+// during write. Returns number of removed bytes.
+func truncateTorn(name string) (int64, error) {
+	file, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	end, err := lastLineEnd(file, info.Size())
+	if err != nil || end == info.Size() {
+		return 0, err
+	}
+	if err := file.Truncate(end); err != nil {
+		return 0, err
+	}
+	return info.Size() - end, file.Sync()
+}
+
+// lastLineEnd returns offset after the last newline of the first size bytes, 0 if there is none.
+func lastLineEnd(r io.ReaderAt, size int64) (int64, error) {
+	const chunk = 64 * 1024
+
+	buf := make([]byte, chunk)
+	for end := size; end > 0; {
+		start := max(end-chunk, 0)
+		n, err := r.ReadAt(buf[:end-start], start)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		for i := n - 1; i >= 0; i-- {
+			if buf[i] == '\n' {
+				return start + int64(i) + 1, nil
+			}
+		}
+		end = start
+	}
+	return 0, nil
+}
@@ -0,0 +1,204 @@
+package audit
+
+import (
+	"bufio"
+	"cloud/internal/logging"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var ErrTampered = errors.New("audit log chain is broken")
+
+// maxLine is max length of one record.
+const maxLine = 1024 * 1024
+
+// Filter selects events, zero fields match everything.
+type Filter struct {
+	Principal string
+	Tenant    string
+	Operation string
+	// Target matches events whose target contains it.
+	Target string
+	Result string
+	Since  time.Time
+	Until  time.Time
+}
+
+// Match reports whether event matches the filter.
+func (f Filter) Match(e Event) bool {
+	switch {
+	case f.Principal != "" && e.Principal != f.Principal,
+		f.Tenant != "" && e.Tenant != f.Tenant,
+		f.Operation != "" && !strings.EqualFold(e.Operation, f.Operation),
+		f.Target != "" && !strings.Contains(e.Target, f.Target),
+		f.Result != "" && !strings.EqualFold(e.Result, f.Result),
+		!f.Since.IsZero() && e.Time.Before(f.Since),
+		!f.Until.IsZero() && !e.Time.Before(f.Until):
+		return false
+	}
+	return true
+}
+
+// Files returns rotated files of the log in time order followed by the current one if it exists.
+func Files(path string) ([]string, error) {
+	rotated, err := logging.Rotated(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		rotated = append(rotated, path)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return rotated, nil
+}
+
+// Read calls fn for every event of the files in order. Unterminated last line of the last file
+// is skipped: it is a record torn by a crash, which Open cuts off.
+func Read(files []string, fn func(e Event) error) error {
+	for i, name := range files {
+		if _, err := readFile(name, i == len(files)-1, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VerifyResult is outcome of successful verification.
+type VerifyResult struct {
+	// Events is number of checked events.
+	Events int
+	// Torn is whether torn record at the end of the log was skipped.
+	Torn bool
+}
+
+// Verify checks sequence numbers and hash chain of the log at path and its rotated files with the key.
+// The chain must start from the first event and reach the saved head, so removed oldest files
+// and truncated log are detected.
+func Verify(path string, key string) (VerifyResult, error) {
+	files, err := Files(path)
+	if err != nil {
+		return VerifyResult{}, err
+	}
+
+	var (
+		res  VerifyResult
+		prev Event
+	)
+	check := func(e Event) error {
+		hash, err := e.computeHash([]byte(key))
+		if err != nil {
+			return err
+		}
+		switch {
+		case hash != e.Hash:
+			return fmt.Errorf("%w: event %d hash mismatch", ErrTampered, e.Seq)
+		case res.Events == 0 && (e.Seq != 1 || e.PrevHash != ""):
+			return fmt.Errorf("%w: log starts at event %d, older events are missing", ErrTampered, e.Seq)
+		case res.Events > 0 && (e.Seq != prev.Seq+1 || e.PrevHash != prev.Hash):
+			return fmt.Errorf("%w: event %d doesn't follow event %d", ErrTampered, e.Seq, prev.Seq)
+		}
+		prev = e
+		res.Events++
+		return nil
+	}
+	for i, name := range files {
+		torn, err := readFile(name, i == len(files)-1, check)
+		if err != nil {
+			return res, err
+		}
+		res.Torn = res.Torn || torn
+	}
+
+	head, err := ReadHead(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist) && res.Events == 0:
+		return res, nil
+	case errors.Is(err, os.ErrNotExist):
+		return res, fmt.Errorf("%w: head is missing", ErrTampered)
+	case err != nil:
+		return res, err
+	}
+	return res, checkHead([]byte(key), head, prev)
+}
+
+// readFile calls fn for every event of the file. If tolerateTorn is set, unterminated last line
+// which isn't a valid event is skipped and reported.
+func readFile(name string, tolerateTorn bool, fn func(e Event) error) (bool, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReaderSize(file, 64*1024)
+	for line := 1; ; line++ {
+		data, err := r.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			data, err = readLong(r, data)
+		}
+		if errors.Is(err, io.EOF) && len(data) == 0 {
+			return false, nil
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return false, err
+		}
+		torn := errors.Is(err, io.EOF)
+
+		var e Event
+		if err := json.Unmarshal(data, &e); err != nil {
+			if torn && tolerateTorn {
+				return true, nil
+			}
+			return false, fmt.Errorf("%w: %s:%d: %w", ErrTampered, name, line, err)
+		}
+		if err := fn(e); err != nil {
+			return false, err
+		}
+		if torn {
+			return false, nil
+		}
+	}
+}
+
+// readLong reads the rest of a line longer than the reader buffer up to maxLine.
+func readLong(r *bufio.Reader, head []byte) ([]byte, error) {
+	data := append([]byte(nil), head...)
+	for {
+		chunk, err := r.ReadSlice('\n')
+		data = append(data, chunk...)
+		if len(data) > maxLine {
+			return nil, fmt.Errorf("%w: record is longer than %d bytes", ErrTampered, maxLine)
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return data, err
+		}
+	}
+}
+
+// lastEvent returns the last event of the newest non-empty file.
+func lastEvent(files []string) (Event, error) {
+	for i := len(files) - 1; i >= 0; i-- {
+		var (
+			last  Event
+			found bool
+		)
+		_, err := readFile(files[i], false, func(e Event) error {
+			last, found = e, true
+			return nil
+		})
+		if err != nil {
+			return Event{}, err
+		}
+		if found {
+			return last, nil
+		}
+	}
+	return Event{}, nil
+}
@@ -0,0 +1,276 @@
+package backup
+
+import (
+	"archive/tar"
+	"cloud/internal/storage/drive"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	filePerm = 0o640
+	// ZstdExt is archive extension which enables zstd compression.
+	ZstdExt = ".zst"
+)
+
+// Archive layout: header first, then metadata and content of each image by tenant, manifest last.
+const (
+	headerName   = "snapshot.json"
+	manifestName = "manifest.json"
+	imagesDir    = "images"
+	metaDir      = "meta"
+	metaExt      = ".json"
+	// paxSHA256 is PAX record with checksum of image content, so restore verifies it before the manifest.
+	paxSHA256 = "CLOUD.sha256"
+)
+
+// Snapshotter reads stored images consistently with their metadata.
+type Snapshotter interface {
+	Snapshot(ctx context.Context, visit func(img drive.SnapshotImage, content io.Reader) error) ([]drive.Problem, error)
+}
+
+// Source is store of a tenant to back up.
+type Source struct {
+	Tenant  string
+	Storage Snapshotter
+}
+
+// Backup writes snapshot of the sources to tar archive at path, zstd compressed if path ends with ".zst",
+// and its manifest next to it. Snapshot is incremental if base isn't nil: content of images with
+// the same checksum in base isn't written again, metadata of all images is.
+// The archive appears at path only once complete.
+func Backup(ctx context.Context, path string, sources []Source, base *Manifest) (*Manifest, error) {
+	const fn = "backup.Backup"
+
+	header, err := newHeader(base)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	file, err := os.OpenFile(path+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, filePerm)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	defer os.Remove(path + ".tmp")
+	defer file.Close()
+
+	manifest, err := write(ctx, file, strings.HasSuffix(path, ZstdExt), header, sources, base)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	if err := file.Sync(); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	if err := WriteManifest(ManifestPath(path), manifest); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return manifest, nil
+}
+
+func write(ctx context.Context, w io.Writer, compress bool, header Header, sources []Source, base *Manifest) (*Manifest, error) {
+	var enc *zstd.Encoder
+	if compress {
+		var err error
+		enc, err = zstd.NewWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		// closed on error to stop its goroutines, the archive is discarded anyway
+		defer func() {
+			if enc != nil {
+				_ = enc.Close()
+			}
+		}()
+		w = enc
+	}
+	tw := tar.NewWriter(w)
+
+	if err := writeJSON(tw, headerName, header); err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{
+		Header:  header,
+		Tenants: make(map[string]map[string]Entry, len(sources)),
+		Skipped: make([]Skipped, 0),
+	}
+	for _, src := range sources {
+		entries := make(map[string]Entry)
+		manifest.Tenants[src.Tenant] = entries
+
+		var unchanged map[string]Entry
+		if base != nil {
+			unchanged = base.Tenants[src.Tenant]
+		}
+
+		problems, err := src.Storage.Snapshot(ctx, func(img drive.SnapshotImage, content io.Reader) error {
+			if img.Meta != nil {
+				if err := writeJSON(tw, path.Join(src.Tenant, metaDir, img.Name+metaExt), img.Meta); err != nil {
+					return err
+				}
+			}
+
+			if prev, ok := unchanged[img.Name]; ok && prev.SHA256 == img.SHA256 {
+				entries[img.Name] = prev
+				return nil
+			}
+
+			err := tw.WriteHeader(&tar.Header{
+				Typeflag:   tar.TypeReg,
+				Name:       path.Join(src.Tenant, imagesDir, img.Name),
+				Size:       img.Size,
+				Mode:       0o644,
+				ModTime:    img.ModTime,
+				PAXRecords: map[string]string{paxSHA256: img.SHA256},
+				Format:     tar.FormatPAX,
+			})
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(tw, content); err != nil {
+				return err
+			}
+
+			entries[img.Name] = Entry{Size: img.Size, SHA256: img.SHA256, Snapshot: header.ID}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", src.Tenant, err)
+		}
+		for _, p := range problems {
+			manifest.Skipped = append(manifest.Skipped, Skipped{Tenant: src.Tenant, Problem: p})
+		}
+	}
+
+	if err := writeJSON(tw, manifestName, manifest); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if enc != nil {
+		err := enc.Close()
+		enc = nil
+		if err != nil {
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
+
+func writeJSON(tw *tar.Writer, name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(data)),
+		Mode:     0o644,
+		ModTime:  time.Now(),
+		Format:   tar.FormatPAX,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
+
+// archiveReader reads tar archive, zstd compressed or not.
+type archiveReader struct {
+	*tar.Reader
+	file *os.File
+	dec  *zstd.Decoder
+}
+
+// zstdMagic starts zstd frames.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+func openArchive(path string) (*archiveReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, len(zstdMagic))
+	n, err := io.ReadFull(file, magic)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	a := &archiveReader{file: file}
+	if n == len(zstdMagic) && string(magic) == string(zstdMagic) {
+		a.dec, err = zstd.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		a.Reader = tar.NewReader(a.dec)
+		return a, nil
+	}
+	a.Reader = tar.NewReader(file)
+	return a, nil
+}
+
+func (a *archiveReader) Close() error {
+	if a.dec != nil {
+		a.dec.Close()
+	}
+	return a.file.Close()
+}
+
+// readJSON decodes current entry of the archive.
+func (a *archiveReader) readJSON(v any) error {
+	if err := json.NewDecoder(a).Decode(v); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSnapshot, err)
+	}
+	return nil
+}
+
+// readHeader reads header of the archive at path.
+func readHeader(path string) (Header, error) {
+	a, err := openArchive(path)
+	if err != nil {
+		return Header{}, err
+	}
+	defer a.Close()
+
+	hdr, err := a.Next()
+	if err != nil {
+		return Header{}, fmt.Errorf("%w: %w", ErrInvalidSnapshot, err)
+	}
+	if hdr.Name != headerName {
+		return Header{}, fmt.Errorf("%w: %s is missing", ErrInvalidSnapshot, headerName)
+	}
+
+	var h Header
+	if err := a.readJSON(&h); err != nil {
+		return Header{}, err
+	}
+	if err := h.validate(); err != nil {
+		return Header{}, err
+	}
+	return h, nil
+}
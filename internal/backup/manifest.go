@@ -0,0 +1,135 @@
+package backup
+
+import (
+	"cloud/internal/storage/drive"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	KindFull        = "full"
+	KindIncremental = "incremental"
+)
+
+// formatVersion is version of archive layout and manifest.
+const formatVersion = 1
+
+var (
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
+	ErrBrokenChain     = errors.New("snapshots don't form a chain")
+)
+
+// Header identifies a snapshot, it's the first entry of the archive.
+type Header struct {
+	Version int    `json:"version"`
+	ID      string `json:"id"`
+	Kind    string `json:"kind"`
+	// Base is ID of the snapshot an incremental one is based on.
+	Base    string    `json:"base,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// Entry is an image of the store at snapshot time.
+type Entry struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	// Snapshot is ID of the snapshot which holds the content.
+	Snapshot string `json:"snapshot"`
+}
+
+// Skipped is a corrupt image left out of the snapshot.
+type Skipped struct {
+	Tenant string `json:"tenant"`
+	drive.Problem
+}
+
+// Manifest lists all images of the store at snapshot time by tenant and name, it's the last entry
+// of the archive and is also written next to it to base incremental snapshots on.
+type Manifest struct {
+	Header
+	Tenants map[string]map[string]Entry `json:"tenants"`
+	Skipped []Skipped                   `json:"skipped,omitempty"`
+}
+
+// newHeader creates header of a new snapshot, incremental if base isn't nil.
+func newHeader(base *Manifest) (Header, error) {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return Header{}, err
+	}
+
+	now := time.Now().UTC()
+	h := Header{
+		Version: formatVersion,
+		ID:      now.Format("20060102T150405Z") + "-" + hex.EncodeToString(id),
+		Kind:    KindFull,
+		Created: now,
+	}
+	if base != nil {
+		h.Kind = KindIncremental
+		h.Base = base.ID
+	}
+	return h, nil
+}
+
+func (h Header) validate() error {
+	if h.Version != formatVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, h.Version)
+	}
+	if h.ID == "" {
+		return fmt.Errorf("%w: empty id", ErrInvalidSnapshot)
+	}
+	switch {
+	case h.Kind == KindFull && h.Base == "":
+	case h.Kind == KindIncremental && h.Base != "":
+	default:
+		return fmt.Errorf("%w: kind %q with base %q", ErrInvalidSnapshot, h.Kind, h.Base)
+	}
+	return nil
+}
+
+// ManifestPath returns path of the manifest written next to the archive.
+func ManifestPath(archive string) string {
+	return archive + ".manifest.json"
+}
+
+// ReadManifest reads manifest written next to an archive.
+func ReadManifest(path string) (*Manifest, error) {
+	const fn = "backup.ReadManifest"
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", fn, ErrInvalidSnapshot, err)
+	}
+	if err := m.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	return &m, nil
+}
+
+// WriteManifest replaces the file with the manifest, readers never see a partial file.
+func WriteManifest(path string, m *Manifest) error {
+	const fn = "backup.WriteManifest"
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	if err := os.WriteFile(path+".tmp", append(data, '\n'), filePerm); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		_ = os.Remove(path + ".tmp")
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package backup
+
+import (
+	"cloud/internal/storage/drive"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var ErrIncomplete = errors.New("images of the snapshot are missing in its chain")
+
+// Restorer stores images of a snapshot.
+type Restorer interface {
+	Restore(ctx context.Context, img drive.SnapshotImage, content io.Reader) error
+}
+
+// Restore rebuilds stores of targets by tenant from archives: a full snapshot followed by its
+// incremental snapshots in order. Stores end up with images of the last snapshot, tenants of
+// the snapshot without target are skipped. Returns the manifest of the last snapshot.
+func Restore(ctx context.Context, archives []string, targets map[string]Restorer) (*Manifest, error) {
+	const fn = "backup.Restore"
+
+	if len(archives) == 0 {
+		return nil, fmt.Errorf("%s: %w: no archives", fn, ErrBrokenChain)
+	}
+
+	headers := make([]Header, 0, len(archives))
+	for i, archive := range archives {
+		h, err := readHeader(archive)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", fn, archive, err)
+		}
+		switch {
+		case i == 0 && h.Kind != KindFull:
+			return nil, fmt.Errorf("%s: %w: %s is %s, full snapshot must be first", fn, ErrBrokenChain, archive, h.Kind)
+		case i > 0 && h.Base != headers[i-1].ID:
+			return nil, fmt.Errorf("%s: %w: %s is based on %s, not on %s", fn, ErrBrokenChain, archive, h.Base,
+				headers[i-1].ID)
+		}
+		headers = append(headers, h)
+	}
+
+	r := &restore{
+		targets:  targets,
+		metas:    make(map[string]*drive.Meta),
+		restored: make(map[string]struct{}),
+	}
+
+	// the last snapshot has metadata of all images and content of images changed since its base,
+	// content of others is taken from older snapshots
+	last := len(archives) - 1
+	if err := r.archive(ctx, archives[last], headers[last], true); err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", fn, archives[last], err)
+	}
+	for i := last - 1; i >= 0; i-- {
+		if len(r.needed(headers[i].ID)) == 0 {
+			continue
+		}
+		if err := r.archive(ctx, archives[i], headers[i], false); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", fn, archives[i], err)
+		}
+	}
+
+	var missing int
+	for tenant := range targets {
+		for name := range r.manifest.Tenants[tenant] {
+			if _, ok := r.restored[key(tenant, name)]; !ok {
+				missing++
+			}
+		}
+	}
+	if missing > 0 {
+		return r.manifest, fmt.Errorf("%s: %w: %d images", fn, ErrIncomplete, missing)
+	}
+
+	return r.manifest, nil
+}
+
+// restore is state of Restore.
+type restore struct {
+	targets map[string]Restorer
+	// manifest is manifest of the last snapshot.
+	manifest *Manifest
+	// metas are metadata of the last snapshot by tenant and name.
+	metas map[string]*drive.Meta
+	// restored are tenants and names of restored images.
+	restored map[string]struct{}
+}
+
+func key(tenant string, name string) string {
+	return tenant + "/" + name
+}
+
+// needed returns images of the last snapshot which content is held by the snapshot id.
+func (r *restore) needed(id string) map[string]Entry {
+	res := make(map[string]Entry)
+	for tenant := range r.targets {
+		for name, e := range r.manifest.Tenants[tenant] {
+			if _, ok := r.restored[key(tenant, name)]; !ok && e.Snapshot == id {
+				res[key(tenant, name)] = e
+			}
+		}
+	}
+	return res
+}
+
+// archive restores images of the archive. The last archive restores all its images and reads metadata
+// and the manifest, older ones restore images the manifest refers to them for.
+func (r *restore) archive(ctx context.Context, archive string, header Header, last bool) error {
+	a, err := openArchive(archive)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	var needed map[string]Entry
+	if !last {
+		needed = r.needed(header.ID)
+	}
+
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		hdr, err := a.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidSnapshot, err)
+		}
+
+		switch hdr.Name {
+		case headerName:
+			continue
+		case manifestName:
+			if !last {
+				continue
+			}
+			var m Manifest
+			if err := a.readJSON(&m); err != nil {
+				return err
+			}
+			if m.ID != header.ID {
+				return fmt.Errorf("%w: manifest of %s in %s", ErrInvalidSnapshot, m.ID, header.ID)
+			}
+			r.manifest = &m
+			continue
+		}
+
+		tenant, dir, name, err := parseEntry(hdr.Name)
+		if err != nil {
+			return err
+		}
+		target, ok := r.targets[tenant]
+		if !ok {
+			continue
+		}
+
+		switch {
+		case dir == metaDir && last:
+			var meta drive.Meta
+			if err := a.readJSON(&meta); err != nil {
+				return err
+			}
+			r.metas[key(tenant, strings.TrimSuffix(name, metaExt))] = &meta
+		case dir == imagesDir:
+			sum := hdr.PAXRecords[paxSHA256]
+			if !last {
+				e, ok := needed[key(tenant, name)]
+				if !ok {
+					continue
+				}
+				sum = e.SHA256
+			}
+
+			img := drive.SnapshotImage{
+				Name:    name,
+				Size:    hdr.Size,
+				SHA256:  sum,
+				ModTime: hdr.ModTime,
+				Meta:    r.metas[key(tenant, name)],
+			}
+			if err := target.Restore(ctx, img, a); err != nil {
+				return fmt.Errorf("tenant %s: %w", tenant, err)
+			}
+			r.restored[key(tenant, name)] = struct{}{}
+		}
+	}
+
+	if last && r.manifest == nil {
+		return fmt.Errorf("%w: %s is missing", ErrInvalidSnapshot, manifestName)
+	}
+	return nil
+}
+
+// parseEntry splits archive entry name into tenant, "images" or "meta" and name of the image or its metadata.
+// Names which would escape the store are rejected.
+func parseEntry(entry string) (string, string, string, error) {
+	parts := strings.SplitN(entry, "/", 3)
+	if len(parts) != 3 || (parts[1] != imagesDir && parts[1] != metaDir) ||
+		path.Clean(parts[2]) != parts[2] || !filepath.IsLocal(parts[2]) {
+		return "", "", "", fmt.Errorf("%w: unexpected entry %q", ErrInvalidSnapshot, entry)
+	}
+	return parts[0], parts[1], parts[2], nil
+}
@@ -0,0 +1,218 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"cloud/internal/storage/drive"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// store is in-memory store of images with their metadata.
+type store struct {
+	images map[string][]byte
+	metas  map[string]*drive.Meta
+}
+
+func newStore() *store {
+	return &store{images: make(map[string][]byte), metas: make(map[string]*drive.Meta)}
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *store) Snapshot(ctx context.Context, visit func(img drive.SnapshotImage, content io.Reader) error) ([]drive.Problem, error) {
+	names := make([]string, 0, len(s.images))
+	for name := range s.images {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		data := s.images[name]
+		img := drive.SnapshotImage{
+			Name:    name,
+			Size:    int64(len(data)),
+			SHA256:  checksum(data),
+			ModTime: time.Unix(1700000000, 0),
+			Meta:    s.metas[name],
+		}
+		if err := visit(img, bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (s *store) Restore(ctx context.Context, img drive.SnapshotImage, content io.Reader) error {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	if checksum(data) != img.SHA256 {
+		return drive.ErrChecksumMismatch
+	}
+	s.images[img.Name] = data
+	if img.Meta != nil {
+		s.metas[img.Name] = img.Meta
+	}
+	return nil
+}
+
+func TestParseEntry(t *testing.T) {
+	tests := []struct {
+		entry  string
+		tenant string
+		dir    string
+		name   string
+		ok     bool
+	}{
+		{entry: "default/images/a.png", tenant: "default", dir: imagesDir, name: "a.png", ok: true},
+		{entry: "default/images/cats/a.png", tenant: "default", dir: imagesDir, name: "cats/a.png", ok: true},
+		{entry: "team-a/meta/cats/a.png.json", tenant: "team-a", dir: metaDir, name: "cats/a.png.json", ok: true},
+		{entry: "default/images"},
+		{entry: "default/tmp/a.png"},
+		{entry: "default/images/../a.png"},
+		{entry: "default/images/cats/../../../a.png"},
+		{entry: "default/images//etc/passwd"},
+		{entry: "default/images/./a.png"},
+		{entry: "default/images/cats/"},
+		{entry: "default/images/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			tenant, dir, name, err := parseEntry(tt.entry)
+			if !tt.ok {
+				if !errors.Is(err, ErrInvalidSnapshot) {
+					t.Fatalf("err = %v, want %v", err, ErrInvalidSnapshot)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tenant != tt.tenant || dir != tt.dir || name != tt.name {
+				t.Fatalf("parseEntry = %q, %q, %q, want %q, %q, %q", tenant, dir, name, tt.tenant, tt.dir, tt.name)
+			}
+		})
+	}
+}
+
+func TestRestore(t *testing.T) {
+	for _, ext := range []string{".tar", ".tar" + ZstdExt} {
+		t.Run(ext, func(t *testing.T) {
+			dir := t.TempDir()
+			src := newStore()
+			src.images["a.png"] = []byte("a")
+			src.images["cats/b.png"] = []byte("b")
+			src.metas["a.png"] = &drive.Meta{Name: "a.png", Size: 1, Tags: []string{"first"}}
+
+			full := filepath.Join(dir, "full"+ext)
+			base, err := Backup(context.Background(), full, []Source{{Tenant: "default", Storage: src}}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the incremental snapshot holds only the changed and new images
+			src.images["cats/b.png"] = []byte("b2")
+			src.images["c.png"] = []byte("c")
+			src.metas["a.png"] = &drive.Meta{Name: "a.png", Size: 1, Tags: []string{"second"}}
+			incr := filepath.Join(dir, "incr"+ext)
+			if _, err := Backup(context.Background(), incr, []Source{{Tenant: "default", Storage: src}}, base); err != nil {
+				t.Fatal(err)
+			}
+
+			dst := newStore()
+			manifest, err := Restore(context.Background(), []string{full, incr}, map[string]Restorer{"default": dst})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if manifest.Kind != KindIncremental {
+				t.Fatalf("Kind = %q, want %q", manifest.Kind, KindIncremental)
+			}
+			if !reflect.DeepEqual(dst.images, src.images) {
+				t.Fatalf("images = %q, want %q", dst.images, src.images)
+			}
+			if got := dst.metas["a.png"]; got == nil || !reflect.DeepEqual(got.Tags, []string{"second"}) {
+				t.Fatalf("metadata = %+v, want the latest", got)
+			}
+		})
+	}
+}
+
+func TestRestoreRejectsEscapingEntries(t *testing.T) {
+	for _, entry := range []string{
+		"default/images/../../evil.png",
+		"default/images//tmp/evil.png",
+		"other/meta/../evil.json",
+		"evil.png",
+	} {
+		t.Run(entry, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), "full.tar")
+			header, err := newHeader(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeArchive(t, archive, header, entry)
+
+			dst := newStore()
+			_, err = Restore(context.Background(), []string{archive}, map[string]Restorer{"default": dst})
+			if !errors.Is(err, ErrInvalidSnapshot) {
+				t.Fatalf("err = %v, want %v", err, ErrInvalidSnapshot)
+			}
+			if len(dst.images) != 0 {
+				t.Fatalf("restored %q, want nothing", dst.images)
+			}
+		})
+	}
+}
+
+// writeArchive writes archive with the header, the image entry and an empty manifest.
+func writeArchive(t *testing.T, path string, header Header, entry string) {
+	t.Helper()
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	tw := tar.NewWriter(file)
+	if err := writeJSON(tw, headerName, header); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("evil")
+	err = tw.WriteHeader(&tar.Header{
+		Typeflag:   tar.TypeReg,
+		Name:       entry,
+		Size:       int64(len(data)),
+		Mode:       0o644,
+		PAXRecords: map[string]string{paxSHA256: checksum(data)},
+		Format:     tar.FormatPAX,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	manifest := &Manifest{Header: header, Tenants: map[string]map[string]Entry{}}
+	if err := writeJSON(tw, manifestName, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
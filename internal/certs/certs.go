@@ -0,0 +1,168 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader keeps server certificate and client CA pool loaded from files
+// and reloads them when the files change, so certificates can be rotated without restart.
+type Reloader struct {
+	log      *slog.Logger
+	certFile string
+	keyFile  string
+	caFile   string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	modTime time.Time
+}
+
+// NewReloader loads certificate, key and optional client CA bundle.
+func NewReloader(log *slog.Logger, certFile, keyFile, caFile string) (*Reloader, error) {
+	r := &Reloader{
+		log:      log,
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Watch checks files every interval and reloads them on change until ctx is done.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	const fn = "certs.Watch"
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		modTime, err := r.lastModTime()
+		if err != nil {
+			r.log.Error(err.Error(), slog.String("fn", fn))
+			continue
+		}
+
+		r.mu.RLock()
+		changed := modTime.After(r.modTime)
+		r.mu.RUnlock()
+		if !changed {
+			continue
+		}
+
+		// on error the previous certificate is kept
+		if err := r.load(); err != nil {
+			r.log.Error(err.Error(), slog.String("fn", fn))
+			continue
+		}
+		r.log.Info("tls certificates reloaded", slog.String("fn", fn), slog.String("cert", r.certFile))
+	}
+}
+
+// GetCertificate returns current server certificate, see tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+// ClientCAs returns current client CA pool, nil if client CA isn't configured.
+func (r *Reloader) ClientCAs() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.pool
+}
+
+func (r *Reloader) load() error {
+	const fn = "certs.load"
+
+	modTime, err := r.lastModTime()
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		pool, err = LoadPool(r.caFile)
+		if err != nil {
+			return fmt.Errorf("%s: %w", fn, err)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.pool = pool
+	r.modTime = modTime
+	r.mu.Unlock()
+
+	return nil
+}
+
+// lastModTime returns the latest modification time of watched files.
+func (r *Reloader) lastModTime() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{r.certFile, r.keyFile, r.caFile} {
+		if f == "" {
+			continue
+		}
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// LoadPool loads PEM encoded certificates bundle.
+func LoadPool(file string) (*x509.CertPool, error) {
+	const fn = "certs.LoadPool"
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s: %w", fn, errors.New("no certificates found in "+file))
+	}
+	return pool, nil
+}
+
+// ParseVersion parses TLS version like "1.2" or "1.3". Empty version is TLS 1.2.
+func ParseVersion(v string) (uint16, error) {
+	switch v {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported tls version %q", v)
+}
@@ -0,0 +1,71 @@
+package certs
+
+import (
+	"cloud/internal/config"
+	"crypto/tls"
+	"fmt"
+)
+
+// ServerConfig builds server tls config with certificates served by the reloader.
+// Client certificates are verified against client CA if it's set and required if configured so.
+func ServerConfig(cfg config.TLSConfig, r *Reloader) (*tls.Config, error) {
+	const fn = "certs.ServerConfig"
+
+	minVersion, err := ParseVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	base := &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: r.GetCertificate,
+	}
+
+	if cfg.ClientCAFile == "" {
+		return base, nil
+	}
+
+	clientAuth := tls.VerifyClientCertIfGiven
+	if cfg.RequireClientCert {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	// client CA pool may be reloaded, so config is built per connection
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c := base.Clone()
+		c.GetConfigForClient = nil
+		c.ClientAuth = clientAuth
+		c.ClientCAs = r.ClientCAs()
+		return c, nil
+	}
+	return base, nil
+}
+
+// ClientConfig builds client tls config. Empty CA file uses system roots,
+// client certificate is sent only if both cert and key are set.
+func ClientConfig(caFile, certFile, keyFile, serverName string) (*tls.Config, error) {
+	const fn = "certs.ClientConfig"
+
+	c := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+	}
+
+	if caFile != "" {
+		pool, err := LoadPool(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+		c.RootCAs = pool
+	}
+
+	if certFile != "" && keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+
+	return c, nil
+}
@@ -3,14 +3,21 @@ package cloudgrpc
 import (
 	"bufio"
 	"bytes"
+	"cloud/internal/logging"
 	"cloud/pkg/cloudv1"
 	"context"
+	"crypto/tls"
 	"fmt"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"time"
 )
 
 type Client struct {
@@ -18,14 +25,116 @@ type Client struct {
 	log *slog.Logger
 }
 
-// New creates grpc client.
+// tokenCredentials sends bearer token with every call.
+type tokenCredentials struct {
+	token string
+}
+
+func (t tokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// tenantHeader is request metadata key to select tenant.
+const tenantHeader = "x-tenant"
+
+// tenantInterceptors send tenant name with every call.
+func tenantInterceptors(tenant string) []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply any,
+			cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			ctx = metadata.AppendToOutgoingContext(ctx, tenantHeader, tenant)
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}),
+		grpc.WithChainStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+			method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			ctx = metadata.AppendToOutgoingContext(ctx, tenantHeader, tenant)
+			return streamer(ctx, desc, cc, method, opts...)
+		}),
+	}
+}
+
+// requestIDHeader is request metadata key of request id the server logs the call with.
+const requestIDHeader = "x-request-id"
+
+// requestIDInterceptors send request id of the context with every call.
+func requestIDInterceptors() []grpc.DialOption {
+	withID := func(ctx context.Context) context.Context {
+		if id := logging.RequestID(ctx); id != "" {
+			return metadata.AppendToOutgoingContext(ctx, requestIDHeader, id)
+		}
+		return ctx
+	}
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply any,
+			cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			return invoker(withID(ctx), method, req, reply, cc, opts...)
+		}),
+		grpc.WithChainStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+			method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return streamer(withID(ctx), desc, cc, method, opts...)
+		}),
+	}
+}
+
+// retryAfterInterceptor logs retry delay the server suggests for rejected calls.
+func retryAfterInterceptor(log *slog.Logger) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		var header metadata.MD
+		err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Header(&header))...)
+		if v := header.Get("retry-after"); err != nil && len(v) > 0 {
+			log.InfoContext(ctx, "server asks to retry later", slog.String("method", method),
+				slog.String("retry_after_seconds", v[0]))
+		}
+		return err
+	}
+}
+
+// UploadOptions are optional upload params.
+type UploadOptions struct {
+	RejectSimilar bool
+	// SimilarityThreshold is max perceptual hash distance, nil - server default.
+	SimilarityThreshold *uint32
+	Tags                []string
+	Metadata            map[string]string
+	Folder              string
+}
+
+// New creates grpc client. Nil tls config means insecure connection.
+// Empty tenant lets the server resolve it from the principal.
 func New(
 	addr string,
+	token string,
+	tenant string,
+	tlsCfg *tls.Config,
 	log *slog.Logger,
 ) (*Client, error) {
 	const fn = "cloudgrpc.New"
 
-	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	creds := insecure.NewCredentials()
+	if tlsCfg != nil {
+		creds = credentials.NewTLS(tlsCfg)
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithChainUnaryInterceptor(retryAfterInterceptor(log)),
+		// trace context of the caller is sent to the server
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+	}
+	if token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCredentials{token: token}))
+	}
+	if tenant != "" {
+		opts = append(opts, tenantInterceptors(tenant)...)
+	}
+	opts = append(opts, requestIDInterceptors()...)
+
+	conn, err := grpc.Dial(addr, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("%v: %w", fn, err)
 	}
@@ -39,32 +148,39 @@ func New(
 }
 
 // Upload uploads image from cloud.
-func (c *Client) Upload(src string) error {
+func (c *Client) Upload(ctx context.Context, src string, opts UploadOptions) error {
 	const fn = "cloudgrpc.Upload"
-	stream, err := c.api.Upload(context.Background())
+	stream, err := c.api.Upload(ctx)
 	if err != nil {
-		c.log.Error(err.Error(), slog.String("fn", fn))
+		c.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
 		return fmt.Errorf("%s: %w", fn, err)
 	}
 
 	// try to open source file
 	file, err := os.Open(src)
 	if err != nil {
-		c.log.Error(err.Error(), slog.String("fn", fn))
+		c.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
 		return fmt.Errorf("%s: %w", fn, err)
 	}
 	defer file.Close()
 
 	r := bufio.NewReader(file)
 
-	// send filename
+	// send image info
 	data := &cloudv1.UploadRequest{
-		Data: &cloudv1.UploadRequest_Name{
-			Name: src,
+		Data: &cloudv1.UploadRequest_Info{
+			Info: &cloudv1.UploadInfo{
+				Name:                src,
+				RejectSimilar:       opts.RejectSimilar,
+				SimilarityThreshold: opts.SimilarityThreshold,
+				Tags:                opts.Tags,
+				Metadata:            opts.Metadata,
+				Folder:              opts.Folder,
+			},
 		},
 	}
 	if err := stream.Send(data); err != nil {
-		c.log.Error(err.Error(), slog.String("fn", fn))
+		c.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
 		return fmt.Errorf("%s: %w", fn, err)
 	}
 
@@ -77,7 +193,7 @@ func (c *Client) Upload(src string) error {
 			break
 		}
 		if err != nil {
-			c.log.Error(err.Error(), slog.String("fn", fn))
+			c.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
 			return fmt.Errorf("%s: %w", fn, err)
 		}
 
@@ -91,29 +207,29 @@ func (c *Client) Upload(src string) error {
 			break
 		}
 		if err != nil {
-			c.log.Error(err.Error(), slog.String("fn", fn))
+			c.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
 			return fmt.Errorf("%s: %w", fn, err)
 		}
 	}
 
 	resp, err := stream.CloseAndRecv()
 	if err != nil {
-		c.log.Error(err.Error(), slog.String("fn", fn))
+		c.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
 		return fmt.Errorf("%s: %w", fn, err)
 	}
 
-	c.log.Info("successful upload", slog.String("fn", fn), slog.String("resp", resp.String()))
+	c.log.InfoContext(ctx, "successful upload", slog.String("fn", fn), slog.String("resp", resp.String()))
 
 	return nil
 }
 
 // Download downloads image from cloud.
-func (c *Client) Download(path string, filename string) error {
+func (c *Client) Download(ctx context.Context, path string, filename string) error {
 	const fn = "cloudgrpc.Download"
 
-	stream, err := c.api.Download(context.Background(), &cloudv1.DownloadRequest{Name: filename})
+	stream, err := c.api.Download(ctx, &cloudv1.DownloadRequest{Name: filename})
 	if err != nil {
-		c.log.Error(err.Error(), slog.String("fn", fn))
+		c.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
 		return fmt.Errorf("%s: %w", fn, err)
 	}
 
@@ -126,7 +242,7 @@ func (c *Client) Download(path string, filename string) error {
 			break
 		}
 		if err != nil {
-			c.log.Error(err.Error(), slog.String("fn", fn))
+			c.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
 			return fmt.Errorf("%s: %w", fn, err)
 		}
 
@@ -135,43 +251,234 @@ func (c *Client) Download(path string, filename string) error {
 
 		_, err = buf.Write(chunk)
 		if err != nil {
-			c.log.Error(err.Error(), slog.String("fn", fn))
+			c.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
 			return fmt.Errorf("%s: %w", fn, err)
 		}
 	}
 
-	file, err := os.Create(path + filename)
+	// images in folders are saved by base name
+	file, err := os.Create(path + filepath.Base(filename))
 	if err != nil {
-		c.log.Error(err.Error(), slog.String("fn", fn))
+		c.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
 		return fmt.Errorf("%s: %w", fn, err)
 	}
 	defer file.Close()
 
 	_, err = buf.WriteTo(file)
 	if err != nil {
-		c.log.Error(err.Error(), slog.String("fn", fn))
+		c.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
 		return fmt.Errorf("%s: cannot write buf to file: %w", fn, err)
 	}
 
-	c.log.Info("successful download", slog.String("fn", fn), slog.Int("size", size))
+	c.log.InfoContext(ctx, "successful download", slog.String("fn", fn), slog.Int("size", size))
 
 	return nil
 }
 
-// List prints images on cloud.
-func (c *Client) List() error {
+// List prints images on cloud matching the filter.
+func (c *Client) List(ctx context.Context, filter string) error {
 	const fn = "cloudgrpc.List"
 
-	resp, err := c.api.List(context.Background(), &cloudv1.ListRequest{})
+	resp, err := c.api.List(ctx, &cloudv1.ListRequest{Filter: filter})
 	if err != nil {
-		c.log.Error(err.Error(), slog.String("fn", fn))
+		c.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
 		return fmt.Errorf("%s: %w", fn, err)
 	}
 
-	fmt.Println("Name | Created at | Updated at")
-	for _, val := range resp.Files {
-		fmt.Printf("%s | %s | %s\n", val.Name, val.CreatedAt, val.UpdatedAt)
+	printFiles(resp.Files)
+
+	return nil
+}
+
+func printFiles(files []*cloudv1.FileStructure) {
+	fmt.Println("Name | Created at | Updated at | Color | BlurHash | Tags | Metadata")
+	for _, val := range files {
+		fmt.Printf("%s | %s | %s | %s | %s | %v | %v\n", val.Name, val.CreatedAt, val.UpdatedAt, val.DominantColor,
+			val.BlurHash, val.Tags, val.Metadata)
+	}
+}
+
+// FindSimilar prints images visually similar to the given one.
+// Nil threshold uses the server default.
+func (c *Client) FindSimilar(ctx context.Context, filename string, threshold *uint32) error {
+	const fn = "cloudgrpc.FindSimilar"
+
+	resp, err := c.api.FindSimilar(ctx, &cloudv1.FindSimilarRequest{
+		Name:      filename,
+		Threshold: threshold,
+	})
+	if err != nil {
+		c.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	fmt.Println("Name | Distance")
+	for _, val := range resp.Images {
+		fmt.Printf("%s | %d\n", val.Name, val.Distance)
 	}
 
 	return nil
 }
+
+// SetMetadata sets image metadata and prints the result.
+func (c *Client) SetMetadata(ctx context.Context, filename string, metadata map[string]string, replace bool) error {
+	const fn = "cloudgrpc.SetMetadata"
+
+	resp, err := c.api.SetMetadata(ctx, &cloudv1.SetMetadataRequest{
+		Name:     filename,
+		Metadata: metadata,
+		Replace:  replace,
+	})
+	if err != nil {
+		c.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	printMetadata(resp)
+
+	return nil
+}
+
+// AddTags adds image tags and prints the result.
+func (c *Client) AddTags(ctx context.Context, filename string, tags []string) error {
+	const fn = "cloudgrpc.AddTags"
+
+	resp, err := c.api.AddTags(ctx, &cloudv1.TagsRequest{Name: filename, Tags: tags})
+	if err != nil {
+		c.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	printMetadata(resp)
+
+	return nil
+}
+
+// RemoveTags removes image tags and prints the result.
+func (c *Client) RemoveTags(ctx context.Context, filename string, tags []string) error {
+	const fn = "cloudgrpc.RemoveTags"
+
+	resp, err := c.api.RemoveTags(ctx, &cloudv1.TagsRequest{Name: filename, Tags: tags})
+	if err != nil {
+		c.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	printMetadata(resp)
+
+	return nil
+}
+
+func printMetadata(meta *cloudv1.ImageMetadata) {
+	fmt.Println("Name | Tags | Metadata")
+	fmt.Printf("%s | %v | %v\n", meta.Name, meta.Tags, meta.Metadata)
+}
+
+// CreateFolder creates folder on cloud.
+func (c *Client) CreateFolder(ctx context.Context, folder string) error {
+	const fn = "cloudgrpc.CreateFolder"
+
+	resp, err := c.api.CreateFolder(ctx, &cloudv1.CreateFolderRequest{Path: folder})
+	if err != nil {
+		c.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	c.log.InfoContext(ctx, "folder created", slog.String("fn", fn), slog.String("folder", resp.Path))
+
+	return nil
+}
+
+// ListFolder prints subfolders and images of the folder.
+func (c *Client) ListFolder(ctx context.Context, folder string, recursive bool) error {
+	const fn = "cloudgrpc.ListFolder"
+
+	resp, err := c.api.ListFolder(ctx, &cloudv1.ListFolderRequest{
+		Path:      folder,
+		Recursive: recursive,
+	})
+	if err != nil {
+		c.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	for _, f := range resp.Folders {
+		fmt.Println(f + "/")
+	}
+	printFiles(resp.Files)
+
+	return nil
+}
+
+// MoveToFolder moves image to the folder.
+func (c *Client) MoveToFolder(ctx context.Context, filename string, folder string) error {
+	const fn = "cloudgrpc.MoveToFolder"
+
+	resp, err := c.api.MoveToFolder(ctx, &cloudv1.MoveToFolderRequest{
+		Name:   filename,
+		Folder: folder,
+	})
+	if err != nil {
+		c.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	c.log.InfoContext(ctx, "image moved", slog.String("fn", fn), slog.String("name", resp.Name))
+
+	return nil
+}
+
+// Delete removes image from cloud.
+func (c *Client) Delete(ctx context.Context, filename string) error {
+	const fn = "cloudgrpc.Delete"
+
+	_, err := c.api.Delete(ctx, &cloudv1.DeleteRequest{
+		Name: filename,
+	})
+	if err != nil {
+		c.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	c.log.InfoContext(ctx, "image deleted", slog.String("fn", fn), slog.String("name", filename))
+
+	return nil
+}
+
+// CreateShareLink prints signed url to download image over http.
+func (c *Client) CreateShareLink(ctx context.Context, filename string, ttl time.Duration, maxDownloads uint32) error {
+	const fn = "cloudgrpc.CreateShareLink"
+
+	resp, err := c.api.CreateShareLink(ctx, &cloudv1.CreateShareLinkRequest{
+		Name:         filename,
+		TtlSeconds:   uint32(ttl.Seconds()),
+		MaxDownloads: maxDownloads,
+	})
+	if err != nil {
+		c.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	fmt.Println(resp.GetUrl())
+	fmt.Println("expires at", resp.GetExpiresAt())
+
+	return nil
+}
+
+// Search prints images matching the query.
+func (c *Client) Search(ctx context.Context, query string, limit uint32) error {
+	const fn = "cloudgrpc.Search"
+
+	resp, err := c.api.Search(ctx, &cloudv1.SearchRequest{
+		Query: query,
+		Limit: limit,
+	})
+	if err != nil {
+		c.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	printFiles(resp.Files)
+
+	return nil
+}
@@ -1,49 +1,424 @@
 package config
 
 import (
+	"encoding/json"
+	"flag"
+	"fmt"
 	"github.com/ilyakaznacheev/cleanenv"
+	"gopkg.in/yaml.v3"
 	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
+const (
+	EnvDev  = "dev"
+	EnvProd = "prod"
+)
+
+// Config is read from yaml file, CLOUD_<SECTION>_<KEY> environment variables override its values,
+// e.g. CLOUD_GRPC_PORT overrides grpc.port. Lists and maps (api keys, formats, tenants) are replaced as a whole
+// by yaml flow values, e.g. CLOUD_AUTH_API_KEYS='[{name: ci, key: secret}]'.
+// Relative paths are resolved against the config file directory.
 type Config struct {
-	Env     string        `yaml:"env" env-required:"true"`
-	GRPC    GRPCConfig    `yaml:"grpc"`
-	Storage StorageConfig `yaml:"storage"`
-	Cloud   CloudConfig   `yaml:"cloud"`
+	// Env is "dev" or "prod", dev enables debug logs.
+	Env     string        `yaml:"env" env:"CLOUD_ENV" env-default:"prod"`
+	Log     LogConfig     `yaml:"log" env-prefix:"CLOUD_LOG_"`
+	GRPC    GRPCConfig    `yaml:"grpc" env-prefix:"CLOUD_GRPC_"`
+	Storage StorageConfig `yaml:"storage" env-prefix:"CLOUD_STORAGE_"`
+	Cloud   CloudConfig   `yaml:"cloud" env-prefix:"CLOUD_CLOUD_"`
+	Auth    AuthConfig    `yaml:"auth" env-prefix:"CLOUD_AUTH_"`
+	Share   ShareConfig   `yaml:"share" env-prefix:"CLOUD_SHARE_"`
+	Audit   AuditConfig   `yaml:"audit" env-prefix:"CLOUD_AUDIT_"`
+	Metrics MetricsConfig `yaml:"metrics" env-prefix:"CLOUD_METRICS_"`
+	Tracing TracingConfig `yaml:"tracing" env-prefix:"CLOUD_TRACING_"`
+	Health  HealthConfig  `yaml:"health" env-prefix:"CLOUD_HEALTH_"`
+	Admin   AdminConfig   `yaml:"admin" env-prefix:"CLOUD_ADMIN_"`
+	Scrub   ScrubConfig   `yaml:"scrub" env-prefix:"CLOUD_SCRUB_"`
+	// Tenants are isolated namespaces in addition to the default one described by Storage and Cloud.
+	Tenants Tenants `yaml:"tenants" env:"CLOUD_TENANTS"`
+	// ReloadInterval is how often the file is checked for changes of cloud policy, 0 - reload on SIGHUP only.
+	ReloadInterval time.Duration `yaml:"reload_interval" env:"CLOUD_RELOAD_INTERVAL"`
+	// Path is the file config is loaded from.
+	Path string `yaml:"-"`
+}
+
+// LogConfig configures server logs.
+type LogConfig struct {
+	// Level is "debug", "info", "warn" or "error", empty - debug in dev env and info otherwise.
+	Level string `yaml:"level" env:"LEVEL"`
+	// Format is "text" or "json".
+	Format string `yaml:"format" env:"FORMAT" env-default:"text"`
+	// Path is file logs are appended to, empty - stdout.
+	Path string `yaml:"path" env:"PATH"`
+	// MaxSize is size in bytes the file is rotated at, 0 - no rotation.
+	MaxSize int64 `yaml:"max_size" env:"MAX_SIZE"`
+	// MaxBackups is number of rotated files kept, 0 - all.
+	MaxBackups int `yaml:"max_backups" env:"MAX_BACKUPS"`
+	// AccessLog enables a log line per call with its duration, bytes and status code.
+	AccessLog bool `yaml:"access_log" env:"ACCESS_LOG"`
 }
 
 type GRPCConfig struct {
-	Port int `yaml:"port"`
+	Port int       `yaml:"port" env:"PORT" env-default:"44044"`
+	TLS  TLSConfig `yaml:"tls" env-prefix:"TLS_"`
+	// DrainTimeout is how long graceful stop waits for calls before transfers are cut off, 0 - no limit.
+	DrainTimeout time.Duration `yaml:"drain_timeout" env:"DRAIN_TIMEOUT"`
+}
+
+type TLSConfig struct {
+	Enabled  bool   `yaml:"enabled" env:"ENABLED"`
+	CertFile string `yaml:"cert_file" env:"CERT_FILE"`
+	KeyFile  string `yaml:"key_file" env:"KEY_FILE"`
+	// ClientCAFile enables mutual TLS, client certificate identity becomes the principal.
+	ClientCAFile      string `yaml:"client_ca_file" env:"CLIENT_CA_FILE"`
+	RequireClientCert bool   `yaml:"require_client_cert" env:"REQUIRE_CLIENT_CERT"`
+	// MinVersion is "1.2" or "1.3".
+	MinVersion string `yaml:"min_version" env:"MIN_VERSION" env-default:"1.2"`
+	// ReloadInterval is how often certificate files are checked for changes.
+	ReloadInterval time.Duration `yaml:"reload_interval" env:"RELOAD_INTERVAL"`
+}
+
+type AuthConfig struct {
+	Enabled bool    `yaml:"enabled" env:"ENABLED"`
+	APIKeys APIKeys `yaml:"api_keys" env:"API_KEYS"`
+	// JWTSecret is HMAC secret of JWT tokens, empty disables JWT.
+	JWTSecret Secret `yaml:"jwt_secret" env:"JWT_SECRET"`
+	JWTIssuer string `yaml:"jwt_issuer" env:"JWT_ISSUER"`
+	// PolicyPath is rbac policy file, relative path is resolved against the config file directory.
+	// Empty path disables rbac.
+	PolicyPath string `yaml:"policy_path" env:"POLICY_PATH"`
+}
+
+type APIKeyConfig struct {
+	Name string `yaml:"name"`
+	Key  Secret `yaml:"key"`
+}
+
+// APIKeys is list of api keys, environment variable sets it as yaml.
+type APIKeys []APIKeyConfig
+
+// SetValue replaces keys with the yaml list, e.g. [{name: ci, key: secret}].
+func (k *APIKeys) SetValue(s string) error {
+	*k = nil
+	return setYAML(s, k)
+}
+
+// Tenants is list of tenants, environment variable sets it as yaml.
+type Tenants []TenantConfig
+
+// SetValue replaces tenants with the yaml list, e.g. [{name: team-a, principals: [ci], storage: {...}}].
+func (t *Tenants) SetValue(s string) error {
+	*t = nil
+	return setYAML(s, t)
+}
+
+// Formats are format policies by extension, environment variable sets them as yaml.
+type Formats map[string]FormatPolicy
+
+// SetValue replaces formats with the yaml map, e.g. {.png: {mime_types: [image/png]}}.
+func (f *Formats) SetValue(s string) error {
+	*f = nil
+	return setYAML(s, f)
+}
+
+// setYAML decodes yaml value of an environment variable.
+func setYAML(s string, out any) error {
+	if err := yaml.Unmarshal([]byte(s), out); err != nil {
+		return fmt.Errorf("invalid yaml value: %w", err)
+	}
+	return nil
+}
+
+// Secret is a string which is never printed, e.g. when config is logged.
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "[REDACTED]"
+}
+
+// MarshalJSON redacts the secret in config logged by JSON handler.
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// LogValue redacts the secret logged as attribute.
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+// MarshalYAML redacts the secret in dumped config.
+func (s Secret) MarshalYAML() (any, error) {
+	return s.String(), nil
+}
+
+// YAML returns config as yaml with secrets redacted.
+func (c *Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+// ShareConfig configures signed share links served over HTTP.
+type ShareConfig struct {
+	Enabled bool `yaml:"enabled" env:"ENABLED"`
+	Port    int  `yaml:"port" env:"PORT" env-default:"44080"`
+	// BaseURL is public address of the share listener links are built with, e.g. https://img.example.com
+	BaseURL string `yaml:"base_url" env:"BASE_URL"`
+	// Secret is HMAC key of links, changing it revokes all links.
+	Secret     Secret        `yaml:"secret" env:"SECRET"`
+	DefaultTTL time.Duration `yaml:"default_ttl" env:"DEFAULT_TTL" env-default:"24h"`
+	// MaxTTL limits requested ttl, 0 - no limit.
+	MaxTTL time.Duration `yaml:"max_ttl" env:"MAX_TTL"`
+	// StatePath is file download counters of links are kept in, empty - in memory, restart resets them.
+	StatePath string `yaml:"state_path" env:"STATE_PATH"`
+}
+
+// AuditConfig configures audit log of transfers and mutating calls.
+type AuditConfig struct {
+	Enabled bool   `yaml:"enabled" env:"ENABLED"`
+	Path    string `yaml:"path" env:"PATH"`
+	// Key is HMAC key of the hash chain, so the log can't be rewritten without it.
+	// Events written with another key don't verify.
+	Key Secret `yaml:"key" env:"KEY"`
+	// MaxSize is size in bytes the file is rotated at, 0 - no rotation. Rotated files are never deleted.
+	MaxSize int64 `yaml:"max_size" env:"MAX_SIZE"`
+}
+
+// MetricsConfig configures Prometheus metrics endpoint served over HTTP at /metrics.
+type MetricsConfig struct {
+	Enabled bool `yaml:"enabled" env:"ENABLED"`
+	Port    int  `yaml:"port" env:"PORT" env-default:"44090"`
+}
+
+// TracingConfig configures OpenTelemetry tracing.
+type TracingConfig struct {
+	Enabled bool `yaml:"enabled" env:"ENABLED"`
+	// Exporter is "otlp" (OTLP over HTTP), "stdout" or "file".
+	Exporter string `yaml:"exporter" env:"EXPORTER" env-default:"otlp"`
+	// Endpoint is OTLP collector URL, e.g. http://localhost:4318, empty - OTEL_EXPORTER_OTLP_ENDPOINT or default.
+	Endpoint string `yaml:"endpoint" env:"ENDPOINT"`
+	// Path is file spans are appended to by "file" exporter.
+	Path string `yaml:"path" env:"PATH"`
+	// SampleRatio is fraction of traces started by the server which are recorded, 0 - none, default 1.
+	// Traces sampled by the client are always recorded.
+	SampleRatio float64 `yaml:"sample_ratio" env:"SAMPLE_RATIO"`
+}
+
+// HealthConfig configures readiness reported by grpc.health.v1.
+type HealthConfig struct {
+	// CheckInterval is how often storage of tenants is checked, 0 - 10s.
+	CheckInterval time.Duration `yaml:"check_interval" env:"CHECK_INTERVAL" env-default:"10s"`
+	// MinFreeSpace is bytes of free disk space below which the server is not ready.
+	MinFreeSpace uint64 `yaml:"min_free_space" env:"MIN_FREE_SPACE"`
+	// ShutdownDelay is how long NOT_SERVING is reported before stopping, so load balancers drain the server.
+	ShutdownDelay time.Duration `yaml:"shutdown_delay" env:"SHUTDOWN_DELAY"`
+}
+
+// AdminConfig configures CloudAdmin service served on a separate port.
+type AdminConfig struct {
+	Enabled bool `yaml:"enabled" env:"ENABLED"`
+	Port    int  `yaml:"port" env:"PORT" env-default:"44045"`
+	// APIKeys are the only credentials the admin service accepts, keys of auth section are rejected.
+	APIKeys APIKeys `yaml:"api_keys" env:"API_KEYS"`
+}
+
+// ScrubConfig configures background integrity checks of stored images, see also "cloud fsck".
+type ScrubConfig struct {
+	Enabled  bool          `yaml:"enabled" env:"ENABLED"`
+	Interval time.Duration `yaml:"interval" env:"INTERVAL" env-default:"24h"`
+	// Repair quarantines corrupt images, removes orphaned tmp and metadata files and saves missing checksums.
+	Repair bool `yaml:"repair" env:"REPAIR"`
+	// TmpAge is age after which tmp files are considered left by interrupted uploads, 24h by default.
+	// 0 - any age, not allowed with Repair.
+	TmpAge time.Duration `yaml:"tmp_age" env:"TMP_AGE"`
+	// ReportPath is file the latest report is written to, empty - the report is only logged.
+	ReportPath string `yaml:"report_path" env:"REPORT_PATH"`
+}
+
+// DefaultTenant is name of the tenant described by top-level Storage and Cloud.
+const DefaultTenant = "default"
+
+// Policies returns cloud policy of every tenant including the default one.
+func (c *Config) Policies() map[string]CloudConfig {
+	res := map[string]CloudConfig{DefaultTenant: c.Cloud}
+	for _, t := range c.Tenants {
+		res[t.Name] = c.Cloud
+		if t.Cloud != nil {
+			res[t.Name] = *t.Cloud
+		}
+	}
+	return res
+}
+
+// AllTenants returns config of every tenant, the default one first.
+func (c *Config) AllTenants() []TenantConfig {
+	return append([]TenantConfig{{
+		Name:    DefaultTenant,
+		Storage: c.Storage,
+		Cloud:   &c.Cloud,
+	}}, c.Tenants...)
+}
+
+type TenantConfig struct {
+	Name string `yaml:"name"`
+	// Principals are authenticated identities mapped to the tenant.
+	Principals []string      `yaml:"principals"`
+	Storage    StorageConfig `yaml:"storage"`
+	// Cloud overrides the top-level policy if set.
+	Cloud *CloudConfig `yaml:"cloud"`
 }
 
 type StorageConfig struct {
-	TmpPath       string `yaml:"tmp_path"`
-	CompletedPath string `yaml:"completed_path"`
+	TmpPath       string `yaml:"tmp_path" env:"TMP_PATH"`
+	CompletedPath string `yaml:"completed_path" env:"COMPLETED_PATH"`
+	MetaPath      string `yaml:"meta_path" env:"META_PATH"`
+	// QuarantinePath is folder corrupt images are moved to by fsck repair, empty - repair is disabled.
+	QuarantinePath string `yaml:"quarantine_path" env:"QUARANTINE_PATH"`
 }
 
 type CloudConfig struct {
-	MaxImageSize int                 `yaml:"max_image_size"`
-	AvailableExt map[string]struct{} `yaml:"available_ext"`
-	LimitUD      int                 `yaml:"limit_ud"`
-	LimitList    int                 `yaml:"limit_list"`
+	MaxImageSize        int             `yaml:"max_image_size" env:"MAX_IMAGE_SIZE" env-default:"20971520"`
+	MaxWidth            int             `yaml:"max_width" env:"MAX_WIDTH"`
+	MaxHeight           int             `yaml:"max_height" env:"MAX_HEIGHT"`
+	MaxPixels           int             `yaml:"max_pixels" env:"MAX_PIXELS"`
+	AvailableExt        Formats         `yaml:"available_ext" env:"AVAILABLE_EXT"`
+	LimitUD             int             `yaml:"limit_ud" env:"LIMIT_UD" env-default:"10"`
+	LimitList           int             `yaml:"limit_list" env:"LIMIT_LIST" env-default:"100"`
+	SimilarityThreshold int             `yaml:"similarity_threshold" env:"SIMILARITY_THRESHOLD" env-default:"10"`
+	RateLimit           RateLimitConfig `yaml:"rate_limit" env-prefix:"RATE_LIMIT_"`
+	// MaxWait is how long a call waits for upload/download or list slot, 0 - while the client waits.
+	MaxWait time.Duration `yaml:"max_wait" env:"MAX_WAIT"`
+	// MaxQueue limits calls waiting for slots of each kind, 0 - no limit.
+	MaxQueue int `yaml:"max_queue" env:"MAX_QUEUE"`
+}
+
+// StoredExts returns extensions images are stored with: accepted ones and targets of transcoding.
+func (c CloudConfig) StoredExts() []string {
+	res := make([]string, 0, len(c.AvailableExt))
+	for ext, policy := range c.AvailableExt {
+		res = append(res, ext)
+		if policy.TranscodeTo != "" {
+			res = append(res, policy.TranscodeTo)
+		}
+	}
+	return res
 }
 
+// RateLimitConfig is per client token bucket limits, zero rate disables the limit.
+type RateLimitConfig struct {
+	// By is how clients are told apart: "principal" (peer ip for anonymous calls) or "ip".
+	By string `yaml:"by" env:"BY" env-default:"principal"`
+	// Requests is calls per second.
+	Requests      float64 `yaml:"requests" env:"REQUESTS"`
+	RequestsBurst int     `yaml:"requests_burst" env:"REQUESTS_BURST"`
+	// Bandwidth is upload and download bytes per second.
+	Bandwidth      int `yaml:"bandwidth" env:"BANDWIDTH"`
+	BandwidthBurst int `yaml:"bandwidth_burst" env:"BANDWIDTH_BURST"`
+}
+
+// FormatPolicy describes how images of one extension are accepted.
+type FormatPolicy struct {
+	// MimeTypes are allowed detected content types, empty list allows any.
+	MimeTypes []string `yaml:"mime_types"`
+	// MaxSize overrides MaxImageSize for the format if set.
+	MaxSize        int  `yaml:"max_size"`
+	AllowAnimation bool `yaml:"allow_animation"`
+	// TranscodeTo is the extension image is converted to on upload, e.g. ".jpg".
+	TranscodeTo string `yaml:"transcode_to"`
+}
+
+// MustLoad loads config from file set by -config flag or CONFIG_PATH and exits if it's invalid.
 func MustLoad() *Config {
-	configPath := os.Getenv("CONFIG_PATH")
+	configPath := fetchConfigPath()
 	if configPath == "" {
-		log.Fatal("CONFIG_PATH is not set")
+		log.Fatal("config path is not set, use -config flag or CONFIG_PATH")
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return cfg
+}
+
+// fetchConfigPath returns path from -config flag or CONFIG_PATH environment variable.
+func fetchConfigPath() string {
+	var res string
+
+	flag.StringVar(&res, "config", "", "path to config file")
+	flag.Parse()
+
+	if res == "" {
+		res = os.Getenv("CONFIG_PATH")
 	}
+	return res
+}
+
+// Load reads config file, applies environment overrides and defaults, resolves relative paths
+// and validates the result.
+func Load(configPath string) (*Config, error) {
+	const fn = "config.Load"
 
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		log.Fatalf("config file does not exist: %s", configPath)
+	if _, err := os.Stat(configPath); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
 	}
 
-	var cfg Config
+	// env-default can't tell explicit zero from unset value, such defaults are set before reading
+	cfg := Config{
+		Tracing: TracingConfig{SampleRatio: 1},
+		Scrub:   ScrubConfig{TmpAge: 24 * time.Hour},
+	}
 
 	if err := cleanenv.ReadConfig(configPath, &cfg); err != nil {
-		log.Fatalf("cannot read config: %s", err)
+		return nil, fmt.Errorf("%s: cannot read config: %w", fn, err)
+	}
+
+	cfg.Path = configPath
+	cfg.resolvePaths(filepath.Dir(configPath))
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	return &cfg, nil
+}
+
+// resolvePaths makes relative paths absolute against dir and ends storage folders with separator.
+func (c *Config) resolvePaths(dir string) {
+	resolve := func(path *string) {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
 	}
 
-	return &cfg
+	resolve(&c.GRPC.TLS.CertFile)
+	resolve(&c.GRPC.TLS.KeyFile)
+	resolve(&c.GRPC.TLS.ClientCAFile)
+	resolve(&c.Auth.PolicyPath)
+	resolve(&c.Audit.Path)
+	resolve(&c.Share.StatePath)
+	resolve(&c.Tracing.Path)
+	resolve(&c.Log.Path)
+	resolve(&c.Scrub.ReportPath)
+
+	storages := []*StorageConfig{&c.Storage}
+	for i := range c.Tenants {
+		storages = append(storages, &c.Tenants[i].Storage)
+	}
+	for _, s := range storages {
+		for _, path := range []*string{&s.TmpPath, &s.CompletedPath, &s.MetaPath, &s.QuarantinePath} {
+			if *path == "" {
+				continue
+			}
+			resolve(path)
+			// files are addressed as folder + name
+			if !strings.HasSuffix(*path, string(filepath.Separator)) {
+				*path += string(filepath.Separator)
+			}
+		}
+	}
 }
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeDevConfig writes config/dev.yaml with old substrings replaced by new ones to a temp dir.
+func writeDevConfig(t *testing.T, replace ...string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("..", "..", "config", "dev.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(data)
+	for i := 0; i < len(replace); i += 2 {
+		if !strings.Contains(content, replace[i]) {
+			t.Fatalf("dev config has no %q", replace[i])
+		}
+		content = strings.Replace(content, replace[i], replace[i+1], 1)
+	}
+
+	path := filepath.Join(t.TempDir(), "config", "dev.yaml")
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadSampleRatio(t *testing.T) {
+	const line = "  sample_ratio: 1 # fraction of traces started by the server, 0 - none\n"
+
+	tests := []struct {
+		name    string
+		replace string
+		env     string
+		want    float64
+	}{
+		{name: "set", replace: "  sample_ratio: 0.5\n", want: 0.5},
+		{name: "zero samples nothing", replace: "  sample_ratio: 0\n", want: 0},
+		{name: "unset samples all", replace: "", want: 1},
+		{name: "env zero", replace: "", env: "0", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				t.Setenv("CLOUD_TRACING_SAMPLE_RATIO", tt.env)
+			}
+
+			cfg, err := Load(writeDevConfig(t, line, tt.replace))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Tracing.SampleRatio != tt.want {
+				t.Fatalf("SampleRatio = %g, want %g", cfg.Tracing.SampleRatio, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadScrubTmpAge(t *testing.T) {
+	const (
+		repairLine = "  repair: false # quarantine corrupt images, remove orphaned tmp and metadata files, save missing checksums\n"
+		ageLine    = "  tmp_age: 24h # tmp files older than this are left by interrupted uploads, must be positive with repair\n"
+	)
+
+	tests := []struct {
+		name    string
+		repair  string
+		age     string
+		want    time.Duration
+		wantErr string
+	}{
+		{name: "unset", age: "", want: 24 * time.Hour},
+		{name: "zero without repair", age: "  tmp_age: 0s\n", want: 0},
+		{name: "repair", repair: "  repair: true\n", age: "  tmp_age: 1h\n", want: time.Hour},
+		{name: "repair unset", repair: "  repair: true\n", age: "", want: 24 * time.Hour},
+		{name: "zero with repair", repair: "  repair: true\n", age: "  tmp_age: 0s\n",
+			wantErr: "scrub.tmp_age: must be positive with scrub.repair"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replace := []string{ageLine, tt.age}
+			if tt.repair != "" {
+				replace = append(replace, repairLine, tt.repair)
+			}
+
+			cfg, err := Load(writeDevConfig(t, replace...))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Scrub.TmpAge != tt.want {
+				t.Fatalf("TmpAge = %s, want %s", cfg.Scrub.TmpAge, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadEnvOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		check   func(cfg *Config) bool
+		wantErr bool
+	}{
+		{name: "api keys", env: map[string]string{"CLOUD_AUTH_API_KEYS": "[{name: ci, key: ci-key}]"},
+			check: func(cfg *Config) bool {
+				return reflect.DeepEqual(cfg.Auth.APIKeys, APIKeys{{Name: "ci", Key: "ci-key"}})
+			}},
+		{name: "admin api keys", env: map[string]string{"CLOUD_ADMIN_API_KEYS": "[{name: ops, key: k1}, {name: ops2, key: k2}]"},
+			check: func(cfg *Config) bool {
+				return len(cfg.Admin.APIKeys) == 2 && cfg.Admin.APIKeys[1].Key == "k2"
+			}},
+		{name: "formats replace the file ones", env: map[string]string{
+			"CLOUD_CLOUD_AVAILABLE_EXT": "{.png: {mime_types: [image/png], max_size: 1024}}"},
+			check: func(cfg *Config) bool {
+				return reflect.DeepEqual(cfg.Cloud.AvailableExt,
+					Formats{".png": {MimeTypes: []string{"image/png"}, MaxSize: 1024}})
+			}},
+		{name: "tenants", env: map[string]string{"CLOUD_TENANTS": "[{name: team-a, principals: [dev], " +
+			"storage: {tmp_path: a/tmp, completed_path: a/completed, meta_path: a/meta}}]"},
+			check: func(cfg *Config) bool {
+				return len(cfg.Tenants) == 1 && cfg.Tenants[0].Name == "team-a" &&
+					filepath.IsAbs(cfg.Tenants[0].Storage.CompletedPath)
+			}},
+		{name: "invalid yaml", env: map[string]string{"CLOUD_AUTH_API_KEYS": "[{name: ci"}, wantErr: true},
+		{name: "invalid tenant", env: map[string]string{"CLOUD_TENANTS": "[{name: default}]"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			cfg, err := Load(writeDevConfig(t))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !tt.check(cfg) {
+				t.Fatalf("Load() didn't apply %v", tt.env)
+			}
+		})
+	}
+}
+
+func TestValidateSharedStorage(t *testing.T) {
+	storage := func(root string) StorageConfig {
+		return StorageConfig{
+			TmpPath:        root + "/tmp/",
+			CompletedPath:  root + "/completed/",
+			MetaPath:       root + "/meta/",
+			QuarantinePath: root + "/quarantine/",
+		}
+	}
+
+	tests := []struct {
+		name   string
+		tenant StorageConfig
+		want   []string
+	}{
+		{name: "separate", tenant: storage("/data/team-a")},
+		{name: "similar names", tenant: StorageConfig{TmpPath: "/data/default/tmp2/",
+			CompletedPath: "/data/default/completed2/", MetaPath: "/data/default/meta2"}},
+		{name: "same folders", tenant: storage("/data/default"), want: []string{
+			"storage.completed_path: overlaps tenants[team-a].storage.completed_path of another tenant",
+			"storage.meta_path: overlaps tenants[team-a].storage.meta_path of another tenant",
+			"storage.quarantine_path: overlaps tenants[team-a].storage.quarantine_path of another tenant",
+			"storage.tmp_path: overlaps tenants[team-a].storage.tmp_path of another tenant",
+		}},
+		{name: "nested", tenant: StorageConfig{TmpPath: "/data/team-a/tmp/",
+			CompletedPath: "/data/default/completed/team-a/", MetaPath: "/data/team-a/meta/"}, want: []string{
+			"storage.completed_path: overlaps tenants[team-a].storage.completed_path of another tenant",
+		}},
+		{name: "parent", tenant: StorageConfig{TmpPath: "/data/team-a/tmp/", CompletedPath: "/data",
+			MetaPath: "/data/team-a/meta/"}, want: []string{
+			"storage.completed_path: overlaps tenants[team-a].storage.completed_path of another tenant",
+			"storage.meta_path: overlaps tenants[team-a].storage.completed_path of another tenant",
+			"storage.quarantine_path: overlaps tenants[team-a].storage.completed_path of another tenant",
+			"storage.tmp_path: overlaps tenants[team-a].storage.completed_path of another tenant",
+		}},
+		{name: "other kind of folder", tenant: StorageConfig{TmpPath: "/data/default/meta/",
+			CompletedPath: "/data/team-a/completed/", MetaPath: "/data/team-a/meta/"}, want: []string{
+			"storage.meta_path: overlaps tenants[team-a].storage.tmp_path of another tenant",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Storage: storage("/data/default"),
+				Tenants: Tenants{{Name: "team-a", Storage: tt.tenant}},
+			}
+
+			var p problems
+			cfg.validateSharedStorage(&p)
+			if len(p) != len(tt.want) || len(p) > 0 && !reflect.DeepEqual([]string(p), tt.want) {
+				t.Fatalf("problems = %q, want %q", p, tt.want)
+			}
+		})
+	}
+}
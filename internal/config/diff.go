@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Diff returns changes from a to b of the same type as "path: old -> new", paths are made of yaml keys.
+// Secrets are compared but never printed.
+func Diff(a, b any) []string {
+	var res []string
+	diff(&res, "", reflect.ValueOf(a), reflect.ValueOf(b))
+	return res
+}
+
+func diff(res *[]string, path string, a, b reflect.Value) {
+	switch a.Kind() {
+	case reflect.Pointer:
+		switch {
+		case a.IsNil() && b.IsNil():
+		case a.IsNil():
+			*res = append(*res, path+": added")
+		case b.IsNil():
+			*res = append(*res, path+": removed")
+		default:
+			diff(res, path, a.Elem(), b.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			f := a.Type().Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(f.Name)
+			}
+			diff(res, joinPath(path, name), a.Field(i), b.Field(i))
+		}
+	case reflect.Map:
+		keys := make(map[string]reflect.Value)
+		for _, k := range append(a.MapKeys(), b.MapKeys()...) {
+			keys[fmt.Sprint(k.Interface())] = k
+		}
+		names := make([]string, 0, len(keys))
+		for name := range keys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			key := fmt.Sprintf("%s[%s]", path, name)
+			av, bv := a.MapIndex(keys[name]), b.MapIndex(keys[name])
+			switch {
+			case !av.IsValid():
+				*res = append(*res, key+": added")
+			case !bv.IsValid():
+				*res = append(*res, key+": removed")
+			default:
+				diff(res, key, av, bv)
+			}
+		}
+	case reflect.Slice:
+		// lists of sections are compared by index, lists of values as a whole
+		if a.Type().Elem().Kind() != reflect.Struct {
+			if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+				*res = append(*res, fmt.Sprintf("%s: %v -> %v", path, a.Interface(), b.Interface()))
+			}
+			return
+		}
+		for i := 0; i < max(a.Len(), b.Len()); i++ {
+			key := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= a.Len():
+				*res = append(*res, key+": added")
+			case i >= b.Len():
+				*res = append(*res, key+": removed")
+			default:
+				diff(res, key, a.Index(i), b.Index(i))
+			}
+		}
+	default:
+		if !a.Equal(b) {
+			*res = append(*res, fmt.Sprintf("%s: %s -> %s", path, formatValue(a), formatValue(b)))
+		}
+	}
+}
+
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func formatValue(v reflect.Value) string {
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+	if v.Kind() == reflect.String {
+		return strconv.Quote(v.String())
+	}
+	return fmt.Sprint(v.Interface())
+}
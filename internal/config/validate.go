@@ -0,0 +1,399 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ValidationError lists every invalid value of config.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid config:")
+	for _, p := range e.Problems {
+		b.WriteString("\n  - ")
+		b.WriteString(p)
+	}
+	return b.String()
+}
+
+// problems collects invalid values by yaml path.
+type problems []string
+
+func (p *problems) add(field string, format string, args ...any) {
+	*p = append(*p, field+": "+fmt.Sprintf(format, args...))
+}
+
+func (p *problems) port(field string, port int) {
+	if port < 1 || port > 65535 {
+		p.add(field, "must be 1-65535, got %d", port)
+	}
+}
+
+func (p *problems) required(field string, value string) {
+	if value == "" {
+		p.add(field, "is required")
+	}
+}
+
+func (p *problems) nonNegative(field string, value int64) {
+	if value < 0 {
+		p.add(field, "must not be negative, got %d", value)
+	}
+}
+
+func (p *problems) nonNegativeDuration(field string, value time.Duration) {
+	if value < 0 {
+		p.add(field, "must not be negative, got %s", value)
+	}
+}
+
+// Validate checks config and returns *ValidationError with all problems found.
+func (c *Config) Validate() error {
+	var p problems
+
+	if c.Env != EnvDev && c.Env != EnvProd {
+		p.add("env", "must be %q or %q, got %q", EnvDev, EnvProd, c.Env)
+	}
+
+	c.validateLog(&p)
+	c.validateGRPC(&p)
+	c.validateAuth(&p)
+	c.validateShare(&p)
+
+	if c.Audit.Enabled {
+		p.required("audit.path", c.Audit.Path)
+		p.required("audit.key", string(c.Audit.Key))
+	}
+	p.nonNegative("audit.max_size", c.Audit.MaxSize)
+
+	if c.Metrics.Enabled {
+		p.port("metrics.port", c.Metrics.Port)
+	}
+
+	c.validateTracing(&p)
+	c.validateAdmin(&p)
+	c.validateScrub(&p)
+
+	p.nonNegativeDuration("reload_interval", c.ReloadInterval)
+	p.nonNegativeDuration("health.check_interval", c.Health.CheckInterval)
+	p.nonNegativeDuration("health.shutdown_delay", c.Health.ShutdownDelay)
+
+	validateStorage(&p, "storage", c.Storage)
+	validateCloud(&p, "cloud", c.Cloud)
+	c.validateTenants(&p)
+	c.validateListeners(&p)
+
+	if len(p) > 0 {
+		return &ValidationError{Problems: p}
+	}
+	return nil
+}
+
+func (c *Config) validateLog(p *problems) {
+	switch strings.ToLower(c.Log.Level) {
+	case "", "debug", "info", "warn", "error":
+	default:
+		p.add("log.level", `must be "debug", "info", "warn" or "error", got %q`, c.Log.Level)
+	}
+	switch strings.ToLower(c.Log.Format) {
+	case "text", "json":
+	default:
+		p.add("log.format", `must be "text" or "json", got %q`, c.Log.Format)
+	}
+	p.nonNegative("log.max_size", c.Log.MaxSize)
+	p.nonNegative("log.max_backups", int64(c.Log.MaxBackups))
+}
+
+func (c *Config) validateGRPC(p *problems) {
+	p.port("grpc.port", c.GRPC.Port)
+	p.nonNegativeDuration("grpc.drain_timeout", c.GRPC.DrainTimeout)
+
+	tls := c.GRPC.TLS
+	if tls.Enabled {
+		p.required("grpc.tls.cert_file", tls.CertFile)
+		p.required("grpc.tls.key_file", tls.KeyFile)
+		if tls.RequireClientCert && tls.ClientCAFile == "" {
+			p.add("grpc.tls.require_client_cert", "requires client_ca_file")
+		}
+	}
+	if tls.MinVersion != "1.2" && tls.MinVersion != "1.3" {
+		p.add("grpc.tls.min_version", `must be "1.2" or "1.3", got %q`, tls.MinVersion)
+	}
+	p.nonNegativeDuration("grpc.tls.reload_interval", tls.ReloadInterval)
+}
+
+func (c *Config) validateAuth(p *problems) {
+	if c.Auth.Enabled && len(c.Auth.APIKeys) == 0 && c.Auth.JWTSecret == "" {
+		p.add("auth", "enabled auth requires api_keys or jwt_secret")
+	}
+
+	names := make(map[string]struct{}, len(c.Auth.APIKeys))
+	for i, k := range c.Auth.APIKeys {
+		field := fmt.Sprintf("auth.api_keys[%d]", i)
+		p.required(field+".name", k.Name)
+		p.required(field+".key", string(k.Key))
+		if _, ok := names[k.Name]; ok && k.Name != "" {
+			p.add(field+".name", "duplicate name %q", k.Name)
+		}
+		names[k.Name] = struct{}{}
+	}
+}
+
+func (c *Config) validateShare(p *problems) {
+	if !c.Share.Enabled {
+		return
+	}
+
+	p.port("share.port", c.Share.Port)
+	p.required("share.secret", string(c.Share.Secret))
+	if u, err := url.Parse(c.Share.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		p.add("share.base_url", "must be absolute url, got %q", c.Share.BaseURL)
+	}
+	if c.Share.DefaultTTL <= 0 {
+		p.add("share.default_ttl", "must be positive, got %s", c.Share.DefaultTTL)
+	}
+	p.nonNegativeDuration("share.max_ttl", c.Share.MaxTTL)
+	if c.Share.MaxTTL > 0 && c.Share.MaxTTL < c.Share.DefaultTTL {
+		p.add("share.max_ttl", "must not be less than default_ttl %s", c.Share.DefaultTTL)
+	}
+}
+
+func (c *Config) validateTracing(p *problems) {
+	t := c.Tracing
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		p.add("tracing.sample_ratio", "must be 0-1, got %g", t.SampleRatio)
+	}
+	if !t.Enabled {
+		return
+	}
+
+	switch t.Exporter {
+	case "otlp":
+		if t.Endpoint != "" {
+			if u, err := url.Parse(t.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+				p.add("tracing.endpoint", "must be absolute url, got %q", t.Endpoint)
+			}
+		}
+	case "stdout":
+	case "file":
+		p.required("tracing.path", t.Path)
+	default:
+		p.add("tracing.exporter", `must be "otlp", "stdout" or "file", got %q`, t.Exporter)
+	}
+}
+
+func (c *Config) validateAdmin(p *problems) {
+	if !c.Admin.Enabled {
+		return
+	}
+
+	p.port("admin.port", c.Admin.Port)
+	if len(c.Admin.APIKeys) == 0 {
+		p.add("admin.api_keys", "enabled admin service requires api keys")
+	}
+	for i, k := range c.Admin.APIKeys {
+		field := fmt.Sprintf("admin.api_keys[%d]", i)
+		p.required(field+".name", k.Name)
+		p.required(field+".key", string(k.Key))
+	}
+}
+
+func (c *Config) validateScrub(p *problems) {
+	if !c.Scrub.Enabled {
+		return
+	}
+
+	if c.Scrub.Interval <= 0 {
+		p.add("scrub.interval", "must be positive, got %s", c.Scrub.Interval)
+	}
+	p.nonNegativeDuration("scrub.tmp_age", c.Scrub.TmpAge)
+	if !c.Scrub.Repair {
+		return
+	}
+	// 0 removes tmp files of uploads in progress
+	if c.Scrub.TmpAge == 0 {
+		p.add("scrub.tmp_age", "must be positive with scrub.repair")
+	}
+	// corrupt images are moved to quarantine on repair
+	if c.Storage.QuarantinePath == "" {
+		p.add("storage.quarantine_path", "is required with scrub.repair")
+	}
+	for _, t := range c.Tenants {
+		if t.Storage.QuarantinePath == "" {
+			p.add(fmt.Sprintf("tenants[%s].storage.quarantine_path", t.Name), "is required with scrub.repair")
+		}
+	}
+}
+
+func (c *Config) validateTenants(p *problems) {
+	names := map[string]struct{}{DefaultTenant: {}}
+	for i, t := range c.Tenants {
+		field := fmt.Sprintf("tenants[%d]", i)
+		if t.Name != "" {
+			field = fmt.Sprintf("tenants[%s]", t.Name)
+		}
+
+		if _, ok := names[t.Name]; ok || t.Name == "" {
+			p.add(field+".name", "must be unique and not %q, got %q", DefaultTenant, t.Name)
+		}
+		names[t.Name] = struct{}{}
+
+		validateStorage(p, field+".storage", t.Storage)
+		if t.Cloud != nil {
+			validateCloud(p, field+".cloud", *t.Cloud)
+		}
+	}
+	c.validateSharedStorage(p)
+}
+
+// validateSharedStorage checks folders of different tenants don't overlap: tenants would list,
+// scrub and quarantine images of each other otherwise.
+func (c *Config) validateSharedStorage(p *problems) {
+	type folder struct {
+		tenant string
+		field  string
+		path   string
+	}
+	var folders []folder
+	for _, t := range c.AllTenants() {
+		field := "storage"
+		if t.Name != DefaultTenant {
+			field = fmt.Sprintf("tenants[%s].storage", t.Name)
+		}
+		for name, path := range map[string]string{
+			"tmp_path":        t.Storage.TmpPath,
+			"completed_path":  t.Storage.CompletedPath,
+			"meta_path":       t.Storage.MetaPath,
+			"quarantine_path": t.Storage.QuarantinePath,
+		} {
+			if path != "" {
+				folders = append(folders, folder{tenant: t.Name, field: field + "." + name, path: dirPath(path)})
+			}
+		}
+	}
+	sort.Slice(folders, func(i, j int) bool {
+		return folders[i].field < folders[j].field
+	})
+
+	for i, a := range folders {
+		for _, b := range folders[i+1:] {
+			if a.tenant != b.tenant && (strings.HasPrefix(a.path, b.path) || strings.HasPrefix(b.path, a.path)) {
+				p.add(a.field, "overlaps %s of another tenant", b.field)
+			}
+		}
+	}
+}
+
+// dirPath returns cleaned path ending with separator, so prefix means nested folder.
+func dirPath(path string) string {
+	return strings.TrimSuffix(filepath.Clean(path), string(filepath.Separator)) + string(filepath.Separator)
+}
+
+// validateListeners checks enabled listeners don't share a port.
+func (c *Config) validateListeners(p *problems) {
+	ports := map[int]string{c.GRPC.Port: "grpc.port"}
+	check := func(field string, port int) {
+		if other, ok := ports[port]; ok {
+			p.add(field, "port %d is already used by %s", port, other)
+			return
+		}
+		ports[port] = field
+	}
+
+	if c.Share.Enabled {
+		check("share.port", c.Share.Port)
+	}
+	if c.Metrics.Enabled {
+		check("metrics.port", c.Metrics.Port)
+	}
+	if c.Admin.Enabled {
+		check("admin.port", c.Admin.Port)
+	}
+}
+
+func validateStorage(p *problems, field string, s StorageConfig) {
+	p.required(field+".tmp_path", s.TmpPath)
+	p.required(field+".completed_path", s.CompletedPath)
+	p.required(field+".meta_path", s.MetaPath)
+
+	// uploads are moved from tmp to completed, meta files are listed as images otherwise
+	if s.TmpPath != "" && (s.TmpPath == s.CompletedPath || s.TmpPath == s.MetaPath) ||
+		s.CompletedPath != "" && s.CompletedPath == s.MetaPath {
+		p.add(field, "tmp_path, completed_path and meta_path must be different folders")
+	}
+	// quarantined images must not be served
+	if q := s.QuarantinePath; q != "" && (q == s.TmpPath || q == s.MetaPath ||
+		s.CompletedPath != "" && strings.HasPrefix(q, s.CompletedPath)) {
+		p.add(field+".quarantine_path", "must differ from tmp_path and meta_path and be outside completed_path")
+	}
+}
+
+func validateCloud(p *problems, field string, c CloudConfig) {
+	if c.MaxImageSize <= 0 {
+		p.add(field+".max_image_size", "must be positive, got %d", c.MaxImageSize)
+	}
+	p.nonNegative(field+".max_width", int64(c.MaxWidth))
+	p.nonNegative(field+".max_height", int64(c.MaxHeight))
+	p.nonNegative(field+".max_pixels", int64(c.MaxPixels))
+
+	if len(c.AvailableExt) == 0 {
+		p.add(field+".available_ext", "at least one format is required")
+	}
+	exts := make([]string, 0, len(c.AvailableExt))
+	for ext := range c.AvailableExt {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	for _, ext := range exts {
+		policy := c.AvailableExt[ext]
+		extField := fmt.Sprintf("%s.available_ext[%s]", field, ext)
+		if !isExt(ext) {
+			p.add(extField, "extension must start with a dot, e.g. \".jpg\"")
+		}
+		p.nonNegative(extField+".max_size", int64(policy.MaxSize))
+		for _, mime := range policy.MimeTypes {
+			if !strings.Contains(mime, "/") {
+				p.add(extField+".mime_types", "invalid mime type %q", mime)
+			}
+		}
+		if policy.TranscodeTo != "" && !isExt(policy.TranscodeTo) {
+			p.add(extField+".transcode_to", "extension must start with a dot, e.g. \".jpg\"")
+		}
+	}
+
+	if c.LimitUD <= 0 {
+		p.add(field+".limit_ud", "must be positive, got %d", c.LimitUD)
+	}
+	if c.LimitList <= 0 {
+		p.add(field+".limit_list", "must be positive, got %d", c.LimitList)
+	}
+	// perceptual hash is 64 bits
+	if c.SimilarityThreshold < 0 || c.SimilarityThreshold > 64 {
+		p.add(field+".similarity_threshold", "must be 0-64, got %d", c.SimilarityThreshold)
+	}
+	p.nonNegativeDuration(field+".max_wait", c.MaxWait)
+	p.nonNegative(field+".max_queue", int64(c.MaxQueue))
+
+	r := c.RateLimit
+	if r.By != "" && r.By != "principal" && r.By != "ip" {
+		p.add(field+".rate_limit.by", `must be "principal" or "ip", got %q`, r.By)
+	}
+	if r.Requests < 0 {
+		p.add(field+".rate_limit.requests", "must not be negative, got %g", r.Requests)
+	}
+	p.nonNegative(field+".rate_limit.requests_burst", int64(r.RequestsBurst))
+	p.nonNegative(field+".rate_limit.bandwidth", int64(r.Bandwidth))
+	p.nonNegative(field+".rate_limit.bandwidth_burst", int64(r.BandwidthBurst))
+}
+
+func isExt(ext string) bool {
+	return len(ext) > 1 && strings.HasPrefix(ext, ".") && !strings.ContainsAny(ext[1:], "./")
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Watch checks modification time of the file every interval and calls onChange when it changes
+// until ctx is done.
+func Watch(ctx context.Context, log *slog.Logger, path string, interval time.Duration, onChange func()) {
+	const fn = "config.Watch"
+
+	var modTime time.Time
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Error(err.Error(), slog.String("fn", fn))
+			continue
+		}
+		if info.ModTime().Equal(modTime) {
+			continue
+		}
+		modTime = info.ModTime()
+		onChange()
+	}
+}
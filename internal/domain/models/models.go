@@ -0,0 +1,26 @@
+package models
+
+// UploadOptions are client options of a single upload.
+type UploadOptions struct {
+	RejectSimilar       bool
+	SimilarityThreshold int
+	// MIME is detected content type.
+	MIME string
+	// TranscodeTo is the extension image is converted to before saving.
+	TranscodeTo string
+	Tags        []string
+	Metadata    map[string]string
+}
+
+// Similar is an image found by perceptual hash.
+type Similar struct {
+	Name     string
+	Distance int
+}
+
+// StorageStats describes stored images.
+type StorageStats struct {
+	Images   int
+	Bytes    int64
+	TmpFiles int
+}
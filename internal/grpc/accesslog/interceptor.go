@@ -0,0 +1,149 @@
+package accesslog
+
+import (
+	"cloud/internal/logging"
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// RequestIDHeader is request and response metadata key of request id.
+const RequestIDHeader = "x-request-id"
+
+// maxRequestIDLen bounds request id accepted from clients.
+const maxRequestIDLen = 128
+
+// healthPrefix is prefix of health check methods, which are logged at debug level.
+const healthPrefix = "/grpc.health.v1.Health/"
+
+// UnaryServerInterceptor puts request id of the call into its context and, if enabled, logs the call.
+// It must run before interceptors which log.
+func UnaryServerInterceptor(log *slog.Logger, enabled bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		ctx = withRequestID(ctx)
+
+		resp, err := handler(ctx, req)
+
+		if enabled {
+			write(ctx, log, info.FullMethod, start, size(req), size(resp), err)
+		}
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor puts request id of the call into its context and, if enabled, logs the call.
+// It must run before interceptors which log.
+func StreamServerInterceptor(log *slog.Logger, enabled bool) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		stream := &serverStream{ServerStream: ss, ctx: withRequestID(ss.Context())}
+
+		err := handler(srv, stream)
+
+		if enabled {
+			write(stream.ctx, log, info.FullMethod, start, stream.bytesIn.Load(), stream.bytesOut.Load(), err)
+		}
+		return err
+	}
+}
+
+// withRequestID takes request id sent by the client or generates one and returns it in response header.
+func withRequestID(ctx context.Context) context.Context {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(RequestIDHeader); len(v) > 0 && validRequestID(v[0]) {
+			id = v[0]
+		}
+	}
+	if id == "" {
+		id = logging.NewRequestID()
+	}
+
+	_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, id))
+	return logging.WithRequestID(ctx, id)
+}
+
+// validRequestID accepts ids which are safe to log: letters, digits and "-_.:".
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.:", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func write(ctx context.Context, log *slog.Logger, method string, start time.Time, bytesIn, bytesOut int64, err error) {
+	code := status.Code(err)
+
+	level := slog.LevelInfo
+	switch {
+	case code == codes.Internal || code == codes.Unknown || code == codes.DataLoss:
+		level = slog.LevelError
+	case strings.HasPrefix(method, healthPrefix):
+		level = slog.LevelDebug
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.String("code", code.String()),
+		slog.Int64("duration_ms", time.Since(start).Milliseconds()),
+		slog.Int64("bytes_in", bytesIn),
+		slog.Int64("bytes_out", bytesOut),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		attrs = append(attrs, slog.String("peer", p.Addr.String()))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", status.Convert(err).Message()))
+	}
+
+	log.LogAttrs(ctx, level, "access", attrs...)
+}
+
+func size(msg any) int64 {
+	if m, ok := msg.(proto.Message); ok {
+		return int64(proto.Size(m))
+	}
+	return 0
+}
+
+// serverStream carries context with request id and counts message bytes of the wrapped stream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.bytesIn.Add(size(m))
+	}
+	return err
+}
+
+func (s *serverStream) SendMsg(m any) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.bytesOut.Add(size(m))
+	}
+	return err
+}
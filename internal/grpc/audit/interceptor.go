@@ -0,0 +1,202 @@
+package audit
+
+import (
+	auditlog "cloud/internal/audit"
+	"cloud/internal/grpc/auth"
+	"cloud/internal/grpc/tenancy"
+	"cloud/pkg/cloudv1"
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"log/slog"
+	"path"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// auditedMethods are transfers, listing and all mutating RPCs, of CloudAdmin too.
+var auditedMethods = map[string]struct{}{
+	"Upload":          {},
+	"Download":        {},
+	"List":            {},
+	"SetMetadata":     {},
+	"AddTags":         {},
+	"RemoveTags":      {},
+	"CreateFolder":    {},
+	"MoveToFolder":    {},
+	"Delete":          {},
+	"CreateShareLink": {},
+	"CancelTransfer":  {},
+	"SetReadOnly":     {},
+	"GetConfig":       {},
+	"CleanTmp":        {},
+	"Reindex":         {},
+}
+
+// Writer stores audit events.
+type Writer interface {
+	Write(e auditlog.Event) error
+}
+
+// record collects event fields while the call is handled.
+type record struct {
+	target   atomic.Value
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+	// principal and tenant return caller attached by interceptors running after audit.
+	principal func() (auth.Principal, bool)
+	tenant    func() (string, bool)
+}
+
+// newRecord returns context tracking the caller and record of the call.
+func newRecord(ctx context.Context) (context.Context, *record) {
+	rec := &record{}
+	ctx, rec.principal = auth.Track(ctx)
+	ctx, rec.tenant = tenancy.Track(ctx)
+	return ctx, rec
+}
+
+// UnaryServerInterceptor records audited unary calls. It must run before auth and tenancy interceptors,
+// so calls they reject are recorded with the principal and tenant resolved by then.
+func UnaryServerInterceptor(w Writer, log *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		op := path.Base(info.FullMethod)
+		if _, ok := auditedMethods[op]; !ok {
+			return handler(ctx, req)
+		}
+
+		start := time.Now()
+		ctx, rec := newRecord(ctx)
+		rec.observe(req, &rec.bytesIn)
+
+		resp, err := handler(ctx, req)
+		if err == nil {
+			rec.observe(resp, &rec.bytesOut)
+		}
+
+		write(ctx, w, log, op, start, rec, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor records audited streaming calls. It must run before auth and tenancy interceptors,
+// so calls they reject are recorded with the principal and tenant resolved by then.
+func StreamServerInterceptor(w Writer, log *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		op := path.Base(info.FullMethod)
+		if _, ok := auditedMethods[op]; !ok {
+			return handler(srv, ss)
+		}
+
+		start := time.Now()
+		ctx, rec := newRecord(ss.Context())
+
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx, rec: rec})
+
+		write(ss.Context(), w, log, op, start, rec, err)
+		return err
+	}
+}
+
+func write(ctx context.Context, w Writer, log *slog.Logger, op string, start time.Time, rec *record, err error) {
+	const fn = "audit.write"
+
+	e := auditlog.Event{
+		Time:       start,
+		Operation:  op,
+		Result:     status.Code(err).String(),
+		BytesIn:    rec.bytesIn.Load(),
+		BytesOut:   rec.bytesOut.Load(),
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		e.Error = status.Convert(err).Message()
+	}
+	if target, ok := rec.target.Load().(string); ok {
+		e.Target = target
+	}
+	if p, ok := rec.principal(); ok {
+		e.Principal = p.Name
+		e.AuthMethod = p.Method
+	}
+	if tenant, ok := rec.tenant(); ok {
+		e.Tenant = tenant
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		e.Peer = p.Addr.String()
+	}
+
+	if err := w.Write(e); err != nil {
+		log.ErrorContext(ctx, err.Error(), slog.String("fn", fn), slog.String("operation", op))
+	}
+}
+
+// observe counts message size and remembers the image or folder it refers to.
+// Response name replaces request one, e.g. when uploaded image was renamed.
+func (r *record) observe(msg any, bytes *atomic.Int64) {
+	if m, ok := msg.(proto.Message); ok {
+		bytes.Add(int64(proto.Size(m)))
+	}
+
+	if m, ok := msg.(interface{ GetInfo() *cloudv1.UploadInfo }); ok && m.GetInfo() != nil {
+		msg = m.GetInfo()
+	}
+	for _, target := range targets(msg) {
+		if target != "" {
+			r.target.Store(target)
+			return
+		}
+	}
+}
+
+// targets returns names of image or folder from request or response message,
+// tenant or transfer id for admin calls.
+func targets(msg any) []string {
+	var res []string
+	if m, ok := msg.(interface{ GetName() string }); ok {
+		res = append(res, m.GetName())
+	}
+	if m, ok := msg.(interface{ GetPath() string }); ok {
+		res = append(res, m.GetPath())
+	}
+	if m, ok := msg.(interface{ GetFilter() string }); ok {
+		res = append(res, m.GetFilter())
+	}
+	if m, ok := msg.(interface{ GetTenant() string }); ok {
+		res = append(res, m.GetTenant())
+	}
+	if m, ok := msg.(*cloudv1.CancelTransferRequest); ok {
+		res = append(res, strconv.FormatUint(m.GetId(), 10))
+	}
+	return res
+}
+
+// serverStream observes messages of the wrapped stream and overrides its context.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+	rec *record
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.rec.observe(m, &s.rec.bytesIn)
+	}
+	return err
+}
+
+func (s *serverStream) SendMsg(m any) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.rec.observe(m, &s.rec.bytesOut)
+	}
+	return err
+}
@@ -0,0 +1,120 @@
+package audit
+
+import (
+	auditlog "cloud/internal/audit"
+	"cloud/internal/grpc/auth"
+	"cloud/internal/grpc/tenancy"
+	"cloud/pkg/cloudv1"
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+)
+
+// events collects written events.
+type events []auditlog.Event
+
+func (e *events) Write(ev auditlog.Event) error {
+	*e = append(*e, ev)
+	return nil
+}
+
+// chain returns handler calling interceptors in order before the handler.
+func chain(info *grpc.UnaryServerInfo, handler grpc.UnaryHandler, interceptors ...grpc.UnaryServerInterceptor) grpc.UnaryHandler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, req any) (any, error) {
+			return interceptor(ctx, req, info, next)
+		}
+	}
+	return handler
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	authenticator := auth.New(true, []auth.APIKey{{Name: "alice", Key: "alice-key"}}, "", "")
+	resolver := tenancy.NewResolver("default", map[string][]string{"team-a": {"alice"}})
+
+	tests := []struct {
+		name          string
+		token         string
+		tenant        string
+		handlerErr    error
+		wantResult    string
+		wantPrincipal string
+		wantTenant    string
+	}{
+		{name: "ok", token: "alice-key", wantResult: "OK", wantPrincipal: "alice", wantTenant: "team-a"},
+		{name: "rejected by auth", token: "wrong", wantResult: "Unauthenticated"},
+		{name: "rejected by tenancy", token: "alice-key", tenant: "default", wantResult: "PermissionDenied",
+			wantPrincipal: "alice"},
+		{name: "rejected by handler", token: "alice-key", handlerErr: status.Error(codes.NotFound, "not found"),
+			wantResult: "NotFound", wantPrincipal: "alice", wantTenant: "team-a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var written events
+			info := &grpc.UnaryServerInfo{FullMethod: "/cloud.Cloud/Delete"}
+			handler := chain(info, func(ctx context.Context, req any) (any, error) {
+				return &cloudv1.DeleteResponse{}, tt.handlerErr
+			},
+				UnaryServerInterceptor(&written, log),
+				auth.UnaryServerInterceptor(authenticator, log),
+				tenancy.UnaryServerInterceptor(resolver),
+			)
+
+			md := metadata.Pairs("authorization", "Bearer "+tt.token)
+			if tt.tenant != "" {
+				md.Set(tenancy.Header, tt.tenant)
+			}
+			_, err := handler(metadata.NewIncomingContext(context.Background(), md), &cloudv1.DeleteRequest{Name: "a.png"})
+			if got := status.Code(err).String(); got != tt.wantResult {
+				t.Fatalf("call result = %s, want %s", got, tt.wantResult)
+			}
+
+			if len(written) != 1 {
+				t.Fatalf("written %d events, want 1", len(written))
+			}
+			e := written[0]
+			if e.Result != tt.wantResult || e.Principal != tt.wantPrincipal || e.Tenant != tt.wantTenant ||
+				e.Target != "a.png" {
+				t.Fatalf("event = %+v, want result %s, principal %q, tenant %q", e, tt.wantResult, tt.wantPrincipal,
+					tt.wantTenant)
+			}
+		})
+	}
+}
+
+func TestObserveTarget(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  any
+		want string
+	}{
+		{name: "image", msg: &cloudv1.DeleteRequest{Name: "a.png"}, want: "a.png"},
+		{name: "upload info", msg: &cloudv1.UploadRequest{Data: &cloudv1.UploadRequest_Info{
+			Info: &cloudv1.UploadInfo{Name: "b.png"}}}, want: "b.png"},
+		{name: "admin tenant", msg: &cloudv1.ReindexRequest{Tenant: "team-a"}, want: "team-a"},
+		{name: "transfer id", msg: &cloudv1.CancelTransferRequest{Id: 7}, want: "7"},
+		{name: "no target", msg: &cloudv1.GetConfigRequest{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &record{}
+			var bytes atomic.Int64
+			rec.observe(tt.msg, &bytes)
+
+			got, _ := rec.target.Load().(string)
+			if got != tt.want {
+				t.Fatalf("target = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
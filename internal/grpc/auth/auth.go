@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrMissingToken = errors.New("missing bearer token")
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+	MethodMTLS   = "mtls"
+)
+
+// Principal is an authenticated caller.
+type Principal struct {
+	Name   string
+	Method string
+}
+
+type (
+	principalKey struct{}
+	trackKey     struct{}
+)
+
+// tracked is principal attached to contexts derived from a tracked one.
+type tracked struct {
+	p  Principal
+	ok bool
+}
+
+// WithPrincipal returns context with the principal attached.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	if t, ok := ctx.Value(trackKey{}).(*tracked); ok {
+		t.p, t.ok = p, true
+	}
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// Track returns context which remembers principal attached to contexts derived from it.
+// It lets interceptors running before authentication see the principal once the call is done.
+func Track(ctx context.Context) (context.Context, func() (Principal, bool)) {
+	t := &tracked{}
+	return context.WithValue(ctx, trackKey{}, t), func() (Principal, bool) {
+		return t.p, t.ok
+	}
+}
+
+// FromContext returns principal attached by the auth interceptors.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// APIKey is a static key of a named client.
+type APIKey struct {
+	Name string
+	Key  string
+}
+
+// Authenticator validates bearer tokens: static API keys and HMAC signed JWTs.
+type Authenticator struct {
+	// required rejects anonymous calls, otherwise they pass without principal
+	required  bool
+	keys      []apiKey
+	jwtSecret []byte
+	jwtIssuer string
+}
+
+type apiKey struct {
+	name string
+	hash [sha256.Size]byte
+}
+
+// New creates authenticator. Empty secret disables JWT.
+// Not required authenticator only attaches principal of calls which have credentials,
+// without keys and secret it ignores tokens.
+func New(required bool, keys []APIKey, jwtSecret string, jwtIssuer string) *Authenticator {
+	a := &Authenticator{
+		required:  required,
+		keys:      make([]apiKey, 0, len(keys)),
+		jwtSecret: []byte(jwtSecret),
+		jwtIssuer: jwtIssuer,
+	}
+	for _, k := range keys {
+		a.keys = append(a.keys, apiKey{name: k.Name, hash: sha256.Sum256([]byte(k.Key))})
+	}
+	return a
+}
+
+// hasCredentials reports whether any token can be valid.
+func (a *Authenticator) hasCredentials() bool {
+	return len(a.keys) > 0 || len(a.jwtSecret) > 0
+}
+
+// Authenticate validates token and returns its principal.
+// Tokens which look like JWT are checked as JWT, others as API keys.
+func (a *Authenticator) Authenticate(token string) (Principal, error) {
+	if token == "" {
+		return Principal{}, ErrMissingToken
+	}
+
+	if strings.Count(token, ".") == 2 && len(a.jwtSecret) > 0 {
+		claims, err := a.verifyJWT(token)
+		if err != nil {
+			return Principal{}, err
+		}
+		return Principal{Name: claims.Subject, Method: MethodJWT}, nil
+	}
+
+	// hashes have the same length, so comparison time doesn't depend on the key
+	hash := sha256.Sum256([]byte(token))
+	name, found := "", false
+	for _, k := range a.keys {
+		if subtle.ConstantTimeCompare(hash[:], k.hash[:]) == 1 {
+			name, found = k.name, true
+		}
+	}
+	if !found {
+		return Principal{}, ErrInvalidToken
+	}
+
+	return Principal{Name: name, Method: MethodAPIKey}, nil
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+const (
+	testSecret = "secret"
+	testMethod = "/cloud.Cloud/ListFiles"
+)
+
+// signJWT returns HS256 token of the claims.
+func signJWT(t *testing.T, secret string, claims jwtClaims) string {
+	t.Helper()
+
+	header, err := json.Marshal(jwtHeader{Alg: "HS256", Typ: "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestAuthenticate(t *testing.T) {
+	keys := []APIKey{{Name: "alice", Key: "alice-key"}}
+	valid := signJWT(t, testSecret, jwtClaims{Subject: "bob", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	expired := signJWT(t, testSecret, jwtClaims{Subject: "bob", ExpiresAt: time.Now().Add(-time.Hour).Unix()})
+	forged := signJWT(t, "other", jwtClaims{Subject: "bob", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+
+	tests := []struct {
+		name     string
+		required bool
+		keys     []APIKey
+		secret   string
+		method   string
+		token    string
+		want     string
+		wantCode codes.Code
+	}{
+		{name: "api key", required: true, keys: keys, token: "alice-key", want: "alice"},
+		{name: "jwt", required: true, keys: keys, secret: testSecret, token: valid, want: "bob"},
+		{name: "invalid key", required: true, keys: keys, token: "wrong", wantCode: codes.Unauthenticated},
+		{name: "expired jwt", required: true, secret: testSecret, token: expired, wantCode: codes.Unauthenticated},
+		{name: "forged jwt", required: true, secret: testSecret, token: forged, wantCode: codes.Unauthenticated},
+		{name: "missing token", required: true, keys: keys, wantCode: codes.Unauthenticated},
+		{name: "public method", required: true, keys: keys, method: "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo"},
+		{name: "anonymous", keys: keys},
+		{name: "optional api key", keys: keys, token: "alice-key", want: "alice"},
+		{name: "optional invalid key", keys: keys, token: "wrong", wantCode: codes.Unauthenticated},
+		// without keys and secret no token can be valid
+		{name: "token without credentials", token: "alice-key"},
+		{name: "jwt without credentials", token: valid},
+		{name: "required without credentials", required: true, token: "alice-key", wantCode: codes.Unauthenticated},
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := New(tt.required, tt.keys, tt.secret, "")
+
+			ctx := context.Background()
+			if tt.token != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+tt.token))
+			}
+			method := tt.method
+			if method == "" {
+				method = testMethod
+			}
+
+			ctx, err := a.authenticate(ctx, method, log)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("authenticate() error = %v, want code %v", err, tt.wantCode)
+			}
+			if err != nil {
+				return
+			}
+
+			p, ok := FromContext(ctx)
+			if ok != (tt.want != "") || p.Name != tt.want {
+				t.Fatalf("authenticate() principal = %+v, %v, want %q", p, ok, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"strings"
+)
+
+// publicMethods don't require authentication.
+var publicMethods = []string{
+	"/grpc.reflection.",
+	"/grpc.health.v1.",
+}
+
+// IsPublicMethod reports whether the method is available without authentication.
+func IsPublicMethod(method string) bool {
+	for _, prefix := range publicMethods {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// UnaryServerInterceptor authenticates unary calls.
+func UnaryServerInterceptor(a *Authenticator, log *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := a.authenticate(ctx, info.FullMethod, log)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor authenticates streaming calls.
+func StreamServerInterceptor(a *Authenticator, log *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authenticate(ss.Context(), info.FullMethod, log)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticate validates bearer token from metadata and attaches principal to context.
+func (a *Authenticator) authenticate(ctx context.Context, method string, log *slog.Logger) (context.Context, error) {
+	const fn = "auth.authenticate"
+
+	if IsPublicMethod(method) {
+		return ctx, nil
+	}
+
+	token := bearerToken(ctx)
+	// no token can be valid, so tokens of clients set up for another deployment are ignored like anonymous calls
+	if !a.required && !a.hasCredentials() {
+		token = ""
+	}
+
+	// verified client certificate is enough when no token is sent
+	if token == "" {
+		if p, ok := certPrincipal(ctx); ok {
+			return WithPrincipal(ctx, p), nil
+		}
+		if !a.required {
+			return ctx, nil
+		}
+	}
+
+	p, err := a.Authenticate(token)
+	if err != nil {
+		log.InfoContext(ctx, err.Error(), slog.String("fn", fn), slog.String("method", method),
+			slog.String("peer", peerAddr(ctx)))
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	return WithPrincipal(ctx, p), nil
+}
+
+func bearerToken(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	for _, v := range md.Get("authorization") {
+		if token, ok := strings.CutPrefix(v, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	return ""
+}
+
+// certPrincipal returns identity of verified mTLS client certificate:
+// the first URI or DNS SAN, or subject common name.
+func certPrincipal(ctx context.Context) (Principal, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return Principal{}, false
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return Principal{}, false
+	}
+
+	cert := tlsInfo.State.VerifiedChains[0][0]
+	name := cert.Subject.CommonName
+	switch {
+	case len(cert.URIs) > 0:
+		name = cert.URIs[0].String()
+	case len(cert.DNSNames) > 0:
+		name = cert.DNSNames[0]
+	}
+	if name == "" {
+		return Principal{}, false
+	}
+
+	return Principal{Name: name, Method: MethodMTLS}, true
+}
+
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// serverStream overrides context of the wrapped stream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+)
+
+// leeway is allowed clock skew between token issuer and server.
+const leeway = 30 * time.Second
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+type jwtClaims struct {
+	Subject   string `json:"sub"`
+	Issuer    string `json:"iss"`
+	ExpiresAt int64  `json:"exp"`
+	NotBefore int64  `json:"nbf"`
+}
+
+// verifyJWT checks HS256/HS384/HS512 signature and time claims of the token.
+func (a *Authenticator) verifyJWT(token string) (jwtClaims, error) {
+	parts := strings.Split(token, ".")
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return jwtClaims{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	var h func() hash.Hash
+	switch header.Alg {
+	case "HS256":
+		h = sha256.New
+	case "HS384":
+		h = sha512.New384
+	case "HS512":
+		h = sha512.New
+	default:
+		return jwtClaims{}, fmt.Errorf("%w: unsupported alg %q", ErrInvalidToken, header.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return jwtClaims{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	mac := hmac.New(h, a.jwtSecret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return jwtClaims{}, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return jwtClaims{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	now := time.Now()
+	if claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(leeway)) {
+		return jwtClaims{}, fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+	if claims.NotBefore != 0 && now.Add(leeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return jwtClaims{}, fmt.Errorf("%w: token not valid yet", ErrInvalidToken)
+	}
+	if a.jwtIssuer != "" && claims.Issuer != a.jwtIssuer {
+		return jwtClaims{}, fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	}
+	if claims.Subject == "" {
+		return jwtClaims{}, fmt.Errorf("%w: empty subject", ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
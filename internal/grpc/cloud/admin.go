@@ -0,0 +1,237 @@
+package cloud
+
+import (
+	"cloud/internal/config"
+	"cloud/internal/grpc/auth"
+	"cloud/internal/grpc/tenancy"
+	"cloud/pkg/cloudv1"
+	"context"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"path"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+var ErrTransferNotFound = errors.New("transfer doesn't exist or has finished")
+
+// mutatingMethods change images and are rejected in read-only mode.
+var mutatingMethods = map[string]struct{}{
+	"Upload":       {},
+	"SetMetadata":  {},
+	"AddTags":      {},
+	"RemoveTags":   {},
+	"CreateFolder": {},
+	"MoveToFolder": {},
+	"Delete":       {},
+}
+
+// SetReadOnly toggles read-only mode. Transfers in flight finish.
+func (s *Server) SetReadOnly(readOnly bool) {
+	s.readOnly.Store(readOnly)
+}
+
+// ReadOnly reports whether calls which change images are rejected.
+func (s *Server) ReadOnly() bool {
+	return s.readOnly.Load()
+}
+
+// checkWritable returns Unavailable for calls which change images in read-only mode.
+func (s *Server) checkWritable(ctx context.Context, method string) error {
+	const fn = "cloud.checkWritable"
+
+	if !s.readOnly.Load() {
+		return nil
+	}
+	if _, ok := mutatingMethods[path.Base(method)]; !ok {
+		return nil
+	}
+
+	s.log.InfoContext(ctx, ErrReadOnly.Error(), slog.String("fn", fn), slog.String("method", method))
+	return status.Error(codes.Unavailable, ErrReadOnly.Error())
+}
+
+// Admin serves CloudAdmin calls over the cloud server.
+type Admin struct {
+	cloudv1.UnimplementedCloudAdminServer
+	log    *slog.Logger
+	server *Server
+	cfg    atomic.Pointer[config.Config]
+}
+
+// NewAdmin creates admin service of the server, cfg is dumped by GetConfig.
+func NewAdmin(log *slog.Logger, server *Server, cfg *config.Config) *Admin {
+	a := &Admin{
+		log:    log,
+		server: server,
+	}
+	a.cfg.Store(cfg)
+	return a
+}
+
+func RegisterAdmin(gRPC *grpc.Server, admin *Admin) {
+	cloudv1.RegisterCloudAdminServer(gRPC, admin)
+}
+
+// SetConfig replaces config dumped by GetConfig, e.g. after policies are reloaded.
+func (a *Admin) SetConfig(cfg *config.Config) {
+	a.cfg.Store(cfg)
+}
+
+// ListTransfers returns progress of in-flight uploads and downloads.
+func (a *Admin) ListTransfers(_ context.Context, _ *cloudv1.ListTransfersRequest) (*cloudv1.ListTransfersResponse, error) {
+	transfers := a.server.ActiveTransfers()
+
+	res := make([]*cloudv1.Transfer, 0, len(transfers))
+	for _, t := range transfers {
+		res = append(res, &cloudv1.Transfer{
+			Id:        t.ID,
+			Direction: t.Direction,
+			Tenant:    t.Tenant,
+			Client:    t.Client,
+			Peer:      t.Peer,
+			Name:      t.Name,
+			Bytes:     uint64(t.Bytes),
+			Size:      uint64(t.Size),
+			StartedAt: t.Started.Format(time.RFC3339),
+		})
+	}
+
+	return &cloudv1.ListTransfersResponse{
+		Transfers: res,
+		ReadOnly:  a.server.ReadOnly(),
+	}, nil
+}
+
+// CancelTransfer cancels in-flight upload or download, its client gets Aborted.
+func (a *Admin) CancelTransfer(ctx context.Context, req *cloudv1.CancelTransferRequest) (*cloudv1.CancelTransferResponse, error) {
+	const fn = "cloud.CancelTransfer"
+
+	if !a.server.CancelTransfer(req.GetId()) {
+		return nil, status.Error(codes.NotFound, ErrTransferNotFound.Error())
+	}
+
+	a.log.WarnContext(ctx, "transfer cancelled", slog.String("fn", fn), slog.Uint64("id", req.GetId()),
+		slog.String("admin", admin(ctx)))
+
+	return &cloudv1.CancelTransferResponse{}, nil
+}
+
+// SetReadOnly toggles read-only mode, uploads and changes of images get Unavailable while it's on.
+func (a *Admin) SetReadOnly(ctx context.Context, req *cloudv1.SetReadOnlyRequest) (*cloudv1.ReadOnlyState, error) {
+	const fn = "cloud.SetReadOnly"
+
+	a.server.SetReadOnly(req.GetReadOnly())
+	a.log.WarnContext(ctx, "read-only mode set", slog.String("fn", fn), slog.Bool("read_only", req.GetReadOnly()),
+		slog.String("admin", admin(ctx)))
+
+	return &cloudv1.ReadOnlyState{ReadOnly: a.server.ReadOnly()}, nil
+}
+
+// GetConfig returns effective config with secrets redacted.
+func (a *Admin) GetConfig(ctx context.Context, _ *cloudv1.GetConfigRequest) (*cloudv1.GetConfigResponse, error) {
+	const fn = "cloud.GetConfig"
+
+	data, err := a.cfg.Load().YAML()
+	if err != nil {
+		a.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
+		return nil, status.Error(codes.Internal, ErrInternal.Error())
+	}
+
+	return &cloudv1.GetConfigResponse{Yaml: string(data)}, nil
+}
+
+// CleanTmp removes tmp files of the tenant or of all tenants.
+func (a *Admin) CleanTmp(ctx context.Context, req *cloudv1.CleanTmpRequest) (*cloudv1.CleanTmpResponse, error) {
+	const fn = "cloud.CleanTmp"
+
+	// the server is running, so removing all files would fail uploads in progress
+	if req.GetOlderThanSeconds() == 0 {
+		a.log.InfoContext(ctx, ErrTmpAge.Error(), slog.String("fn", fn))
+		return nil, status.Error(codes.InvalidArgument, ErrTmpAge.Error())
+	}
+
+	tenants, err := a.tenants(ctx, req.GetTenant())
+	if err != nil {
+		return nil, err
+	}
+
+	olderThan := time.Duration(req.GetOlderThanSeconds()) * time.Second
+	removed := make(map[string]uint32, len(tenants))
+	for _, t := range tenants {
+		n, err := t.cloud.CleanTmp(ctx, olderThan)
+		if err != nil {
+			t.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
+			return nil, status.Error(codes.Internal, ErrInternal.Error())
+		}
+		removed[t.name] = uint32(n)
+	}
+
+	a.log.InfoContext(ctx, "tmp files cleaned", slog.String("fn", fn), slog.Any("removed", removed),
+		slog.String("admin", admin(ctx)))
+
+	return &cloudv1.CleanTmpResponse{Removed: removed}, nil
+}
+
+// Reindex rebuilds search index of the tenant or of all tenants.
+func (a *Admin) Reindex(ctx context.Context, req *cloudv1.ReindexRequest) (*cloudv1.ReindexResponse, error) {
+	const fn = "cloud.Reindex"
+
+	tenants, err := a.tenants(ctx, req.GetTenant())
+	if err != nil {
+		return nil, err
+	}
+
+	images := make(map[string]uint32, len(tenants))
+	for _, t := range tenants {
+		n, err := t.cloud.Reindex(ctx)
+		if err != nil {
+			t.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
+			return nil, status.Error(codes.Internal, ErrInternal.Error())
+		}
+		images[t.name] = uint32(n)
+	}
+
+	a.log.InfoContext(ctx, "search index rebuilt", slog.String("fn", fn), slog.Any("images", images),
+		slog.String("admin", admin(ctx)))
+
+	return &cloudv1.ReindexResponse{Images: images}, nil
+}
+
+// tenants returns the named tenant or all tenants if name is empty.
+func (a *Admin) tenants(ctx context.Context, name string) ([]*tenant, error) {
+	const fn = "cloud.tenants"
+
+	if name != "" {
+		t, ok := a.server.tenants[name]
+		if !ok {
+			a.log.InfoContext(ctx, tenancy.ErrUnknownTenant.Error(), slog.String("fn", fn), slog.String("tenant", name))
+			return nil, status.Error(codes.NotFound, tenancy.ErrUnknownTenant.Error())
+		}
+		return []*tenant{t}, nil
+	}
+
+	names := make([]string, 0, len(a.server.tenants))
+	for name := range a.server.tenants {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	res := make([]*tenant, 0, len(names))
+	for _, name := range names {
+		res = append(res, a.server.tenants[name])
+	}
+	return res, nil
+}
+
+// admin returns name of the calling admin for logs.
+func admin(ctx context.Context) string {
+	if p, ok := auth.FromContext(ctx); ok {
+		return p.Name
+	}
+	return ""
+}
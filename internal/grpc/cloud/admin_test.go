@@ -0,0 +1,33 @@
+package cloud
+
+import (
+	"cloud/pkg/cloudv1"
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestCleanTmpAge(t *testing.T) {
+	tests := []struct {
+		name      string
+		olderThan uint32
+		want      codes.Code
+	}{
+		{name: "unset removes files of running uploads", olderThan: 0, want: codes.InvalidArgument},
+		{name: "positive", olderThan: 3600, want: codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAdmin(slog.New(slog.NewTextHandler(io.Discard, nil)), &Server{}, nil)
+
+			_, err := a.CleanTmp(context.Background(), &cloudv1.CleanTmpRequest{OlderThanSeconds: tt.olderThan})
+			if got := status.Code(err); got != tt.want {
+				t.Fatalf("CleanTmp() code = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
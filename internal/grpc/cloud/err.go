@@ -1,22 +1,50 @@
 package cloud
 
 import (
+	"cloud/internal/config"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 )
 
 var (
-	ErrInternal      = errors.New("internal error")
-	ErrNotExist      = errors.New("image doesn't exist")
-	ErrEmptyFilename = errors.New("filename is empty")
+	ErrInternal          = errors.New("internal error")
+	ErrNotExist          = errors.New("image doesn't exist")
+	ErrEmptyFilename     = errors.New("filename is empty")
+	ErrEmptyFolder       = errors.New("folder path is empty")
+	ErrFolderNotExist    = errors.New("folder doesn't exist")
+	ErrImageHeader       = errors.New("cannot decode image header")
+	ErrImageAnimated     = errors.New("animated images of this format are not allowed")
+	ErrInvalidLabels     = errors.New("tags and metadata keys must be 1-64 chars of [a-zA-Z0-9_.-/], values up to 256 chars")
+	ErrOutOfScope        = errors.New("image or folder is out of the caller scope")
+	ErrShareDisabled     = errors.New("share links are disabled")
+	ErrShuttingDown      = errors.New("server is shutting down, transfer is cut off")
+	ErrTransferCancelled = errors.New("transfer is cancelled by admin")
+	ErrReadOnly          = errors.New("server is in read-only mode, try again later")
+	ErrTmpAge            = errors.New("older_than_seconds must be positive, younger tmp files belong to running uploads")
 )
 
 type ErrImageExt struct {
-	ext map[string]struct{}
+	ext map[string]config.FormatPolicy
 }
 
 func (e *ErrImageExt) Error() string {
-	return fmt.Sprintf("unsupported ext. available exts: %v", e.ext)
+	exts := make([]string, 0, len(e.ext))
+	for ext := range e.ext {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return fmt.Sprintf("unsupported ext. available exts: [%s]", strings.Join(exts, " "))
+}
+
+type ErrImageMIME struct {
+	mime    string
+	allowed []string
+}
+
+func (e *ErrImageMIME) Error() string {
+	return fmt.Sprintf("content type %q doesn't match ext. allowed types: %v", e.mime, e.allowed)
 }
 
 type ErrImageMaxSize struct {
@@ -26,3 +54,20 @@ type ErrImageMaxSize struct {
 func (e *ErrImageMaxSize) Error() string {
 	return fmt.Sprintf("image is too large. max size: %d", e.maxImageSize)
 }
+
+type ErrImageMaxDimensions struct {
+	maxWidth  int
+	maxHeight int
+}
+
+func (e *ErrImageMaxDimensions) Error() string {
+	return fmt.Sprintf("image dimensions are too large. max width: %d, max height: %d", e.maxWidth, e.maxHeight)
+}
+
+type ErrImageMaxPixels struct {
+	maxPixels int
+}
+
+func (e *ErrImageMaxPixels) Error() string {
+	return fmt.Sprintf("image has too many pixels. max pixels: %d", e.maxPixels)
+}
@@ -0,0 +1,132 @@
+package cloud
+
+import (
+	"cloud/internal/storage"
+	"cloud/pkg/cloudv1"
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"os"
+)
+
+// CreateFolder creates folder for images.
+func (s *Server) CreateFolder(ctx context.Context, req *cloudv1.CreateFolderRequest) (*cloudv1.CreateFolderResponse, error) {
+	const fn = "cloud.CreateFolder"
+
+	t, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	folder, err := storage.CleanPath(req.GetPath())
+	if err == nil && folder == "" {
+		err = ErrEmptyFolder
+	}
+	if err != nil {
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := t.checkFolderScope(ctx, fn, folder, false); err != nil {
+		return nil, err
+	}
+
+	err = t.cloud.CreateFolder(ctx, folder)
+	if err != nil {
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+		if errors.Is(err, storage.ErrFolderExists) {
+			return nil, status.Error(codes.AlreadyExists, storage.ErrFolderExists.Error())
+		}
+		return nil, status.Error(codes.Internal, ErrInternal.Error())
+	}
+
+	t.log.InfoContext(ctx, "folder created", slog.String("fn", fn), slog.String("folder", folder))
+
+	return &cloudv1.CreateFolderResponse{Path: folder}, nil
+}
+
+// ListFolder returns subfolders and images of the folder.
+func (s *Server) ListFolder(ctx context.Context, req *cloudv1.ListFolderRequest) (*cloudv1.ListFolderResponse, error) {
+	const fn = "cloud.ListFolder"
+
+	t, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := t.acquire(ctx, fn, t.limitList, t.client(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	folder, err := storage.CleanPath(req.GetPath())
+	if err != nil {
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := t.checkFolderScope(ctx, fn, folder, true); err != nil {
+		return nil, err
+	}
+
+	folders, images, err := t.cloud.ListFolder(ctx, folder, req.GetRecursive())
+	if err != nil {
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, status.Error(codes.NotFound, ErrFolderNotExist.Error())
+		}
+		return nil, status.Error(codes.Internal, ErrInternal.Error())
+	}
+
+	return &cloudv1.ListFolderResponse{
+		Folders: scopeFolders(ctx, folders),
+		Files:   fileStructures(scopeImages(ctx, images)),
+	}, nil
+}
+
+// MoveToFolder moves image to the folder, empty folder is the root.
+func (s *Server) MoveToFolder(ctx context.Context, req *cloudv1.MoveToFolderRequest) (*cloudv1.MoveToFolderResponse, error) {
+	const fn = "cloud.MoveToFolder"
+
+	t, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	filename, err := imageName(req.GetName())
+	if err != nil {
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	folder, err := storage.CleanPath(req.GetFolder())
+	if err != nil {
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := t.checkImageScope(ctx, fn, filename); err != nil {
+		return nil, err
+	}
+	if err := t.checkFolderScope(ctx, fn, folder, false); err != nil {
+		return nil, err
+	}
+
+	name, err := t.cloud.MoveToFolder(ctx, filename, folder)
+	if err != nil {
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			return nil, status.Error(codes.NotFound, ErrNotExist.Error())
+		case errors.Is(err, storage.ErrFileExists):
+			return nil, status.Error(codes.AlreadyExists, storage.ErrFileExists.Error())
+		}
+		return nil, status.Error(codes.Internal, ErrInternal.Error())
+	}
+
+	t.log.InfoContext(ctx, "image moved", slog.String("fn", fn), slog.String("from", filename), slog.String("to", name))
+
+	return &cloudv1.MoveToFolderResponse{Name: name}, nil
+}
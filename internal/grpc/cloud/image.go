@@ -0,0 +1,55 @@
+package cloud
+
+import (
+	"cloud/internal/config"
+	"cloud/internal/imaging"
+	"slices"
+)
+
+// maxSize returns max image size for the format.
+func maxSize(cfg *config.CloudConfig, policy config.FormatPolicy) int {
+	if policy.MaxSize > 0 {
+		return policy.MaxSize
+	}
+	return cfg.MaxImageSize
+}
+
+// checkFormat checks detected content type and animation against the format policy.
+func (t *tenant) checkFormat(data []byte, policy config.FormatPolicy) (string, error) {
+	mime := imaging.DetectMIME(data)
+	if len(policy.MimeTypes) > 0 && !slices.Contains(policy.MimeTypes, mime) {
+		return "", &ErrImageMIME{mime: mime, allowed: policy.MimeTypes}
+	}
+
+	if !policy.AllowAnimation {
+		animated, err := imaging.IsAnimated(data)
+		if err != nil {
+			return "", ErrImageHeader
+		}
+		if animated {
+			return "", ErrImageAnimated
+		}
+	}
+
+	return mime, nil
+}
+
+// checkDimensions decodes only the image header and checks width, height and pixel count
+// against the limits. Zero limit disables the check.
+func checkDimensions(cfg *config.CloudConfig, data []byte) error {
+	width, height, err := imaging.Dimensions(data)
+	if err != nil {
+		return ErrImageHeader
+	}
+
+	if (cfg.MaxWidth > 0 && width > cfg.MaxWidth) ||
+		(cfg.MaxHeight > 0 && height > cfg.MaxHeight) {
+		return &ErrImageMaxDimensions{maxWidth: cfg.MaxWidth, maxHeight: cfg.MaxHeight}
+	}
+
+	if cfg.MaxPixels > 0 && width*height > cfg.MaxPixels {
+		return &ErrImageMaxPixels{maxPixels: cfg.MaxPixels}
+	}
+
+	return nil
+}
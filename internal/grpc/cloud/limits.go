@@ -0,0 +1,172 @@
+package cloud
+
+import (
+	"cloud/internal/limiter"
+	"cloud/pkg/cloudv1"
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	retryAfterHeader = "retry-after"
+	// slotRetryAfter is suggested retry delay when no slot is available.
+	slotRetryAfter = time.Second
+)
+
+// UnaryServerInterceptor rejects changes in read-only mode and enforces per client request rate
+// of the tenant on Cloud calls.
+// It must run after tenancy interceptor.
+func (s *Server) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if info.Server == s {
+			if err := s.checkWritable(ctx, info.FullMethod); err != nil {
+				return nil, err
+			}
+			if err := s.allow(ctx, info.FullMethod); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor rejects uploads in read-only mode and enforces per client request rate
+// of the tenant on Cloud calls.
+// It must run after tenancy interceptor.
+func (s *Server) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if srv == s {
+			if err := s.checkWritable(ss.Context(), info.FullMethod); err != nil {
+				return err
+			}
+			if err := s.allow(ss.Context(), info.FullMethod); err != nil {
+				return err
+			}
+		}
+		return handler(srv, ss)
+	}
+}
+
+// allow takes request token of the caller.
+func (s *Server) allow(ctx context.Context, method string) error {
+	const fn = "cloud.allow"
+
+	t, err := s.tenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	client := t.client(ctx)
+	if wait, ok := t.limits.Allow(client); !ok {
+		t.log.InfoContext(ctx, limiter.ErrRateLimited.Error(), slog.String("fn", fn), slog.String("client", client),
+			slog.String("method", method))
+		t.rejectAdmission(admissionRateLimit)
+		setRetryAfter(ctx, wait)
+		return status.Error(codes.ResourceExhausted, limiter.ErrRateLimited.Error())
+	}
+	return nil
+}
+
+// acquire waits for a slot of the queue. Full queue is ResourceExhausted and too long wait
+// is Unavailable, both with retry-after header.
+func (t *tenant) acquire(ctx context.Context, fn string, q *limiter.FairQueue, client string) (func(), error) {
+	_, span := tracer.Start(ctx, "cloud.acquire", trace.WithAttributes(attribute.String("client", client)))
+	release, err := q.Acquire(ctx, client)
+	span.End()
+	if err == nil {
+		return release, nil
+	}
+
+	t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn), slog.String("client", client))
+	switch {
+	case errors.Is(err, limiter.ErrQueueFull):
+		t.rejectAdmission(admissionQueueFull)
+		setRetryAfter(ctx, slotRetryAfter)
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, limiter.ErrWaitTimeout):
+		t.rejectAdmission(admissionWaitTimeout)
+		setRetryAfter(ctx, slotRetryAfter)
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return nil, status.FromContextError(err).Err()
+}
+
+// setRetryAfter sends whole seconds the client should wait before retrying in response header.
+func setRetryAfter(ctx context.Context, wait time.Duration) {
+	seconds := int64(math.Ceil(wait.Seconds()))
+	_ = grpc.SetHeader(ctx, metadata.Pairs(retryAfterHeader, strconv.FormatInt(max(seconds, 1), 10)))
+}
+
+// throttle waits until the client may transfer n more bytes.
+func (t *tenant) throttle(ctx context.Context, fn string, client string, n int) error {
+	if err := t.limits.Throttle(ctx, client, n); err != nil {
+		if err := t.checkCutOff(ctx, fn); err != nil {
+			return err
+		}
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn), slog.String("client", client))
+		return status.FromContextError(err).Err()
+	}
+	return nil
+}
+
+// logSlots logs occupancy of the slots.
+func (t *tenant) logSlots(ctx context.Context, msg string, fn string, q *limiter.FairQueue) {
+	state := q.State()
+	t.log.InfoContext(ctx, msg, slog.String("fn", fn), slog.Int("current", state.InUse), slog.Int("max", state.Capacity),
+		slog.Int("waiting", state.Waiting))
+}
+
+// GetLimits returns slots occupancy and client token balances of the tenant or of all tenants.
+func (a *Admin) GetLimits(ctx context.Context, req *cloudv1.GetLimitsRequest) (*cloudv1.GetLimitsResponse, error) {
+	tenants, err := a.tenants(ctx, req.GetTenant())
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*cloudv1.TenantLimits, 0, len(tenants))
+	for _, t := range tenants {
+		clients := make([]*cloudv1.ClientLimits, 0)
+		for _, c := range t.limits.State() {
+			clients = append(clients, &cloudv1.ClientLimits{
+				Client:          c.Client,
+				RequestTokens:   c.RequestTokens,
+				BandwidthTokens: c.BandwidthTokens,
+			})
+		}
+		res = append(res, &cloudv1.TenantLimits{
+			Tenant:         t.name,
+			UploadDownload: slotsState(t.limitUD.State()),
+			List:           slotsState(t.limitList.State()),
+			Clients:        clients,
+		})
+	}
+
+	return &cloudv1.GetLimitsResponse{Tenants: res}, nil
+}
+
+func slotsState(state limiter.QueueState) *cloudv1.SlotsState {
+	clients := make([]*cloudv1.ClientSlots, 0, len(state.Clients))
+	for _, c := range state.Clients {
+		clients = append(clients, &cloudv1.ClientSlots{
+			Client:  c.Client,
+			Held:    uint32(c.Held),
+			Waiting: uint32(c.Waiting),
+		})
+	}
+	return &cloudv1.SlotsState{
+		InUse:    uint32(state.InUse),
+		Capacity: uint32(state.Capacity),
+		Waiting:  uint32(state.Waiting),
+		Clients:  clients,
+	}
+}
@@ -0,0 +1,120 @@
+package cloud
+
+import (
+	service "cloud/internal/services/cloud"
+	"cloud/internal/storage/drive"
+	"cloud/pkg/cloudv1"
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"os"
+)
+
+// SetMetadata sets user-defined metadata of image.
+func (s *Server) SetMetadata(ctx context.Context, req *cloudv1.SetMetadataRequest) (*cloudv1.ImageMetadata, error) {
+	const fn = "cloud.SetMetadata"
+
+	t, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	filename, err := imageName(req.GetName())
+	if err != nil {
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := t.checkImageScope(ctx, fn, filename); err != nil {
+		return nil, err
+	}
+
+	meta, err := t.cloud.SetMetadata(ctx, filename, req.GetMetadata(), req.GetReplace())
+	if err != nil {
+		return nil, t.metadataError(ctx, fn, err)
+	}
+
+	t.log.InfoContext(ctx, "metadata updated", slog.String("fn", fn), slog.String("filename", meta.Name))
+
+	return imageMetadata(meta), nil
+}
+
+// AddTags adds tags to image.
+func (s *Server) AddTags(ctx context.Context, req *cloudv1.TagsRequest) (*cloudv1.ImageMetadata, error) {
+	const fn = "cloud.AddTags"
+
+	t, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	filename, err := imageName(req.GetName())
+	if err != nil {
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := t.checkImageScope(ctx, fn, filename); err != nil {
+		return nil, err
+	}
+
+	meta, err := t.cloud.AddTags(ctx, filename, req.GetTags())
+	if err != nil {
+		return nil, t.metadataError(ctx, fn, err)
+	}
+
+	t.log.InfoContext(ctx, "tags added", slog.String("fn", fn), slog.String("filename", meta.Name))
+
+	return imageMetadata(meta), nil
+}
+
+// RemoveTags removes tags from image.
+func (s *Server) RemoveTags(ctx context.Context, req *cloudv1.TagsRequest) (*cloudv1.ImageMetadata, error) {
+	const fn = "cloud.RemoveTags"
+
+	t, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	filename, err := imageName(req.GetName())
+	if err != nil {
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := t.checkImageScope(ctx, fn, filename); err != nil {
+		return nil, err
+	}
+
+	meta, err := t.cloud.RemoveTags(ctx, filename, req.GetTags())
+	if err != nil {
+		return nil, t.metadataError(ctx, fn, err)
+	}
+
+	t.log.InfoContext(ctx, "tags removed", slog.String("fn", fn), slog.String("filename", meta.Name))
+
+	return imageMetadata(meta), nil
+}
+
+// metadataError converts service error of metadata methods to grpc status.
+func (t *tenant) metadataError(ctx context.Context, fn string, err error) error {
+	t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return status.Error(codes.NotFound, ErrNotExist.Error())
+	case errors.Is(err, service.ErrInvalidTag), errors.Is(err, service.ErrInvalidMetadata):
+		return status.Error(codes.InvalidArgument, ErrInvalidLabels.Error())
+	}
+	return status.Error(codes.Internal, ErrInternal.Error())
+}
+
+func imageMetadata(meta drive.Meta) *cloudv1.ImageMetadata {
+	return &cloudv1.ImageMetadata{
+		Name:     meta.Name,
+		Tags:     meta.Tags,
+		Metadata: meta.Metadata,
+	}
+}
@@ -0,0 +1,136 @@
+package cloud
+
+import (
+	"cloud/internal/domain/models"
+	"cloud/internal/limiter"
+	"cloud/internal/metrics"
+	"cmp"
+	"context"
+	"log/slog"
+	"slices"
+)
+
+// Upload rejection reasons.
+const (
+	rejectName         = "name"
+	rejectExt          = "ext"
+	rejectScope        = "scope"
+	rejectExists       = "exists"
+	rejectSize         = "size"
+	rejectFormat       = "format"
+	rejectDimensions   = "dimensions"
+	rejectSimilar      = "similar"
+	rejectInvalidImage = "invalid_image"
+	rejectLabels       = "labels"
+)
+
+// Admission rejection reasons.
+const (
+	admissionRateLimit   = "rate_limit"
+	admissionQueueFull   = "queue_full"
+	admissionWaitTimeout = "wait_timeout"
+)
+
+// Transfer directions.
+const (
+	directionUpload   = "upload"
+	directionDownload = "download"
+)
+
+// serverMetrics are transfer and admission metrics of all tenants.
+type serverMetrics struct {
+	transferBytes     *metrics.CounterVec
+	uploadsRejected   *metrics.CounterVec
+	admissionRejected *metrics.CounterVec
+}
+
+func newServerMetrics(reg *metrics.Registry) *serverMetrics {
+	return &serverMetrics{
+		transferBytes: reg.NewCounterVec("cloud_transfer_bytes_total",
+			"Image bytes received by uploads and sent by downloads.", "tenant", "direction"),
+		uploadsRejected: reg.NewCounterVec("cloud_uploads_rejected_total",
+			"Uploads rejected by validation or conflicts.", "tenant", "reason"),
+		admissionRejected: reg.NewCounterVec("cloud_admission_rejected_total",
+			"Calls rejected by rate limits or slot queues.", "tenant", "reason"),
+	}
+}
+
+// registerGauges registers gauges collected from tenants on scrape.
+func (s *Server) registerGauges(reg *metrics.Registry) {
+	slots := func(get func(q limiter.QueueState) int) func(emit func(v float64, values ...string)) {
+		return func(emit func(v float64, values ...string)) {
+			for _, t := range s.sortedTenants() {
+				emit(float64(get(t.limitUD.State())), t.name, "upload_download")
+				emit(float64(get(t.limitList.State())), t.name, "list")
+			}
+		}
+	}
+	reg.NewGaugeFunc("cloud_slots_in_use", "Occupied upload/download and list slots.",
+		[]string{"tenant", "kind"}, slots(func(q limiter.QueueState) int { return q.InUse }))
+	reg.NewGaugeFunc("cloud_slots_capacity", "Max upload/download and list slots.",
+		[]string{"tenant", "kind"}, slots(func(q limiter.QueueState) int { return q.Capacity }))
+	reg.NewGaugeFunc("cloud_slots_waiting", "Calls waiting for upload/download and list slots.",
+		[]string{"tenant", "kind"}, slots(func(q limiter.QueueState) int { return q.Waiting }))
+
+	storage := func(get func(t *tenant) (float64, bool)) func(emit func(v float64, values ...string)) {
+		return func(emit func(v float64, values ...string)) {
+			for _, t := range s.sortedTenants() {
+				if v, ok := get(t); ok {
+					emit(v, t.name)
+				}
+			}
+		}
+	}
+	reg.NewGaugeFunc("cloud_storage_images", "Stored images.", []string{"tenant"},
+		storage(func(t *tenant) (float64, bool) {
+			stats, err := t.stats()
+			return float64(stats.Images), err == nil
+		}))
+	reg.NewGaugeFunc("cloud_storage_bytes", "Size of stored images.", []string{"tenant"},
+		storage(func(t *tenant) (float64, bool) {
+			stats, err := t.stats()
+			return float64(stats.Bytes), err == nil
+		}))
+	reg.NewGaugeFunc("cloud_tmp_files", "Files in tmp folder: uploads in progress or left by failures.",
+		[]string{"tenant"}, storage(func(t *tenant) (float64, bool) {
+			stats, err := t.stats()
+			return float64(stats.TmpFiles), err == nil
+		}))
+}
+
+func (s *Server) sortedTenants() []*tenant {
+	res := make([]*tenant, 0, len(s.tenants))
+	for _, t := range s.tenants {
+		res = append(res, t)
+	}
+	slices.SortFunc(res, func(a, b *tenant) int {
+		return cmp.Compare(a.name, b.name)
+	})
+	return res
+}
+
+// rejectUpload counts rejected upload.
+func (t *tenant) rejectUpload(reason string) {
+	t.metrics.uploadsRejected.Inc(t.name, reason)
+}
+
+// rejectAdmission counts call rejected by limits.
+func (t *tenant) rejectAdmission(reason string) {
+	t.metrics.admissionRejected.Inc(t.name, reason)
+}
+
+// transferred counts image bytes of upload or download.
+func (t *tenant) transferred(direction string, n int) {
+	t.metrics.transferBytes.Add(float64(n), t.name, direction)
+}
+
+// stats returns storage stats, error is logged as scrape can't report it.
+func (t *tenant) stats() (models.StorageStats, error) {
+	const fn = "cloud.stats"
+
+	stats, err := t.cloud.Stats(context.Background())
+	if err != nil {
+		t.log.Error(err.Error(), slog.String("fn", fn))
+	}
+	return stats, err
+}
@@ -0,0 +1,89 @@
+package cloud
+
+import (
+	"cloud/internal/domain/models"
+	"cloud/internal/grpc/rbac"
+	"cloud/internal/storage/drive"
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"os"
+	"slices"
+)
+
+// checkImageScope checks that existing image is within the caller scope.
+func (t *tenant) checkImageScope(ctx context.Context, fn string, filename string) error {
+	scope := rbac.ScopeFromContext(ctx)
+	if scope == nil {
+		return nil
+	}
+
+	// images without metadata have no tags
+	meta, err := t.cloud.GetMeta(ctx, filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
+		return status.Error(codes.Internal, ErrInternal.Error())
+	}
+
+	return t.checkScope(ctx, fn, filename, meta.Tags)
+}
+
+// checkScope checks that image with the tags is within the caller scope.
+func (t *tenant) checkScope(ctx context.Context, fn string, filename string, tags []string) error {
+	if !rbac.ScopeFromContext(ctx).Allows(filename, tags) {
+		t.log.WarnContext(ctx, ErrOutOfScope.Error(), slog.String("fn", fn), slog.String("filename", filename))
+		return status.Error(codes.PermissionDenied, ErrOutOfScope.Error())
+	}
+	return nil
+}
+
+// checkFolderScope checks that folder is within the caller scope.
+// Listing also allows folders leading to the scope.
+func (t *tenant) checkFolderScope(ctx context.Context, fn string, folder string, listing bool) error {
+	scope := rbac.ScopeFromContext(ctx)
+	allowed := scope.AllowsFolder(folder)
+	if listing {
+		allowed = scope.Visible(folder)
+	}
+	if !allowed {
+		t.log.WarnContext(ctx, ErrOutOfScope.Error(), slog.String("fn", fn), slog.String("folder", folder))
+		return status.Error(codes.PermissionDenied, ErrOutOfScope.Error())
+	}
+	return nil
+}
+
+// scopeImages drops images outside the caller scope.
+func scopeImages(ctx context.Context, images []drive.Image) []drive.Image {
+	scope := rbac.ScopeFromContext(ctx)
+	if scope == nil {
+		return images
+	}
+	return slices.DeleteFunc(images, func(image drive.Image) bool {
+		return !scope.Allows(image.Name, image.Tags)
+	})
+}
+
+// scopeFolders drops folders which neither are within the caller scope nor lead to it.
+func scopeFolders(ctx context.Context, folders []string) []string {
+	scope := rbac.ScopeFromContext(ctx)
+	if scope == nil {
+		return folders
+	}
+	return slices.DeleteFunc(folders, func(folder string) bool {
+		return !scope.Visible(folder)
+	})
+}
+
+// scopeSimilar drops similar images outside the caller scope.
+func (t *tenant) scopeSimilar(ctx context.Context, similar []models.Similar) []models.Similar {
+	scope := rbac.ScopeFromContext(ctx)
+	if scope == nil {
+		return similar
+	}
+	return slices.DeleteFunc(similar, func(image models.Similar) bool {
+		meta, _ := t.cloud.GetMeta(ctx, image.Name)
+		return !scope.Allows(image.Name, meta.Tags)
+	})
+}
@@ -0,0 +1,55 @@
+package cloud
+
+import (
+	"cloud/internal/grpc/rbac"
+	"cloud/internal/search"
+	"cloud/pkg/cloudv1"
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log/slog"
+)
+
+// Search returns images matching the query.
+func (s *Server) Search(ctx context.Context, req *cloudv1.SearchRequest) (*cloudv1.SearchResponse, error) {
+	const fn = "cloud.Search"
+
+	t, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := t.acquire(ctx, fn, t.limitList, t.client(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// scoped results are limited after filtering
+	limit := int(req.GetLimit())
+	scoped := rbac.ScopeFromContext(ctx) != nil
+	if scoped {
+		limit = 0
+	}
+
+	images, err := t.cloud.Search(ctx, req.GetQuery(), limit)
+	if err != nil {
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+		if errors.Is(err, search.ErrInvalidQuery) {
+			return nil, status.Error(codes.InvalidArgument, search.ErrInvalidQuery.Error())
+		}
+		return nil, status.Error(codes.Internal, ErrInternal.Error())
+	}
+
+	if scoped {
+		images = scopeImages(ctx, images)
+		if req.GetLimit() > 0 && len(images) > int(req.GetLimit()) {
+			images = images[:req.GetLimit()]
+		}
+	}
+
+	return &cloudv1.SearchResponse{
+		Files: fileStructures(images),
+	}, nil
+}
@@ -3,49 +3,85 @@ package cloud
 import (
 	"bufio"
 	"bytes"
-	"cloud/internal/config"
+	"cloud/internal/domain/models"
+	"cloud/internal/metrics"
+	service "cloud/internal/services/cloud"
 	"cloud/internal/storage"
 	"cloud/internal/storage/drive"
 	"cloud/pkg/cloudv1"
 	"context"
 	"errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"io"
 	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
+	"sync/atomic"
+	"time"
 )
 
+// tracer traces stages of calls, call spans are started by otelgrpc stats handler.
+var tracer = otel.Tracer("cloud/internal/grpc/cloud")
+
 type Cloud interface {
-	Upload(filename string, buf bytes.Buffer) error
-	CanUpload(filename string) (bool, error)
-	List() ([]drive.Image, error)
-	Search(filename string) (*os.File, error)
+	Upload(ctx context.Context, filename string, buf bytes.Buffer, opts models.UploadOptions) (string, error)
+	CanUpload(ctx context.Context, filename string) (bool, error)
+	List(ctx context.Context, filter string) ([]drive.Image, error)
+	Open(ctx context.Context, filename string) (*os.File, error)
+	Delete(ctx context.Context, filename string) error
+	FindSimilar(ctx context.Context, filename string, threshold int) ([]models.Similar, error)
+	GetMeta(ctx context.Context, filename string) (drive.Meta, error)
+	SetMetadata(ctx context.Context, filename string, metadata map[string]string, replace bool) (drive.Meta, error)
+	AddTags(ctx context.Context, filename string, tags []string) (drive.Meta, error)
+	RemoveTags(ctx context.Context, filename string, tags []string) (drive.Meta, error)
+	CreateFolder(ctx context.Context, folder string) error
+	ListFolder(ctx context.Context, folder string, recursive bool) ([]string, []drive.Image, error)
+	MoveToFolder(ctx context.Context, filename string, folder string) (string, error)
+	Search(ctx context.Context, query string, limit int) ([]drive.Image, error)
+	Stats(ctx context.Context) (models.StorageStats, error)
+	CleanTmp(ctx context.Context, olderThan time.Duration) (int, error)
+	Reindex(ctx context.Context) (int, error)
 }
 
 type Server struct {
 	cloudv1.UnimplementedCloudServer
-	cloud     Cloud
 	log       *slog.Logger
-	cfg       config.CloudConfig
-	limitUD   chan struct{}
-	limitList chan struct{}
+	def       string
+	tenants   map[string]*tenant
+	links     ShareLinks
+	transfers *transfers
+	// readOnly rejects calls which change images
+	readOnly atomic.Bool
 }
 
+// New creates server for the tenants. The first tenant is used for calls without tenant in context.
+// Nil links disable share links. Server metrics are registered in reg.
 func New(
-	cloud Cloud,
 	log *slog.Logger,
-	cfg config.CloudConfig,
+	tenants []Tenant,
+	links ShareLinks,
+	reg *metrics.Registry,
 ) *Server {
-	return &Server{
-		cloud:     cloud,
+	s := &Server{
 		log:       log,
-		cfg:       cfg,
-		limitUD:   make(chan struct{}, cfg.LimitUD),
-		limitList: make(chan struct{}, cfg.LimitList),
+		tenants:   make(map[string]*tenant, len(tenants)),
+		links:     links,
+		transfers: newTransfers(),
+	}
+	m := newServerMetrics(reg)
+	for i, t := range tenants {
+		if i == 0 {
+			s.def = t.Name
+		}
+		s.tenants[t.Name] = newTenant(log, t, m)
 	}
+	s.registerGauges(reg)
+	return s
 }
 
 func Register(gRPC *grpc.Server, server *Server) {
@@ -53,84 +89,187 @@ func Register(gRPC *grpc.Server, server *Server) {
 }
 
 // Upload save image on storage.
-func (s *Server) Upload(stream cloudv1.Cloud_UploadServer) error {
+func (s *Server) Upload(stream cloudv1.Cloud_UploadServer) (err error) {
 	const fn = "cloud.Upload"
 
-	s.limitUD <- struct{}{}
-	defer func() {
-		<-s.limitUD
-	}()
+	t, err := s.tenant(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	client := t.client(stream.Context())
+
+	// shutdown cuts off transfers which outlast the drain timeout
+	ctx, tr, done := s.transfers.start(stream.Context(), directionUpload, t.name, client)
+	defer func() { done(err) }()
+
+	release, err := t.acquire(ctx, fn, t.limitUD, client)
+	if err != nil {
+		return err
+	}
+	defer release()
 
-	s.log.Info("upload/download clients", slog.String("fn", fn), slog.Int("current", len(s.limitUD)),
-		slog.Int("max", cap(s.limitUD)))
+	t.logSlots(ctx, "upload/download clients", fn, t.limitUD)
 
-	// get filename
-	req, err := stream.Recv()
+	// get image info
+	req, err := recv(ctx, stream.Recv)
 	if err != nil {
-		s.log.Error(err.Error(), slog.String("fn", fn))
+		if err := t.checkCutOff(ctx, fn); err != nil {
+			return err
+		}
+		t.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
 		return status.Errorf(codes.Internal, ErrInternal.Error())
 	}
+	info := uploadInfo(req)
 
 	// check errors
-	filename := filepath.Base(req.GetName())
+	filename := filepath.Base(info.GetName())
 	if filename == "" {
-		s.log.Info(ErrEmptyFilename.Error(), slog.String("fn", fn))
+		t.log.InfoContext(ctx, ErrEmptyFilename.Error(), slog.String("fn", fn))
+		t.rejectUpload(rejectName)
 		return status.Error(codes.InvalidArgument, ErrEmptyFilename.Error())
 	}
+	folder, err := storage.CleanPath(info.GetFolder())
+	if err != nil {
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+		t.rejectUpload(rejectName)
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	filename, err = imageName(path.Join(folder, filename))
+	if err != nil {
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+		t.rejectUpload(rejectName)
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	tr.setImage(filename, 0)
+
+	// policy may be reloaded during the upload
+	cfg := t.policy()
 	ext := filepath.Ext(filename)
-	if _, ok := s.cfg.AvailableExt[ext]; !ok {
-		err = &ErrImageExt{s.cfg.AvailableExt}
-		s.log.Info(err.Error(), slog.String("fn", fn))
+	policy, ok := cfg.AvailableExt[ext]
+	if !ok {
+		err = &ErrImageExt{cfg.AvailableExt}
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+		t.rejectUpload(rejectExt)
 		return status.Error(codes.InvalidArgument, err.Error())
 	}
 
+	if err := t.checkScope(ctx, fn, filename, info.GetTags()); err != nil {
+		t.rejectUpload(rejectScope)
+		return err
+	}
+
 	// checking whether we can upload the file to the server
-	can, err := s.cloud.CanUpload(filename)
+	can, err := t.cloud.CanUpload(ctx, filename)
 	if err != nil {
-		s.log.Info(err.Error(), slog.String("fn", fn))
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
 		return status.Error(codes.Internal, ErrInternal.Error())
 	}
 	if !can {
-		s.log.Info(storage.ErrFileExists.Error(), slog.String("fn", fn))
+		t.log.InfoContext(ctx, storage.ErrFileExists.Error(), slog.String("fn", fn))
+		t.rejectUpload(rejectExists)
 		return status.Error(codes.AlreadyExists, storage.ErrFileExists.Error())
 	}
 
 	buf := bytes.Buffer{}
 	size := 0
 
+	_, receive := tracer.Start(ctx, "cloud.receive")
+	defer receive.End()
 	for {
-		req, err := stream.Recv()
+		if err := t.checkCutOff(ctx, fn); err != nil {
+			return err
+		}
+
+		req, err := recv(ctx, stream.Recv)
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			s.log.Error(err.Error(), slog.String("fn", fn))
+			if err := t.checkCutOff(ctx, fn); err != nil {
+				return err
+			}
+			t.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
 			return status.Errorf(codes.Internal, ErrInternal.Error())
 		}
 
 		chunk := req.GetChunk()
 		size += len(chunk)
+		tr.bytes.Add(int64(len(chunk)))
 
-		if size > s.cfg.MaxImageSize {
-			err = &ErrImageMaxSize{maxImageSize: s.cfg.MaxImageSize}
-			s.log.Info(err.Error(), slog.String("fn", fn))
+		if maxSize := maxSize(cfg, policy); size > maxSize {
+			err = &ErrImageMaxSize{maxImageSize: maxSize}
+			t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+			t.rejectUpload(rejectSize)
 			return status.Errorf(codes.InvalidArgument, err.Error())
 		}
 
+		if err := t.throttle(ctx, fn, client, len(chunk)); err != nil {
+			return err
+		}
+
 		_, err = buf.Write(chunk)
 		if err != nil {
-			s.log.Error(err.Error(), slog.String("fn", fn))
+			t.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
 			return status.Errorf(codes.Internal, ErrInternal.Error())
 		}
 	}
 
+	receive.SetAttributes(attribute.Int("size", size))
+	receive.End()
+
+	// decode image header and check dimensions before anything decodes the image
+	_, validate := tracer.Start(ctx, "cloud.validate")
+	defer validate.End()
+	err = checkDimensions(cfg, buf.Bytes())
+	if err != nil {
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+		t.rejectUpload(rejectDimensions)
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// check content against format policy
+	mime, err := t.checkFormat(buf.Bytes(), policy)
+	if err != nil {
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+		t.rejectUpload(rejectFormat)
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	validate.End()
+
+	opts := models.UploadOptions{
+		RejectSimilar:       info.GetRejectSimilar(),
+		SimilarityThreshold: t.threshold(info.SimilarityThreshold),
+		MIME:                mime,
+		TranscodeTo:         policy.TranscodeTo,
+		Tags:                info.GetTags(),
+		Metadata:            info.GetMetadata(),
+	}
+
 	// call service layer
-	err = s.cloud.Upload(filename, buf)
+	filename, err = t.cloud.Upload(ctx, filename, buf, opts)
 	if err != nil {
-		s.log.Error(err.Error(), slog.String("fn", fn))
+		if err := t.checkCutOff(ctx, fn); err != nil {
+			return err
+		}
+		t.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
 		if errors.Is(err, storage.ErrFileExists) {
+			t.rejectUpload(rejectExists)
 			return status.Errorf(codes.AlreadyExists, err.Error())
 		}
+		if errors.Is(err, storage.ErrSimilarExists) {
+			t.rejectUpload(rejectSimilar)
+			return status.Error(codes.AlreadyExists, storage.ErrSimilarExists.Error())
+		}
+		if errors.Is(err, storage.ErrInvalidImage) {
+			t.rejectUpload(rejectInvalidImage)
+			return status.Error(codes.InvalidArgument, storage.ErrInvalidImage.Error())
+		}
+		if errors.Is(err, service.ErrInvalidTag) || errors.Is(err, service.ErrInvalidMetadata) {
+			t.rejectUpload(rejectLabels)
+			return status.Error(codes.InvalidArgument, ErrInvalidLabels.Error())
+		}
 		return status.Errorf(codes.Internal, ErrInternal.Error())
 	}
 
@@ -140,96 +279,262 @@ func (s *Server) Upload(stream cloudv1.Cloud_UploadServer) error {
 	})
 
 	if err != nil {
-		s.log.Error(err.Error(), slog.String("fn", fn))
+		t.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
 		return status.Errorf(codes.Internal, ErrInternal.Error())
 	}
 
-	s.log.Info("file uploaded", slog.String("fn", fn), slog.String("filename", filename))
+	t.transferred(directionUpload, size)
+	t.log.InfoContext(ctx, "file uploaded", slog.String("fn", fn), slog.String("filename", filename))
 
 	return nil
 }
 
+// uploadInfo returns image info from the first upload message.
+// Old clients send only the image name.
+func uploadInfo(req *cloudv1.UploadRequest) *cloudv1.UploadInfo {
+	if info := req.GetInfo(); info != nil {
+		return info
+	}
+	return &cloudv1.UploadInfo{Name: req.GetName()}
+}
+
+// imageName normalizes image name from request.
+func imageName(name string) (string, error) {
+	name, err := storage.CleanPath(name)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return "", ErrEmptyFilename
+	}
+	return name, nil
+}
+
+// threshold returns similarity threshold requested by client or default one from config if it isn't set.
+func (t *tenant) threshold(requested *uint32) int {
+	if requested == nil {
+		return t.policy().SimilarityThreshold
+	}
+	return int(*requested)
+}
+
 // List returns list of images.
-func (s *Server) List(context.Context, *cloudv1.ListRequest) (*cloudv1.ListResponse, error) {
+func (s *Server) List(ctx context.Context, req *cloudv1.ListRequest) (*cloudv1.ListResponse, error) {
 	const fn = "cloud.List"
 
-	s.limitList <- struct{}{}
-	defer func() {
-		<-s.limitList
-	}()
+	t, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := t.acquire(ctx, fn, t.limitList, t.client(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
-	s.log.Info("images list clients", slog.String("fn", fn), slog.Int("current",
-		len(s.limitList)), slog.Int("max", cap(s.limitList)))
+	t.logSlots(ctx, "images list clients", fn, t.limitList)
 
-	images, err := s.cloud.List()
+	images, err := t.cloud.List(ctx, req.GetFilter())
 	if err != nil {
-		s.log.Info(err.Error(), slog.String("fn", fn))
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+		if errors.Is(err, service.ErrInvalidFilter) {
+			return nil, status.Error(codes.InvalidArgument, service.ErrInvalidFilter.Error())
+		}
 		return nil, status.Errorf(codes.Internal, ErrInternal.Error())
 	}
 
+	return &cloudv1.ListResponse{
+		Files: fileStructures(scopeImages(ctx, images)),
+	}, nil
+}
+
+func fileStructures(images []drive.Image) []*cloudv1.FileStructure {
 	res := make([]*cloudv1.FileStructure, 0, len(images))
 	for _, image := range images {
 		file := &cloudv1.FileStructure{
-			Name:      image.Name,
-			CreatedAt: image.CreatedAt,
-			UpdatedAt: image.UpdatedAt,
+			Name:          image.Name,
+			CreatedAt:     image.CreatedAt,
+			UpdatedAt:     image.UpdatedAt,
+			BlurHash:      image.BlurHash,
+			DominantColor: image.DominantColor,
+			Tags:          image.Tags,
+			Metadata:      image.Metadata,
 		}
 		res = append(res, file)
 	}
-
-	return &cloudv1.ListResponse{
-		Files: res,
-	}, nil
+	return res
 }
 
 // Download downloads image from storage.
-func (s *Server) Download(req *cloudv1.DownloadRequest, stream cloudv1.Cloud_DownloadServer) error {
+func (s *Server) Download(req *cloudv1.DownloadRequest, stream cloudv1.Cloud_DownloadServer) (err error) {
 	const fn = "cloud.Download"
 
-	s.limitUD <- struct{}{}
-	defer func() {
-		<-s.limitUD
-	}()
+	t, err := s.tenant(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	client := t.client(stream.Context())
+
+	// shutdown cuts off transfers which outlast the drain timeout
+	ctx, tr, done := s.transfers.start(stream.Context(), directionDownload, t.name, client)
+	defer func() { done(err) }()
+
+	release, err := t.acquire(ctx, fn, t.limitUD, client)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	t.logSlots(ctx, "upload/download clients", fn, t.limitUD)
+
+	filename, err := imageName(req.GetName())
+	if err != nil {
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
 
-	s.log.Info("upload/download clients", slog.String("fn", fn), slog.Int("current",
-		len(s.limitUD)), slog.Int("max", cap(s.limitUD)))
+	if err := t.checkImageScope(ctx, fn, filename); err != nil {
+		return err
+	}
 
-	filename := req.GetName()
-	file, err := s.cloud.Search(filename)
+	file, err := t.cloud.Open(ctx, filename)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return status.Errorf(codes.NotFound, ErrNotExist.Error())
 		}
-		s.log.Info(err.Error(), slog.String("fn", fn))
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
 		return status.Errorf(codes.Internal, ErrInternal.Error())
 	}
 	defer file.Close()
 
+	var size int64
+	if info, err := file.Stat(); err == nil {
+		size = info.Size()
+	}
+	tr.setImage(filename, size)
+
 	r := bufio.NewReader(file)
 
 	// recommended chunk size for streamed messages appears to be 16-64KiB
 	chunk := make([]byte, 64*1024)
 	for {
+		if err := t.checkCutOff(ctx, fn); err != nil {
+			return err
+		}
+
 		n, err := r.Read(chunk)
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			s.log.Error(err.Error(), slog.String("fn", fn))
+			t.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
 			return status.Errorf(codes.Internal, ErrInternal.Error())
 		}
 
+		if err := t.throttle(ctx, fn, client, n); err != nil {
+			return err
+		}
+
 		data := &cloudv1.DownloadResponse{
 			Chunk: chunk[:n],
 		}
 
-		if err := stream.Send(data); err != nil {
-			s.log.Error(err.Error(), slog.String("fn", fn))
+		if err := send(ctx, stream.Send, data); err != nil {
+			if err := t.checkCutOff(ctx, fn); err != nil {
+				return err
+			}
+			t.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
 			return status.Errorf(codes.Internal, ErrInternal.Error())
 		}
+		t.transferred(directionDownload, n)
+		tr.bytes.Add(int64(n))
 	}
 
-	s.log.Info("file downloaded", slog.String("fn", fn), slog.String("filename", filename))
+	t.log.InfoContext(ctx, "file downloaded", slog.String("fn", fn), slog.String("filename", filename))
 
 	return nil
 }
+
+// FindSimilar returns images visually similar to the given one.
+func (s *Server) FindSimilar(ctx context.Context, req *cloudv1.FindSimilarRequest) (*cloudv1.FindSimilarResponse, error) {
+	const fn = "cloud.FindSimilar"
+
+	t, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := t.acquire(ctx, fn, t.limitList, t.client(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	filename, err := imageName(req.GetName())
+	if err != nil {
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := t.checkImageScope(ctx, fn, filename); err != nil {
+		return nil, err
+	}
+
+	similar, err := t.cloud.FindSimilar(ctx, filename, t.threshold(req.Threshold))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, status.Errorf(codes.NotFound, ErrNotExist.Error())
+		}
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+		return nil, status.Errorf(codes.Internal, ErrInternal.Error())
+	}
+
+	similar = t.scopeSimilar(ctx, similar)
+
+	res := make([]*cloudv1.SimilarImage, 0, len(similar))
+	for _, image := range similar {
+		res = append(res, &cloudv1.SimilarImage{
+			Name:     image.Name,
+			Distance: uint32(image.Distance),
+		})
+	}
+
+	return &cloudv1.FindSimilarResponse{
+		Images: res,
+	}, nil
+}
+
+// Delete removes image from storage.
+func (s *Server) Delete(ctx context.Context, req *cloudv1.DeleteRequest) (*cloudv1.DeleteResponse, error) {
+	const fn = "cloud.Delete"
+
+	t, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	filename, err := imageName(req.GetName())
+	if err != nil {
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := t.checkImageScope(ctx, fn, filename); err != nil {
+		return nil, err
+	}
+
+	err = t.cloud.Delete(ctx, filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, status.Errorf(codes.NotFound, ErrNotExist.Error())
+		}
+		t.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
+		return nil, status.Errorf(codes.Internal, ErrInternal.Error())
+	}
+
+	t.log.InfoContext(ctx, "file deleted", slog.String("fn", fn), slog.String("filename", filename))
+
+	return &cloudv1.DeleteResponse{}, nil
+}
@@ -0,0 +1,87 @@
+package cloud
+
+import (
+	"cloud/internal/share"
+	"cloud/pkg/cloudv1"
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// ShareLinks issues signed download links.
+type ShareLinks interface {
+	Create(tenant string, name string, ttl time.Duration, maxDownloads int) (string, time.Time, error)
+}
+
+// CreateShareLink returns signed expiring url to download image over http.
+func (s *Server) CreateShareLink(ctx context.Context, req *cloudv1.CreateShareLinkRequest) (*cloudv1.ShareLink, error) {
+	const fn = "cloud.CreateShareLink"
+
+	t, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.links == nil {
+		return nil, status.Error(codes.Unimplemented, ErrShareDisabled.Error())
+	}
+
+	filename, err := imageName(req.GetName())
+	if err != nil {
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := t.checkImageScope(ctx, fn, filename); err != nil {
+		return nil, err
+	}
+
+	if err := t.checkImageExists(ctx, fn, filename); err != nil {
+		return nil, err
+	}
+
+	ttl := time.Duration(req.GetTtlSeconds()) * time.Second
+	url, expiresAt, err := s.links.Create(t.name, filename, ttl, int(req.GetMaxDownloads()))
+	if err != nil {
+		t.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+		if errors.Is(err, share.ErrInvalidTTL) {
+			return nil, status.Error(codes.InvalidArgument, share.ErrInvalidTTL.Error())
+		}
+		return nil, status.Error(codes.Internal, ErrInternal.Error())
+	}
+
+	t.log.InfoContext(ctx, "share link created", slog.String("fn", fn), slog.String("filename", filename),
+		slog.Time("expires_at", expiresAt), slog.Uint64("max_downloads", uint64(req.GetMaxDownloads())))
+
+	return &cloudv1.ShareLink{
+		Url:       url,
+		ExpiresAt: expiresAt.Format(time.RFC3339),
+	}, nil
+}
+
+// checkImageExists checks that image is a file on storage.
+func (t *tenant) checkImageExists(ctx context.Context, fn string, filename string) error {
+	file, err := t.cloud.Open(ctx, filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return status.Error(codes.NotFound, ErrNotExist.Error())
+	}
+	if err != nil {
+		t.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
+		return status.Error(codes.Internal, ErrInternal.Error())
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		t.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
+		return status.Error(codes.Internal, ErrInternal.Error())
+	}
+	if !info.Mode().IsRegular() {
+		return status.Error(codes.NotFound, ErrNotExist.Error())
+	}
+	return nil
+}
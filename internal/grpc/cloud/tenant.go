@@ -0,0 +1,129 @@
+package cloud
+
+import (
+	"cloud/internal/config"
+	"cloud/internal/grpc/auth"
+	"cloud/internal/grpc/tenancy"
+	"cloud/internal/limiter"
+	"context"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"net"
+	"strings"
+	"sync/atomic"
+)
+
+// rateByIP tells clients apart by peer ip even if they are authenticated.
+const rateByIP = "ip"
+
+// Tenant is an isolated image store with its own policy.
+type Tenant struct {
+	Name  string
+	Cloud Cloud
+	Cfg   config.CloudConfig
+}
+
+// tenant holds service, policy and admission limits of a tenant.
+type tenant struct {
+	name      string
+	cloud     Cloud
+	log       *slog.Logger
+	cfg       atomic.Pointer[config.CloudConfig]
+	limitUD   *limiter.FairQueue
+	limitList *limiter.FairQueue
+	limits    *limiter.Limiter
+	metrics   *serverMetrics
+}
+
+func newTenant(log *slog.Logger, t Tenant, m *serverMetrics) *tenant {
+	res := &tenant{
+		name:      t.Name,
+		cloud:     t.Cloud,
+		log:       log.With(slog.String("tenant", t.Name)),
+		limitUD:   limiter.NewFairQueue(t.Cfg.LimitUD, t.Cfg.MaxQueue, t.Cfg.MaxWait),
+		limitList: limiter.NewFairQueue(t.Cfg.LimitList, t.Cfg.MaxQueue, t.Cfg.MaxWait),
+		limits:    limiter.New(limiterConfig(t.Cfg.RateLimit)),
+		metrics:   m,
+	}
+	res.cfg.Store(&t.Cfg)
+	return res
+}
+
+func limiterConfig(cfg config.RateLimitConfig) limiter.Config {
+	return limiter.Config{
+		Requests:       cfg.Requests,
+		RequestsBurst:  cfg.RequestsBurst,
+		Bandwidth:      cfg.Bandwidth,
+		BandwidthBurst: cfg.BandwidthBurst,
+	}
+}
+
+// policy returns current policy, a call should take it once to see consistent limits.
+func (t *tenant) policy() *config.CloudConfig {
+	return t.cfg.Load()
+}
+
+// setPolicy swaps the policy. Slots are resized without dropping their holders,
+// token balances of clients are kept.
+func (t *tenant) setPolicy(cfg config.CloudConfig) {
+	t.cfg.Store(&cfg)
+	t.limitUD.Resize(cfg.LimitUD, cfg.MaxQueue, cfg.MaxWait)
+	t.limitList.Resize(cfg.LimitList, cfg.MaxQueue, cfg.MaxWait)
+	t.limits.SetConfig(limiterConfig(cfg.RateLimit))
+}
+
+// client identifies the caller for rate limits and fair queuing.
+func (t *tenant) client(ctx context.Context) string {
+	if t.policy().RateLimit.By != rateByIP {
+		if p, ok := auth.FromContext(ctx); ok {
+			return "principal:" + p.Name
+		}
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "ip:unknown"
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+	return "ip:" + host
+}
+
+// UpdatePolicy swaps policy of the tenant and logs what changed. Calls in flight finish
+// with the policy they started with.
+func (s *Server) UpdatePolicy(name string, cfg config.CloudConfig) error {
+	const fn = "cloud.UpdatePolicy"
+
+	t, ok := s.tenants[name]
+	if !ok {
+		return fmt.Errorf("%s: %s: %w", fn, name, tenancy.ErrUnknownTenant)
+	}
+
+	changes := config.Diff(*t.policy(), cfg)
+	if len(changes) == 0 {
+		return nil
+	}
+	t.setPolicy(cfg)
+
+	t.log.Info("policy reloaded", slog.String("fn", fn), slog.String("changes", strings.Join(changes, "; ")))
+	return nil
+}
+
+// tenant returns tenant of the call.
+func (s *Server) tenant(ctx context.Context) (*tenant, error) {
+	name, ok := tenancy.FromContext(ctx)
+	if !ok {
+		name = s.def
+	}
+	t, ok := s.tenants[name]
+	if !ok {
+		s.log.InfoContext(ctx, tenancy.ErrUnknownTenant.Error(), slog.String("tenant", name))
+		return nil, status.Error(codes.InvalidArgument, tenancy.ErrUnknownTenant.Error())
+	}
+	return t, nil
+}
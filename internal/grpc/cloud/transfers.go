@@ -0,0 +1,280 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// transfer is in-flight upload or download.
+type transfer struct {
+	id        uint64
+	direction string
+	tenant    string
+	client    string
+	peer      string
+	started   time.Time
+	cancel    context.CancelCauseFunc
+
+	// name and size are set once known, bytes grows with every chunk
+	name  atomic.Value
+	size  atomic.Int64
+	bytes atomic.Int64
+}
+
+// setImage sets name of the transferred image and its size if known.
+func (t *transfer) setImage(name string, size int64) {
+	t.name.Store(name)
+	t.size.Store(size)
+}
+
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// TransferInfo is progress of in-flight upload or download.
+type TransferInfo struct {
+	ID        uint64
+	Direction string
+	Tenant    string
+	Client    string
+	Peer      string
+	Name      string
+	Bytes     int64
+	Size      int64
+	Started   time.Time
+}
+
+func (t *transfer) info() TransferInfo {
+	name, _ := t.name.Load().(string)
+	return TransferInfo{
+		ID:        t.id,
+		Direction: t.direction,
+		Tenant:    t.tenant,
+		Client:    t.client,
+		Peer:      t.peer,
+		Name:      name,
+		Bytes:     t.bytes.Load(),
+		Size:      t.size.Load(),
+		Started:   t.started,
+	}
+}
+
+// transfers tracks in-flight uploads and downloads, so shutdown can cut them off and wait for them.
+type transfers struct {
+	mu     sync.Mutex
+	nextID uint64
+	active map[uint64]*transfer
+	stats  TransferStats
+	idle   chan struct{}
+}
+
+// TransferStats counts finished transfers.
+type TransferStats struct {
+	Completed int
+	Failed    int
+	CutOff    int
+}
+
+func newTransfers() *transfers {
+	return &transfers{active: make(map[uint64]*transfer)}
+}
+
+// start registers transfer and returns its context which is cancelled if the transfer is cut off
+// or cancelled by admin. done must be called with the transfer result.
+func (tr *transfers) start(
+	ctx context.Context,
+	direction, tenant, client string,
+) (context.Context, *transfer, func(err error)) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	tr.nextID++
+	id := tr.nextID
+	t := &transfer{
+		id:        id,
+		direction: direction,
+		tenant:    tenant,
+		client:    client,
+		peer:      peerAddr(ctx),
+		started:   time.Now(),
+		cancel:    cancel,
+	}
+	tr.active[id] = t
+
+	return ctx, t, func(err error) {
+		tr.mu.Lock()
+		defer tr.mu.Unlock()
+
+		switch {
+		case errors.Is(context.Cause(ctx), ErrShuttingDown):
+			tr.stats.CutOff++
+		case err != nil:
+			tr.stats.Failed++
+		default:
+			tr.stats.Completed++
+		}
+		cancel(nil)
+
+		delete(tr.active, id)
+		if len(tr.active) == 0 && tr.idle != nil {
+			close(tr.idle)
+			tr.idle = nil
+		}
+	}
+}
+
+// cutOff cancels all in-flight transfers and returns their number.
+func (tr *transfers) cutOff() int {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	for _, t := range tr.active {
+		t.cancel(ErrShuttingDown)
+	}
+	return len(tr.active)
+}
+
+// cancel cancels in-flight transfer by id, false if there is no such transfer.
+func (tr *transfers) cancel(id uint64) bool {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	t, ok := tr.active[id]
+	if ok {
+		t.cancel(ErrTransferCancelled)
+	}
+	return ok
+}
+
+// list returns in-flight transfers ordered by start.
+func (tr *transfers) list() []TransferInfo {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	res := make([]TransferInfo, 0, len(tr.active))
+	for _, t := range tr.active {
+		res = append(res, t.info())
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
+// wait waits until there are no in-flight transfers or ctx is done.
+func (tr *transfers) wait(ctx context.Context) error {
+	tr.mu.Lock()
+	if len(tr.active) == 0 {
+		tr.mu.Unlock()
+		return nil
+	}
+	if tr.idle == nil {
+		tr.idle = make(chan struct{})
+	}
+	idle := tr.idle
+	tr.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (tr *transfers) state() (int, TransferStats) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	return len(tr.active), tr.stats
+}
+
+// recv receives the next message of the stream or returns cause of ctx once it's done first,
+// so cut off or cancelled upload doesn't wait for a client which stopped sending.
+// The pending receive ends when the call returns and grpc closes the stream.
+func recv[T any](ctx context.Context, recv func() (T, error)) (T, error) {
+	type result struct {
+		msg T
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		msg, err := recv()
+		done <- result{msg: msg, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.msg, res.err
+	case <-ctx.Done():
+		var zero T
+		return zero, context.Cause(ctx)
+	}
+}
+
+// send sends the message or returns cause of ctx once it's done first,
+// so cut off or cancelled download doesn't wait for a client which stopped reading.
+func send[T any](ctx context.Context, send func(T) error, msg T) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- send(msg)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// checkCutOff returns Unavailable if the transfer is cut off by shutdown and Aborted if it's cancelled by admin.
+func (t *tenant) checkCutOff(ctx context.Context, fn string) error {
+	switch cause := context.Cause(ctx); {
+	case errors.Is(cause, ErrShuttingDown):
+		t.log.InfoContext(ctx, cause.Error(), slog.String("fn", fn))
+		return status.Error(codes.Unavailable, cause.Error())
+	case errors.Is(cause, ErrTransferCancelled):
+		t.log.InfoContext(ctx, cause.Error(), slog.String("fn", fn))
+		return status.Error(codes.Aborted, cause.Error())
+	}
+	return nil
+}
+
+// CutOffTransfers cancels in-flight uploads and downloads and returns their number.
+// Aborted uploads don't leave tmp files.
+func (s *Server) CutOffTransfers() int {
+	return s.transfers.cutOff()
+}
+
+// WaitTransfers waits until in-flight uploads and downloads return or ctx is done.
+func (s *Server) WaitTransfers(ctx context.Context) error {
+	return s.transfers.wait(ctx)
+}
+
+// ActiveTransfers returns progress of in-flight uploads and downloads.
+func (s *Server) ActiveTransfers() []TransferInfo {
+	return s.transfers.list()
+}
+
+// CancelTransfer cancels in-flight upload or download, false if there is no such transfer.
+// Cancelled uploads don't leave tmp files.
+func (s *Server) CancelTransfer(id uint64) bool {
+	return s.transfers.cancel(id)
+}
+
+// Transfers returns number of in-flight transfers and counts of finished ones.
+func (s *Server) Transfers() (int, TransferStats) {
+	return s.transfers.state()
+}
@@ -0,0 +1,56 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRecvSend(t *testing.T) {
+	tests := []struct {
+		name string
+		// blocked is whether the client neither sends nor reads
+		blocked bool
+		cause   error
+		wantErr error
+	}{
+		{name: "completed"},
+		{name: "cancelled by admin", blocked: true, cause: ErrTransferCancelled, wantErr: ErrTransferCancelled},
+		{name: "cut off", blocked: true, cause: ErrShuttingDown, wantErr: ErrShuttingDown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unblock := make(chan struct{})
+			defer close(unblock)
+			wait := func() {
+				if tt.blocked {
+					<-unblock
+				}
+			}
+
+			ctx, cancel := context.WithCancelCause(context.Background())
+			defer cancel(nil)
+			if tt.cause != nil {
+				time.AfterFunc(10*time.Millisecond, func() { cancel(tt.cause) })
+			}
+
+			msg, err := recv(ctx, func() (string, error) {
+				wait()
+				return "chunk", nil
+			})
+			if !errors.Is(err, tt.wantErr) || (err == nil && msg != "chunk") {
+				t.Fatalf("recv() = %q, %v, want %v", msg, err, tt.wantErr)
+			}
+
+			err = send(ctx, func(string) error {
+				wait()
+				return nil
+			}, "chunk")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("send() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
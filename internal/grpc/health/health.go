@@ -0,0 +1,134 @@
+package health
+
+import (
+	"cloud/pkg/cloudv1"
+	"context"
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// defaultInterval is used if check interval isn't configured.
+const defaultInterval = 10 * time.Second
+
+// Checker reports whether a tenant can serve calls.
+type Checker interface {
+	Check(ctx context.Context, minFreeSpace uint64) error
+}
+
+// Health serves grpc.health.v1 with readiness of all tenants. The server ("") and Cloud service
+// are SERVING only while every tenant passes its check.
+type Health struct {
+	log          *slog.Logger
+	server       *grpchealth.Server
+	checkers     map[string]Checker
+	interval     time.Duration
+	minFreeSpace uint64
+
+	mu      sync.Mutex
+	serving bool
+	failed  map[string]string
+}
+
+// New creates health service which is NOT_SERVING until the first check. Zero interval is 10s.
+func New(
+	log *slog.Logger,
+	checkers map[string]Checker,
+	interval time.Duration,
+	minFreeSpace uint64,
+) *Health {
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	h := &Health{
+		log:          log,
+		server:       grpchealth.NewServer(),
+		checkers:     checkers,
+		interval:     interval,
+		minFreeSpace: minFreeSpace,
+		failed:       make(map[string]string),
+	}
+	h.setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	return h
+}
+
+func Register(gRPC *grpc.Server, h *Health) {
+	healthpb.RegisterHealthServer(gRPC, h.server)
+}
+
+// Run checks tenants every interval until ctx is done.
+func (h *Health) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		h.Check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check checks all tenants and updates serving status. Changes are logged.
+func (h *Health) Check(ctx context.Context) {
+	const fn = "health.Check"
+
+	failed := make(map[string]string)
+	for name, c := range h.checkers {
+		if err := c.Check(ctx, h.minFreeSpace); err != nil {
+			failed[name] = err.Error()
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for name, reason := range failed {
+		if h.failed[name] != reason {
+			h.log.Warn("tenant is not ready", slog.String("fn", fn), slog.String("tenant", name),
+				slog.String("reason", reason))
+		}
+	}
+	for name := range h.failed {
+		if _, ok := failed[name]; !ok {
+			h.log.Info("tenant is ready", slog.String("fn", fn), slog.String("tenant", name))
+		}
+	}
+	h.failed = failed
+
+	serving := len(failed) == 0
+	if serving == h.serving {
+		return
+	}
+	h.serving = serving
+
+	if serving {
+		h.setStatus(healthpb.HealthCheckResponse_SERVING)
+		h.log.Info("serving", slog.String("fn", fn))
+		return
+	}
+	names := make([]string, 0, len(failed))
+	for name := range failed {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	h.setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	h.log.Warn("not serving", slog.String("fn", fn), slog.Any("tenants", names))
+}
+
+// Shutdown sets NOT_SERVING permanently, so load balancers stop sending new calls.
+func (h *Health) Shutdown() {
+	h.server.Shutdown()
+}
+
+func (h *Health) setStatus(status healthpb.HealthCheckResponse_ServingStatus) {
+	h.server.SetServingStatus("", status)
+	h.server.SetServingStatus(cloudv1.Cloud_ServiceDesc.ServiceName, status)
+}
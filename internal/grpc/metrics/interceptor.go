@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"cloud/internal/metrics"
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// RPC are request count, latency and in-flight calls by method.
+type RPC struct {
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+	inFlight *metrics.GaugeVec
+}
+
+func New(reg *metrics.Registry) *RPC {
+	return &RPC{
+		requests: reg.NewCounterVec("cloud_grpc_requests_total",
+			"Handled gRPC calls by method and status code.", "method", "code"),
+		duration: reg.NewHistogramVec("cloud_grpc_request_duration_seconds",
+			"Duration of gRPC calls by method.", metrics.DefBuckets, "method"),
+		inFlight: reg.NewGaugeVec("cloud_grpc_requests_in_flight",
+			"gRPC calls being handled by method.", "method"),
+	}
+}
+
+// UnaryServerInterceptor observes unary calls. It must run first to count calls rejected by other interceptors.
+func UnaryServerInterceptor(m *RPC) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		done := m.start(info.FullMethod)
+		resp, err := handler(ctx, req)
+		done(err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor observes streaming calls. It must run first to count calls rejected by other interceptors.
+func StreamServerInterceptor(m *RPC) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		done := m.start(info.FullMethod)
+		err := handler(srv, ss)
+		done(err)
+		return err
+	}
+}
+
+// start marks the call in flight and returns func observing its result.
+func (m *RPC) start(method string) func(err error) {
+	start := time.Now()
+	m.inFlight.Add(1, method)
+
+	return func(err error) {
+		m.inFlight.Add(-1, method)
+		m.requests.Inc(method, status.Code(err).String())
+		m.duration.Observe(time.Since(start).Seconds(), method)
+	}
+}
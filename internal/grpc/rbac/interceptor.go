@@ -0,0 +1,107 @@
+package rbac
+
+import (
+	"cloud/internal/grpc/auth"
+	"context"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log/slog"
+)
+
+var ErrPermissionDenied = errors.New("permission denied")
+
+type scopeKey struct{}
+
+// WithScope returns context with the caller scope attached.
+func WithScope(ctx context.Context, scope *Scope) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+// ScopeFromContext returns the caller scope, nil means no restriction.
+func ScopeFromContext(ctx context.Context) *Scope {
+	scope, _ := ctx.Value(scopeKey{}).(*Scope)
+	return scope
+}
+
+// Authorizer checks calls against the policy.
+type Authorizer struct {
+	policy *Policy
+	log    *slog.Logger
+}
+
+func New(policy *Policy, log *slog.Logger) *Authorizer {
+	return &Authorizer{
+		policy: policy,
+		log:    log,
+	}
+}
+
+// Authorize checks the principal in context may call the method and returns its scope.
+func (a *Authorizer) Authorize(ctx context.Context, method string) (*Scope, error) {
+	var principal string
+	if p, ok := auth.FromContext(ctx); ok {
+		principal = p.Name
+	}
+
+	grant, ok := a.policy.grant(principal)
+	if !ok || !a.policy.Roles[grant.Role].allows(method) {
+		return nil, ErrPermissionDenied
+	}
+	return newScope(grant), nil
+}
+
+// UnaryServerInterceptor authorizes unary calls. It must run after auth interceptor.
+func UnaryServerInterceptor(a *Authorizer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := a.authorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor authorizes streaming calls. It must run after auth interceptor.
+func StreamServerInterceptor(a *Authorizer) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authorize(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func (a *Authorizer) authorize(ctx context.Context, method string) (context.Context, error) {
+	const fn = "rbac.authorize"
+
+	if auth.IsPublicMethod(method) {
+		return ctx, nil
+	}
+
+	scope, err := a.Authorize(ctx, method)
+	if err != nil {
+		p, _ := auth.FromContext(ctx)
+		a.log.WarnContext(ctx, err.Error(), slog.String("fn", fn), slog.String("method", method),
+			slog.String("principal", p.Name), slog.String("role", a.role(p.Name)))
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	return WithScope(ctx, scope), nil
+}
+
+func (a *Authorizer) role(principal string) string {
+	grant, _ := a.policy.grant(principal)
+	return grant.Role
+}
+
+// serverStream overrides context of the wrapped stream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
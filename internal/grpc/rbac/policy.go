@@ -0,0 +1,84 @@
+package rbac
+
+import (
+	"cloud/internal/storage"
+	"errors"
+	"fmt"
+	"github.com/ilyakaznacheev/cleanenv"
+	"path"
+	"slices"
+)
+
+// AnyPrincipal is a grant key used for callers without own grant, including anonymous ones.
+const AnyPrincipal = "*"
+
+// AnyMethod grants all methods.
+const AnyMethod = "*"
+
+var ErrInvalidPolicy = errors.New("invalid rbac policy")
+
+// Policy maps principals to roles and scopes.
+type Policy struct {
+	Roles      map[string]Role  `yaml:"roles"`
+	Principals map[string]Grant `yaml:"principals"`
+}
+
+// Role is a set of allowed methods. Method is a short RPC name, e.g. "List",
+// or a full method name, e.g. "/cloud.Cloud/List".
+type Role struct {
+	Methods []string `yaml:"methods"`
+}
+
+// Grant binds principal to a role restricted to folders and tags. Empty lists mean no restriction.
+type Grant struct {
+	Role    string   `yaml:"role"`
+	Folders []string `yaml:"folders"`
+	Tags    []string `yaml:"tags"`
+}
+
+// LoadPolicy reads policy from yaml file.
+func LoadPolicy(path string) (*Policy, error) {
+	const fn = "rbac.LoadPolicy"
+
+	var p Policy
+	if err := cleanenv.ReadConfig(path, &p); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	return &p, nil
+}
+
+// validate checks grants reference existing roles and normalizes folders.
+func (p *Policy) validate() error {
+	for name, grant := range p.Principals {
+		if _, ok := p.Roles[grant.Role]; !ok {
+			return fmt.Errorf("%w: principal %q has unknown role %q", ErrInvalidPolicy, name, grant.Role)
+		}
+		for i, folder := range grant.Folders {
+			folder, err := storage.CleanPath(folder)
+			if err != nil {
+				return fmt.Errorf("%w: principal %q: %w", ErrInvalidPolicy, name, err)
+			}
+			grant.Folders[i] = folder
+		}
+	}
+	return nil
+}
+
+// grant returns grant of the principal.
+func (p *Policy) grant(principal string) (Grant, bool) {
+	if grant, ok := p.Principals[principal]; ok && principal != "" {
+		return grant, true
+	}
+	grant, ok := p.Principals[AnyPrincipal]
+	return grant, ok
+}
+
+// allows reports whether the role grants the full method name.
+func (r Role) allows(method string) bool {
+	return slices.ContainsFunc(r.Methods, func(m string) bool {
+		return m == AnyMethod || m == method || m == path.Base(method)
+	})
+}
@@ -0,0 +1,176 @@
+package rbac
+
+import (
+	"cloud/internal/grpc/auth"
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testPolicy = `
+roles:
+  reader:
+    methods: ["List", "Download"]
+  uploader:
+    methods: ["List", "Download", "/cloud.Cloud/Upload"]
+  admin:
+    methods: ["*"]
+principals:
+  "root":
+    role: "admin"
+  "alice":
+    role: "uploader"
+    folders: ["albums/alice/"]
+  "guest":
+    role: "reader"
+    tags: ["public"]
+  "*":
+    role: "reader"
+`
+
+func writePolicy(t *testing.T, policy string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "rbac.yaml")
+	if err := os.WriteFile(path, []byte(policy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr bool
+	}{
+		{name: "valid", policy: testPolicy},
+		{name: "unknown role", policy: "principals:\n  bob:\n    role: writer\n", wantErr: true},
+		{name: "escaping folder", policy: "roles:\n  r: {}\nprincipals:\n  bob:\n    role: r\n    folders: [\"../x\"]\n",
+			wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadPolicy(writePolicy(t, tt.policy))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidPolicy) {
+				t.Fatalf("LoadPolicy() error = %v, want %v", err, ErrInvalidPolicy)
+			}
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	policy, err := LoadPolicy(writePolicy(t, testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := New(policy, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	tests := []struct {
+		name      string
+		principal string
+		method    string
+		wantScope *Scope
+		wantCode  codes.Code
+	}{
+		{name: "admin any method", principal: "root", method: "/cloud.Cloud/Delete"},
+		{name: "short name", principal: "guest", method: "/cloud.Cloud/List", wantScope: &Scope{Tags: []string{"public"}}},
+		{name: "full name", principal: "alice", method: "/cloud.Cloud/Upload",
+			wantScope: &Scope{Folders: []string{"albums/alice"}}},
+		{name: "not granted", principal: "alice", method: "/cloud.Cloud/Delete", wantCode: codes.PermissionDenied},
+		{name: "other principal", principal: "bob", method: "/cloud.Cloud/List"},
+		{name: "other principal not granted", principal: "bob", method: "/cloud.Cloud/Upload",
+			wantCode: codes.PermissionDenied},
+		{name: "anonymous", method: "/cloud.Cloud/Download"},
+		{name: "anonymous not granted", method: "/cloud.Cloud/Delete", wantCode: codes.PermissionDenied},
+		{name: "public method", method: "/grpc.health.v1.Health/Check"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.principal != "" {
+				ctx = auth.WithPrincipal(ctx, auth.Principal{Name: tt.principal, Method: auth.MethodAPIKey})
+			}
+
+			ctx, err := a.authorize(ctx, tt.method)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("authorize() error = %v, want code %v", err, tt.wantCode)
+			}
+			if err != nil {
+				return
+			}
+			if scope := ScopeFromContext(ctx); !reflect.DeepEqual(scope, tt.wantScope) {
+				t.Fatalf("ScopeFromContext() = %+v, want %+v", scope, tt.wantScope)
+			}
+		})
+	}
+}
+
+func TestAuthorizeWithoutFallback(t *testing.T) {
+	policy := &Policy{
+		Roles:      map[string]Role{"reader": {Methods: []string{"List"}}},
+		Principals: map[string]Grant{"guest": {Role: "reader"}},
+	}
+	a := New(policy, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// callers without grant are denied when the policy has no "*" grant
+	if _, err := a.Authorize(context.Background(), "/cloud.Cloud/List"); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("Authorize() error = %v, want %v", err, ErrPermissionDenied)
+	}
+}
+
+func TestScope(t *testing.T) {
+	tests := []struct {
+		name        string
+		scope       *Scope
+		image       string
+		tags        []string
+		wantAllows  bool
+		folder      string
+		wantVisible bool
+	}{
+		{name: "nil scope", image: "a.png", wantAllows: true, folder: "any", wantVisible: true},
+		{name: "in folder", scope: &Scope{Folders: []string{"albums/alice"}}, image: "albums/alice/a.png",
+			wantAllows: true, folder: "albums/alice/2024", wantVisible: true},
+		{name: "sibling folder", scope: &Scope{Folders: []string{"albums/alice"}}, image: "albums/alice2/a.png",
+			folder: "albums/alice2"},
+		{name: "root image", scope: &Scope{Folders: []string{"albums/alice"}}, image: "a.png",
+			folder: "albums", wantVisible: true},
+		{name: "tag", scope: &Scope{Tags: []string{"public"}}, image: "a.png", tags: []string{" Public "},
+			wantAllows: true, folder: "", wantVisible: true},
+		{name: "missing tag", scope: &Scope{Tags: []string{"public"}}, image: "a.png", tags: []string{"private"},
+			folder: "", wantVisible: true},
+		{name: "folder and tag", scope: &Scope{Folders: []string{"shared"}, Tags: []string{"public"}},
+			image: "shared/a.png", tags: []string{"public"}, wantAllows: true, folder: "shared", wantVisible: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.scope.Allows(tt.image, tt.tags); got != tt.wantAllows {
+				t.Errorf("Allows(%q, %q) = %v, want %v", tt.image, tt.tags, got, tt.wantAllows)
+			}
+			if got := tt.scope.Visible(tt.folder); got != tt.wantVisible {
+				t.Errorf("Visible(%q) = %v, want %v", tt.folder, got, tt.wantVisible)
+			}
+		})
+	}
+}
+
+func TestShippedPolicy(t *testing.T) {
+	// the policy next to config/dev.yaml must stay loadable
+	if _, err := LoadPolicy(filepath.Join("..", "..", "..", "config", "rbac.yaml")); err != nil {
+		t.Fatalf("LoadPolicy() error = %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package rbac
+
+import (
+	"path"
+	"slices"
+	"strings"
+)
+
+// Scope restricts images available to the principal. Nil scope allows everything.
+type Scope struct {
+	// Folders are allowed folders with their subfolders.
+	Folders []string
+	// Tags are tags of which an image must have at least one.
+	Tags []string
+}
+
+func newScope(grant Grant) *Scope {
+	if len(grant.Folders) == 0 && len(grant.Tags) == 0 {
+		return nil
+	}
+	return &Scope{Folders: grant.Folders, Tags: grant.Tags}
+}
+
+// Allows reports whether the image with tags is within the scope.
+func (s *Scope) Allows(name string, tags []string) bool {
+	if s == nil {
+		return true
+	}
+	return s.AllowsFolder(folderOf(name)) && s.allowsTags(tags)
+}
+
+// AllowsFolder reports whether the folder is one of scope folders or their subfolder.
+func (s *Scope) AllowsFolder(folder string) bool {
+	if s == nil || len(s.Folders) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(s.Folders, func(allowed string) bool {
+		return isWithin(folder, allowed)
+	})
+}
+
+// Visible reports whether the folder may be listed: it is allowed or leads to an allowed folder.
+func (s *Scope) Visible(folder string) bool {
+	if s.AllowsFolder(folder) {
+		return true
+	}
+	return slices.ContainsFunc(s.Folders, func(allowed string) bool {
+		return isWithin(allowed, folder)
+	})
+}
+
+func (s *Scope) allowsTags(tags []string) bool {
+	if len(s.Tags) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(tags, func(tag string) bool {
+		return slices.ContainsFunc(s.Tags, func(allowed string) bool {
+			return strings.EqualFold(strings.TrimSpace(tag), allowed)
+		})
+	})
+}
+
+// isWithin reports whether folder equals parent or is inside it. Empty parent is the root.
+func isWithin(folder, parent string) bool {
+	return parent == "" || folder == parent || strings.HasPrefix(folder, parent+"/")
+}
+
+func folderOf(name string) string {
+	dir := path.Dir(name)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
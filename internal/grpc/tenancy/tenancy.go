@@ -0,0 +1,160 @@
+package tenancy
+
+import (
+	"cloud/internal/grpc/auth"
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"slices"
+)
+
+// Header is request metadata key to select tenant.
+const Header = "x-tenant"
+
+var (
+	ErrUnknownTenant = errors.New("unknown tenant")
+	ErrForbidden     = errors.New("tenant is not allowed for the principal")
+)
+
+type (
+	tenantKey struct{}
+	trackKey  struct{}
+)
+
+// WithTenant returns context with the tenant name attached.
+func WithTenant(ctx context.Context, name string) context.Context {
+	if t, ok := ctx.Value(trackKey{}).(*string); ok {
+		*t = name
+	}
+	return context.WithValue(ctx, tenantKey{}, name)
+}
+
+// Track returns context which remembers tenant attached to contexts derived from it.
+// It lets interceptors running before tenant resolution see the tenant once the call is done.
+func Track(ctx context.Context) (context.Context, func() (string, bool)) {
+	var name string
+	return context.WithValue(ctx, trackKey{}, &name), func() (string, bool) {
+		return name, name != ""
+	}
+}
+
+// FromContext returns tenant name attached by the tenancy interceptors.
+func FromContext(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(tenantKey{}).(string)
+	return name, ok
+}
+
+// Resolver resolves tenant of a call.
+//
+// Principal mapped to tenants uses the first one, x-tenant header selects among them.
+// Others, including anonymous calls, use only the default tenant.
+type Resolver struct {
+	def         string
+	tenants     map[string]struct{}
+	byPrincipal map[string][]string
+}
+
+// NewResolver creates resolver. Principals maps tenant name to principals allowed to use it.
+func NewResolver(def string, principals map[string][]string) *Resolver {
+	r := &Resolver{
+		def:         def,
+		tenants:     map[string]struct{}{def: {}},
+		byPrincipal: make(map[string][]string),
+	}
+	for tenant, names := range principals {
+		r.tenants[tenant] = struct{}{}
+		for _, name := range names {
+			r.byPrincipal[name] = append(r.byPrincipal[name], tenant)
+		}
+	}
+	for _, tenants := range r.byPrincipal {
+		slices.Sort(tenants)
+	}
+	return r
+}
+
+// Resolve returns tenant name of the call.
+func (r *Resolver) Resolve(ctx context.Context) (string, error) {
+	requested := header(ctx)
+	if requested != "" {
+		if _, ok := r.tenants[requested]; !ok {
+			return "", fmt.Errorf("%w: %q", ErrUnknownTenant, requested)
+		}
+	}
+
+	// anonymous calls aren't mapped to tenants
+	var allowed []string
+	if p, ok := auth.FromContext(ctx); ok {
+		allowed = r.byPrincipal[p.Name]
+	}
+
+	switch {
+	case len(allowed) == 0 && (requested == "" || requested == r.def):
+		return r.def, nil
+	case len(allowed) == 0:
+		return "", ErrForbidden
+	case requested == "":
+		return allowed[0], nil
+	case slices.Contains(allowed, requested):
+		return requested, nil
+	}
+	return "", ErrForbidden
+}
+
+// UnaryServerInterceptor attaches tenant to unary calls. It must run after auth interceptor.
+func UnaryServerInterceptor(r *Resolver) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := r.attach(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor attaches tenant to streaming calls. It must run after auth interceptor.
+func StreamServerInterceptor(r *Resolver) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := r.attach(ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func (r *Resolver) attach(ctx context.Context) (context.Context, error) {
+	name, err := r.Resolve(ctx)
+	if errors.Is(err, ErrUnknownTenant) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	return WithTenant(ctx, name), nil
+}
+
+func header(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if v := md.Get(Header); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// serverStream overrides context of the wrapped stream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,71 @@
+package tenancy
+
+import (
+	"cloud/internal/grpc/auth"
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	r := NewResolver("default", map[string][]string{
+		"team-a": {"alice", "carol"},
+		"team-b": {"carol"},
+	})
+
+	tests := []struct {
+		name      string
+		principal string
+		requested string
+		want      string
+		wantErr   error
+		wantCode  codes.Code
+	}{
+		{name: "anonymous", want: "default"},
+		{name: "anonymous default", requested: "default", want: "default"},
+		{name: "anonymous other tenant", requested: "team-a", wantErr: ErrForbidden, wantCode: codes.PermissionDenied},
+		{name: "anonymous unknown tenant", requested: "team-x", wantErr: ErrUnknownTenant, wantCode: codes.InvalidArgument},
+		{name: "unmapped principal", principal: "bob", want: "default"},
+		{name: "unmapped principal default", principal: "bob", requested: "default", want: "default"},
+		{name: "unmapped principal other tenant", principal: "bob", requested: "team-a", wantErr: ErrForbidden,
+			wantCode: codes.PermissionDenied},
+		{name: "mapped principal", principal: "alice", want: "team-a"},
+		{name: "mapped principal own tenant", principal: "alice", requested: "team-a", want: "team-a"},
+		{name: "mapped principal other tenant", principal: "alice", requested: "team-b", wantErr: ErrForbidden,
+			wantCode: codes.PermissionDenied},
+		{name: "mapped principal default", principal: "alice", requested: "default", wantErr: ErrForbidden,
+			wantCode: codes.PermissionDenied},
+		{name: "principal of several tenants", principal: "carol", want: "team-a"},
+		{name: "principal of several tenants selects", principal: "carol", requested: "team-b", want: "team-b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.principal != "" {
+				ctx = auth.WithPrincipal(ctx, auth.Principal{Name: tt.principal, Method: auth.MethodAPIKey})
+			}
+			if tt.requested != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(Header, tt.requested))
+			}
+
+			got, err := r.Resolve(ctx)
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Fatalf("Resolve() = %q, %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+
+			ctx, err = r.attach(ctx)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("attach() error = %v, want code %v", err, tt.wantCode)
+			}
+			if err == nil {
+				if name, _ := FromContext(ctx); name != tt.want {
+					t.Fatalf("FromContext() = %q, want %q", name, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package share
+
+import (
+	auditlog "cloud/internal/audit"
+	"cloud/internal/share"
+	"cloud/internal/storage/drive"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Cloud is tenant service used to serve shared images.
+type Cloud interface {
+	Open(ctx context.Context, filename string) (*os.File, error)
+	GetMeta(ctx context.Context, filename string) (drive.Meta, error)
+}
+
+// Writer stores audit events.
+type Writer interface {
+	Write(e auditlog.Event) error
+}
+
+type Handler struct {
+	log     *slog.Logger
+	links   *share.Links
+	tenants map[string]Cloud
+	// audit records downloads, nil if audit is disabled.
+	audit Writer
+}
+
+func New(log *slog.Logger, links *share.Links, tenants map[string]Cloud, audit Writer) *Handler {
+	return &Handler{
+		log:     log,
+		links:   links,
+		tenants: tenants,
+		audit:   audit,
+	}
+}
+
+// Register registers share routes on the mux.
+func Register(mux *http.ServeMux, h *Handler) {
+	mux.HandleFunc("GET /s/{token}/{name...}", h.Download)
+	mux.HandleFunc("GET /s/{token}", h.Download)
+}
+
+// Download serves shared image with Range and conditional requests support.
+func (h *Handler) Download(w http.ResponseWriter, r *http.Request) {
+	const fn = "share.Download"
+
+	log := h.log.With(slog.String("fn", fn))
+
+	start := time.Now()
+	bw := &bodyWriter{ResponseWriter: w}
+	w = bw
+	var link share.Link
+	defer func() {
+		h.record(r, link, bw, start)
+	}()
+
+	link, err := h.links.Verify(r.PathValue("token"))
+	if err != nil {
+		log.Info(err.Error())
+		status := http.StatusNotFound
+		if errors.Is(err, share.ErrExpired) {
+			status = http.StatusGone
+		}
+		bw.fail(err.Error(), status)
+		return
+	}
+	log = log.With(slog.String("tenant", link.Tenant), slog.String("filename", link.Name))
+
+	cloud, ok := h.tenants[link.Tenant]
+	if !ok {
+		log.Info("unknown tenant")
+		bw.fail(share.ErrInvalidLink.Error(), http.StatusNotFound)
+		return
+	}
+
+	file, err := cloud.Open(r.Context(), link.Name)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			bw.fail("image doesn't exist", http.StatusNotFound)
+			return
+		}
+		log.Error(err.Error())
+		bw.fail("internal error", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		log.Error(err.Error())
+		bw.fail("internal error", http.StatusInternalServerError)
+		return
+	}
+
+	etag := fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+
+	// every response serving image bytes counts as a download, ranges too, so the limit can't be
+	// bypassed by ranges or conditions; the download is taken back if nothing is served
+	if err := h.links.Use(link); err != nil {
+		if errors.Is(err, share.ErrLimitExceeded) {
+			log.Info(err.Error())
+			bw.fail(err.Error(), http.StatusGone)
+			return
+		}
+		log.Error(err.Error())
+		bw.fail("internal error", http.StatusInternalServerError)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", contentType(r.Context(), cloud, link.Name))
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", "private, no-transform")
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{
+		"filename": path.Base(link.Name),
+	}))
+	// svg is sanitized on upload, sandbox is defense in depth
+	header.Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+
+	http.ServeContent(bw, r, path.Base(link.Name), info.ModTime(), file)
+
+	if !bw.served {
+		if err := h.links.Release(link); err != nil {
+			log.Error(err.Error())
+		}
+		return
+	}
+
+	log.Info("shared image served", slog.String("remote", r.RemoteAddr), slog.String("range", r.Header.Get("Range")),
+		slog.Int64("bytes", bw.bytes))
+}
+
+// record writes audit event of the download.
+func (h *Handler) record(r *http.Request, link share.Link, bw *bodyWriter, start time.Time) {
+	const fn = "share.record"
+
+	if h.audit == nil {
+		return
+	}
+
+	status := bw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	e := auditlog.Event{
+		Time:       start,
+		Tenant:     link.Tenant,
+		Peer:       r.RemoteAddr,
+		Operation:  "ShareDownload",
+		Target:     link.Name,
+		Result:     strings.ReplaceAll(http.StatusText(status), " ", ""),
+		Error:      bw.err,
+		BytesOut:   bw.bytes,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err := h.audit.Write(e); err != nil {
+		h.log.Error(err.Error(), slog.String("fn", fn))
+	}
+}
+
+// contentType returns detected content type from metadata or by extension.
+func contentType(ctx context.Context, cloud Cloud, filename string) string {
+	if meta, err := cloud.GetMeta(ctx, filename); err == nil && meta.MIME != "" {
+		return meta.MIME
+	}
+	if t := mime.TypeByExtension(path.Ext(filename)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// bodyWriter records whether image bytes are written: HEAD, not modified and failed
+// preconditions or ranges serve no image.
+type bodyWriter struct {
+	http.ResponseWriter
+	status int
+	served bool
+	bytes  int64
+	// err is message of the rejected request.
+	err string
+}
+
+// fail replies with the error and remembers it for audit.
+func (w *bodyWriter) fail(msg string, status int) {
+	w.err = msg
+	http.Error(w, msg, status)
+}
+
+func (w *bodyWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *bodyWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	if w.status == http.StatusOK || w.status == http.StatusPartialContent {
+		w.served = w.served || n > 0
+		w.bytes += int64(n)
+	}
+	return n, err
+}
@@ -0,0 +1,226 @@
+package share
+
+import (
+	auditlog "cloud/internal/audit"
+	"cloud/internal/share"
+	"cloud/internal/storage/drive"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dirCloud serves images from a folder.
+type dirCloud struct {
+	dir string
+}
+
+func (c dirCloud) Open(_ context.Context, filename string) (*os.File, error) {
+	return os.Open(filepath.Join(c.dir, filename))
+}
+
+func (c dirCloud) GetMeta(_ context.Context, _ string) (drive.Meta, error) {
+	return drive.Meta{MIME: "image/png"}, nil
+}
+
+// events collects written audit events.
+type events []auditlog.Event
+
+func (e *events) Write(ev auditlog.Event) error {
+	*e = append(*e, ev)
+	return nil
+}
+
+func TestDownloadLimit(t *testing.T) {
+	const content = "0123456789"
+
+	tests := []struct {
+		name       string
+		method     string
+		header     map[string]string
+		wantStatus int
+		// wantCounted is whether the request used the only download of the link
+		wantCounted bool
+	}{
+		{name: "full", method: http.MethodGet, wantStatus: http.StatusOK, wantCounted: true},
+		{name: "range from start", method: http.MethodGet, header: map[string]string{"Range": "bytes=0-"},
+			wantStatus: http.StatusPartialContent, wantCounted: true},
+		{name: "range from middle", method: http.MethodGet, header: map[string]string{"Range": "bytes=1-"},
+			wantStatus: http.StatusPartialContent, wantCounted: true},
+		{name: "multiple ranges", method: http.MethodGet, header: map[string]string{"Range": "bytes=1-,0-0"},
+			wantStatus: http.StatusPartialContent, wantCounted: true},
+		{name: "other etag", method: http.MethodGet, header: map[string]string{"If-None-Match": `"other"`},
+			wantStatus: http.StatusOK, wantCounted: true},
+		{name: "unsatisfiable range", method: http.MethodGet, header: map[string]string{"Range": "bytes=100-"},
+			wantStatus: http.StatusRequestedRangeNotSatisfiable},
+		{name: "head", method: http.MethodHead, wantStatus: http.StatusOK},
+		{name: "modified since", method: http.MethodGet,
+			header:     map[string]string{"If-Modified-Since": time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)},
+			wantStatus: http.StatusNotModified},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "a.png"), []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			links, err := share.New("secret", "http://localhost", time.Hour, 0, filepath.Join(dir, "links.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			url, _, err := links.Create("default", "a.png", 0, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := strings.TrimPrefix(url, "http://localhost")
+
+			mux := http.NewServeMux()
+			Register(mux, New(slog.New(slog.NewTextHandler(io.Discard, nil)), links,
+				map[string]Cloud{"default": dirCloud{dir: dir}}, nil))
+
+			req := httptest.NewRequest(tt.method, path, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			// the next download is refused only if the request used the download
+			rec = httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			wantNext := http.StatusOK
+			if tt.wantCounted {
+				wantNext = http.StatusGone
+			}
+			if rec.Code != wantNext {
+				t.Fatalf("next download status = %d, want %d", rec.Code, wantNext)
+			}
+		})
+	}
+}
+
+func TestDownloadLink(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.png"), []byte("image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	links, err := share.New("secret", "http://localhost", time.Hour, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := share.New("other", "http://localhost", time.Hour, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	link := func(l *share.Links, tenant string, name string) string {
+		url, _, err := l.Create(tenant, name, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimPrefix(url, "http://localhost")
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "valid", path: link(links, "default", "a.png"), wantStatus: http.StatusOK, wantBody: "image"},
+		{name: "forged", path: link(other, "default", "a.png"), wantStatus: http.StatusNotFound},
+		{name: "unknown tenant", path: link(links, "team-a", "a.png"), wantStatus: http.StatusNotFound},
+		{name: "missing image", path: link(links, "default", "b.png"), wantStatus: http.StatusNotFound},
+	}
+
+	mux := http.NewServeMux()
+	Register(mux, New(slog.New(slog.NewTextHandler(io.Discard, nil)), links,
+		map[string]Cloud{"default": dirCloud{dir: dir}}, nil))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Fatalf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+			if rec.Code == http.StatusOK && rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+				t.Fatal("nosniff header is missing")
+			}
+		})
+	}
+}
+
+func TestDownloadAudit(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.png"), []byte("image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	links, err := share.New("secret", "http://localhost", time.Hour, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := func(name string, maxDownloads int) string {
+		url, _, err := links.Create("default", name, 0, maxDownloads)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimPrefix(url, "http://localhost")
+	}
+	once := link("a.png", 1)
+
+	tests := []struct {
+		name       string
+		path       string
+		header     map[string]string
+		wantResult string
+		wantTarget string
+		wantBytes  int64
+		wantError  bool
+	}{
+		{name: "served", path: link("a.png", 0), wantResult: "OK", wantTarget: "a.png", wantBytes: 5},
+		{name: "range", path: link("a.png", 0), header: map[string]string{"Range": "bytes=1-"},
+			wantResult: "PartialContent", wantTarget: "a.png", wantBytes: 4},
+		{name: "invalid link", path: "/s/abc", wantResult: "NotFound", wantError: true},
+		{name: "missing image", path: link("b.png", 0), wantResult: "NotFound", wantTarget: "b.png", wantError: true},
+		{name: "first download", path: once, wantResult: "OK", wantTarget: "a.png", wantBytes: 5},
+		{name: "limit exceeded", path: once, wantResult: "Gone", wantTarget: "a.png", wantError: true},
+	}
+
+	var written events
+	mux := http.NewServeMux()
+	Register(mux, New(slog.New(slog.NewTextHandler(io.Discard, nil)), links,
+		map[string]Cloud{"default": dirCloud{dir: dir}}, &written))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			written = nil
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			mux.ServeHTTP(httptest.NewRecorder(), req)
+
+			if len(written) != 1 {
+				t.Fatalf("written %d events, want 1", len(written))
+			}
+			e := written[0]
+			if e.Operation != "ShareDownload" || e.Result != tt.wantResult || e.Target != tt.wantTarget ||
+				e.BytesOut != tt.wantBytes || (e.Error != "") != tt.wantError || e.Peer == "" {
+				t.Fatalf("event = %+v, want result %s, target %q, %d bytes", e, tt.wantResult, tt.wantTarget,
+					tt.wantBytes)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package imaging
+
+import (
+	"image"
+	"math"
+	"strings"
+)
+
+const (
+	blurHashX = 4
+	blurHashY = 3
+	// the image is reduced before encoding, placeholders don't need more details
+	blurHashSample = 32
+)
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// BlurHash encodes the image into a compact BlurHash placeholder string.
+// See https://github.com/woltapp/blurhash for the algorithm description.
+func BlurHash(img image.Image) string {
+	pixels := thumbnail(img, blurHashSample, blurHashSample)
+
+	factors := make([][3]float64, 0, blurHashX*blurHashY)
+	for j := 0; j < blurHashY; j++ {
+		for i := 0; i < blurHashX; i++ {
+			factors = append(factors, basisFactor(pixels, blurHashSample, blurHashSample, i, j))
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(base83((blurHashX-1)+(blurHashY-1)*9, 1))
+
+	dc, ac := factors[0], factors[1:]
+
+	maxValue := 1.0
+	if len(ac) > 0 {
+		actualMax := 0.0
+		for _, f := range ac {
+			actualMax = math.Max(actualMax, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maxValue = float64(quantisedMax+1) / 166
+		sb.WriteString(base83(quantisedMax, 1))
+	} else {
+		sb.WriteString(base83(0, 1))
+	}
+
+	sb.WriteString(base83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4))
+
+	for _, f := range ac {
+		r := quantiseAC(f[0], maxValue)
+		g := quantiseAC(f[1], maxValue)
+		b := quantiseAC(f[2], maxValue)
+		sb.WriteString(base83(r*19*19+g*19+b, 2))
+	}
+
+	return sb.String()
+}
+
+// basisFactor computes the i,j cosine component of the image in linear color space.
+func basisFactor(pixels []rgb, w, h, i, j int) [3]float64 {
+	var r, g, b float64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			basis := math.Cos(math.Pi*float64(i)*float64(x)/float64(w)) *
+				math.Cos(math.Pi*float64(j)*float64(y)/float64(h))
+			p := pixels[y*w+x]
+			r += basis * sRGBToLinear(p.r)
+			g += basis * sRGBToLinear(p.g)
+			b += basis * sRGBToLinear(p.b)
+		}
+	}
+
+	norm := 2.0
+	if i == 0 && j == 0 {
+		norm = 1
+	}
+	scale := norm / float64(w*h)
+	return [3]float64{r * scale, g * scale, b * scale}
+}
+
+func quantiseAC(v, maxValue float64) int {
+	return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maxValue, 0.5)*9+9.5))))
+}
+
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
+
+func sRGBToLinear(v float64) float64 {
+	v /= 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) int {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func base83(value, length int) string {
+	res := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		res[i] = base83Chars[value%83]
+		value /= 83
+	}
+	return string(res)
+}
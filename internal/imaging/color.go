@@ -0,0 +1,91 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+)
+
+const dominantSample = 64
+
+type rgb struct {
+	r, g, b float64
+}
+
+// DominantColor returns the most common color of the image in #rrggbb format.
+// Colors are grouped into 4-bit per channel buckets and the average of the largest bucket is returned.
+func DominantColor(img image.Image) string {
+	pixels := thumbnail(img, dominantSample, dominantSample)
+
+	type bucket struct {
+		sum rgb
+		cnt int
+	}
+	buckets := make(map[int]*bucket)
+
+	var best *bucket
+	for _, p := range pixels {
+		key := int(p.r)>>4<<8 | int(p.g)>>4<<4 | int(p.b)>>4
+		b, ok := buckets[key]
+		if !ok {
+			b = &bucket{}
+			buckets[key] = b
+		}
+		b.sum.r += p.r
+		b.sum.g += p.g
+		b.sum.b += p.b
+		b.cnt++
+
+		if best == nil || b.cnt > best.cnt {
+			best = b
+		}
+	}
+
+	if best == nil {
+		return "#000000"
+	}
+
+	n := float64(best.cnt)
+	return fmt.Sprintf("#%02x%02x%02x", uint8(best.sum.r/n+0.5), uint8(best.sum.g/n+0.5), uint8(best.sum.b/n+0.5))
+}
+
+// thumbnail resamples the image to w x h 8-bit colors by box averaging.
+func thumbnail(img image.Image, w, h int) []rgb {
+	bounds := img.Bounds()
+	dx, dy := bounds.Dx(), bounds.Dy()
+
+	res := make([]rgb, w*h)
+	if dx == 0 || dy == 0 {
+		return res
+	}
+
+	for cy := 0; cy < h; cy++ {
+		y0, y1 := cellRange(cy, h, dy)
+		for cx := 0; cx < w; cx++ {
+			x0, x1 := cellRange(cx, w, dx)
+
+			var sum rgb
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+					sum.r += float64(r >> 8)
+					sum.g += float64(g >> 8)
+					sum.b += float64(b >> 8)
+				}
+			}
+
+			n := float64((y1 - y0) * (x1 - x0))
+			res[cy*w+cx] = rgb{sum.r / n, sum.g / n, sum.b / n}
+		}
+	}
+	return res
+}
+
+// cellRange returns source pixel range covered by the cell. Every cell covers at least one pixel.
+func cellRange(cell, cells, size int) (int, int) {
+	from := cell * size / cells
+	to := (cell + 1) * size / cells
+	if to <= from {
+		to = from + 1
+	}
+	return from, to
+}
@@ -0,0 +1,237 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+)
+
+const (
+	MIMEJPEG = "image/jpeg"
+	MIMEPNG  = "image/png"
+	MIMEGIF  = "image/gif"
+	MIMEWebP = "image/webp"
+	MIMEAVIF = "image/avif"
+	MIMEHEIC = "image/heic"
+	MIMEHEIF = "image/heif"
+	MIMESVG  = "image/svg+xml"
+)
+
+var ErrUnknownFormat = errors.New("unknown image format")
+
+// DetectMIME detects image MIME type by its content.
+func DetectMIME(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return MIMEJPEG
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return MIMEPNG
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return MIMEGIF
+	case len(data) >= 12 && bytes.Equal(data[:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")):
+		return MIMEWebP
+	case len(data) >= 12 && bytes.Equal(data[4:8], []byte("ftyp")):
+		switch string(data[8:12]) {
+		case "avif", "avis":
+			return MIMEAVIF
+		case "heic", "heix", "heim", "heis", "hevc", "hevx":
+			return MIMEHEIC
+		case "mif1", "msf1":
+			return MIMEHEIF
+		}
+	case isSVG(data):
+		return MIMESVG
+	}
+	return ""
+}
+
+// Dimensions returns image width and height reading only the image header.
+// SVG is a vector format and has no pixel dimensions, zero size is returned for it.
+func Dimensions(data []byte) (int, int, error) {
+	const fn = "imaging.Dimensions"
+
+	switch DetectMIME(data) {
+	case MIMEAVIF, MIMEHEIC, MIMEHEIF:
+		w, h, ok := ispe(data)
+		if !ok {
+			return 0, 0, fmt.Errorf("%s: %w", fn, ErrUnknownFormat)
+		}
+		return w, h, nil
+	case MIMESVG:
+		return 0, 0, nil
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", fn, err)
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// IsAnimated reports whether the image has more than one frame.
+func IsAnimated(data []byte) (bool, error) {
+	const fn = "imaging.IsAnimated"
+
+	switch DetectMIME(data) {
+	case MIMEGIF:
+		frames, err := gifFrames(data, 2)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", fn, err)
+		}
+		return frames > 1, nil
+	case MIMEPNG:
+		// APNG has acTL chunk before the first IDAT
+		return pngChunk(data, "acTL"), nil
+	case MIMEWebP:
+		// extended format header: RIFF, size, WEBP, VP8X, chunk size, flags
+		const animationFlag = 0x02
+		return len(data) > 20 && string(data[12:16]) == "VP8X" && data[20]&animationFlag != 0, nil
+	case MIMEAVIF:
+		return string(data[8:12]) == "avis", nil
+	case MIMEHEIC, MIMEHEIF:
+		return string(data[8:12]) == "hevc" || string(data[8:12]) == "msf1", nil
+	}
+	return false, nil
+}
+
+// gifFrames counts image descriptors of gif up to max walking its block stream,
+// frames aren't decoded, so huge frames don't allocate memory.
+func gifFrames(data []byte, max int) (int, error) {
+	const (
+		colorTableFlag = 0x80
+		extension      = 0x21
+		descriptor     = 0x2c
+		trailer        = 0x3b
+	)
+	// colorTable returns size of the color table of the flags
+	colorTable := func(flags byte) int {
+		if flags&colorTableFlag == 0 {
+			return 0
+		}
+		return 3 << (flags&0x07 + 1)
+	}
+	// skipSubBlocks returns position after the data sub-blocks at pos
+	skipSubBlocks := func(pos int) (int, error) {
+		for {
+			if pos >= len(data) {
+				return 0, io.ErrUnexpectedEOF
+			}
+			size := int(data[pos])
+			pos++
+			if size == 0 {
+				return pos, nil
+			}
+			pos += size
+		}
+	}
+
+	// header, logical screen descriptor: width, height, flags, background, aspect ratio
+	pos := 6 + 7
+	if len(data) < pos {
+		return 0, io.ErrUnexpectedEOF
+	}
+	pos += colorTable(data[10])
+
+	frames := 0
+	for frames < max {
+		if pos >= len(data) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		var err error
+		switch data[pos] {
+		case extension:
+			// introducer, label
+			pos, err = skipSubBlocks(pos + 2)
+		case descriptor:
+			// separator, left, top, width, height, flags
+			if pos+10 > len(data) {
+				return 0, io.ErrUnexpectedEOF
+			}
+			pos += 10 + colorTable(data[pos+9])
+			// LZW minimum code size precedes image data
+			pos, err = skipSubBlocks(pos + 1)
+			frames++
+		case trailer:
+			return frames, nil
+		default:
+			return 0, fmt.Errorf("gif: unknown block 0x%02x", data[pos])
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return frames, nil
+}
+
+// pngChunk reports whether png has chunk of the type before image data.
+func pngChunk(data []byte, typ string) bool {
+	pos := 8 // signature
+	for pos+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		name := string(data[pos+4 : pos+8])
+		if name == typ {
+			return true
+		}
+		if name == "IDAT" || name == "IEND" {
+			return false
+		}
+		pos += 12 + length // length, type, data, crc
+	}
+	return false
+}
+
+// ispe looks for the image spatial extents property of HEIF based formats (AVIF, HEIC).
+// Path to the property is meta -> iprp -> ipco -> ispe.
+func ispe(data []byte) (int, int, bool) {
+	meta, ok := findBox(data, "meta")
+	if !ok || len(meta) < 4 {
+		return 0, 0, false
+	}
+	// meta is a full box: skip version and flags
+	iprp, ok := findBox(meta[4:], "iprp")
+	if !ok {
+		return 0, 0, false
+	}
+	ipco, ok := findBox(iprp, "ipco")
+	if !ok {
+		return 0, 0, false
+	}
+	prop, ok := findBox(ipco, "ispe")
+	if !ok || len(prop) < 12 {
+		return 0, 0, false
+	}
+	// version and flags, width, height
+	w := binary.BigEndian.Uint32(prop[4:8])
+	h := binary.BigEndian.Uint32(prop[8:12])
+	return int(w), int(h), true
+}
+
+// findBox returns payload of the first ISO BMFF box of the type.
+func findBox(data []byte, typ string) ([]byte, bool) {
+	pos := 0
+	for pos+8 <= len(data) {
+		size := int(binary.BigEndian.Uint32(data[pos:]))
+		header := 8
+		switch size {
+		case 0:
+			size = len(data) - pos
+		case 1:
+			if pos+16 > len(data) {
+				return nil, false
+			}
+			size = int(binary.BigEndian.Uint64(data[pos+8:]))
+			header = 16
+		}
+		if size < header || pos+size > len(data) {
+			return nil, false
+		}
+		if string(data[pos+4:pos+8]) == typ {
+			return data[pos+header : pos+size], true
+		}
+		pos += size
+	}
+	return nil, false
+}
@@ -0,0 +1,79 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+func encodeGIF(t *testing.T, frames int) []byte {
+	t.Helper()
+
+	g := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		// frames with own palette have local color table
+		palette := color.Palette{color.Black, color.Gray{Y: uint8(i * 50)}}
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, 4, 4), palette))
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// hugeFramesGIF has 1x1 logical screen and frames declaring 65535x65535 pixels with almost no data.
+func hugeFramesGIF(frames int) []byte {
+	data := []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00")
+	for i := 0; i < frames; i++ {
+		// descriptor, LZW minimum code size, one data sub-block, terminator
+		data = append(data, 0x2c, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0)
+		data = append(data, 2, 2, 0x4c, 0x01, 0)
+	}
+	return append(data, 0x3b)
+}
+
+func TestIsAnimatedGIF(t *testing.T) {
+	static := encodeGIF(t, 1)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    bool
+		wantErr bool
+	}{
+		{name: "static", data: static},
+		{name: "animated", data: encodeGIF(t, 3), want: true},
+		{name: "huge frames", data: hugeFramesGIF(2), want: true},
+		{name: "huge frame", data: hugeFramesGIF(1)},
+		{name: "truncated", data: static[:len(static)-4], wantErr: true},
+		{name: "header only", data: []byte("GIF89a"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := IsAnimated(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("IsAnimated = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsAnimatedGIFAllocs(t *testing.T) {
+	data := hugeFramesGIF(2)
+	allocs := testing.AllocsPerRun(10, func() {
+		if _, err := IsAnimated(data); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs > 0 {
+		t.Fatalf("allocs = %g, want none", allocs)
+	}
+}
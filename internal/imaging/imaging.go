@@ -0,0 +1,21 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	_ "golang.org/x/image/webp"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// Decode decodes image from raw bytes.
+func Decode(data []byte) (image.Image, error) {
+	const fn = "imaging.Decode"
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	return img, nil
+}
@@ -0,0 +1,64 @@
+package imaging
+
+import (
+	"image"
+	"math/bits"
+)
+
+const (
+	dHashWidth  = 9
+	dHashHeight = 8
+)
+
+// DHash computes 64-bit difference hash of the image.
+// The image is reduced to 9x8 grayscale and each bit says whether
+// a pixel is darker than its right neighbour.
+func DHash(img image.Image) uint64 {
+	gray := grayscale(img, dHashWidth, dHashHeight)
+
+	var hash uint64
+	for y := 0; y < dHashHeight; y++ {
+		for x := 0; x < dHashWidth-1; x++ {
+			hash <<= 1
+			if gray[y*dHashWidth+x] < gray[y*dHashWidth+x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// Distance returns hamming distance between two hashes.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// grayscale reduces the image to w x h luminance values by box averaging.
+// Values are 16-bit: stored hashes were computed so, any rounding would change them.
+func grayscale(img image.Image, w, h int) []float64 {
+	bounds := img.Bounds()
+	dx, dy := bounds.Dx(), bounds.Dy()
+
+	sum := make([]float64, w*h)
+	cnt := make([]int, w*h)
+	if dx == 0 || dy == 0 {
+		return sum
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		cy := (y - bounds.Min.Y) * h / dy
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			cx := (x - bounds.Min.X) * w / dx
+			r, g, b, _ := img.At(x, y).RGBA()
+			sum[cy*w+cx] += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			cnt[cy*w+cx]++
+		}
+	}
+
+	for i := range sum {
+		if cnt[i] > 0 {
+			sum[i] /= float64(cnt[i])
+		}
+	}
+	return sum
+}
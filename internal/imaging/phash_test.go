@@ -0,0 +1,88 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// columns returns image of 9x8 cells of scale pixels, which column c has 16-bit gray value of shade(c).
+func columns(scale int, shade func(c int) uint16) image.Image {
+	img := image.NewGray16(image.Rect(0, 0, dHashWidth*scale, dHashHeight*scale))
+	for y := 0; y < dHashHeight*scale; y++ {
+		for x := 0; x < dHashWidth*scale; x++ {
+			img.SetGray16(x, y, color.Gray16{Y: shade(x / scale)})
+		}
+	}
+	return img
+}
+
+func TestDHash(t *testing.T) {
+	tests := []struct {
+		name string
+		img  image.Image
+		want uint64
+	}{
+		{
+			name: "uniform",
+			img:  columns(4, func(int) uint16 { return 0x8000 }),
+			want: 0,
+		},
+		{
+			name: "brightening",
+			img:  columns(4, func(c int) uint16 { return uint16(c * 0x1000) }),
+			want: 0xffffffffffffffff,
+		},
+		{
+			name: "darkening",
+			img:  columns(4, func(c int) uint16 { return uint16(0xffff - c*0x1000) }),
+			want: 0,
+		},
+		{
+			// steps below 8-bit precision keep hashes of stored images
+			name: "brightening by 16-bit steps",
+			img:  columns(4, func(c int) uint16 { return uint16(0x8000 + c*3) }),
+			want: 0xffffffffffffffff,
+		},
+		{
+			name: "alternating",
+			img: columns(4, func(c int) uint16 {
+				if c%2 == 0 {
+					return 0
+				}
+				return 0xffff
+			}),
+			want: 0xaaaaaaaaaaaaaaaa,
+		},
+		{
+			name: "empty",
+			img:  image.NewGray16(image.Rect(0, 0, 0, 0)),
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DHash(tt.img); got != tt.want {
+				t.Fatalf("DHash() = %#x, want %#x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b uint64
+		want int
+	}{
+		{a: 0, b: 0, want: 0},
+		{a: 0xff, b: 0xfe, want: 1},
+		{a: 0, b: 0xffffffffffffffff, want: 64},
+	}
+
+	for _, tt := range tests {
+		if got := Distance(tt.a, tt.b); got != tt.want {
+			t.Errorf("Distance(%#x, %#x) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
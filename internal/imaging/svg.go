@@ -0,0 +1,196 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// svgElements are elements kept in svg, others are removed with all their content.
+// Scripts, styles, animations and foreign content aren't allowed.
+var svgElements = nameSet(
+	"svg", "g", "defs", "symbol", "use", "switch", "title", "desc", "a",
+	"path", "rect", "circle", "ellipse", "line", "polyline", "polygon",
+	"text", "tspan", "textPath",
+	"linearGradient", "radialGradient", "stop", "pattern", "clipPath", "mask", "marker", "image",
+	"filter", "feBlend", "feColorMatrix", "feComponentTransfer", "feComposite", "feConvolveMatrix",
+	"feDiffuseLighting", "feDisplacementMap", "feDistantLight", "feDropShadow", "feFlood",
+	"feFuncA", "feFuncB", "feFuncG", "feFuncR", "feGaussianBlur", "feImage", "feMerge", "feMergeNode",
+	"feMorphology", "feOffset", "fePointLight", "feSpecularLighting", "feSpotLight", "feTile", "feTurbulence",
+)
+
+// svgAttrs are attributes without namespace kept in svg, others are removed.
+var svgAttrs = nameSet(
+	// core and geometry
+	"id", "class", "lang", "version", "baseProfile", "viewBox", "preserveAspectRatio", "transform",
+	"width", "height", "x", "y", "x1", "y1", "x2", "y2", "cx", "cy", "r", "rx", "ry", "fx", "fy", "fr",
+	"d", "points", "pathLength", "href",
+	// presentation
+	"fill", "fill-opacity", "fill-rule", "stroke", "stroke-width", "stroke-linecap", "stroke-linejoin",
+	"stroke-miterlimit", "stroke-dasharray", "stroke-dashoffset", "stroke-opacity", "opacity", "color",
+	"display", "visibility", "overflow", "clip-path", "clip-rule", "mask", "filter",
+	"marker-start", "marker-mid", "marker-end", "stop-color", "stop-opacity", "flood-color", "flood-opacity",
+	"lighting-color", "paint-order", "vector-effect", "shape-rendering", "text-rendering", "image-rendering",
+	"color-interpolation", "color-interpolation-filters",
+	// text
+	"font-family", "font-size", "font-style", "font-weight", "font-variant", "font-stretch",
+	"text-anchor", "dominant-baseline", "alignment-baseline", "baseline-shift", "letter-spacing",
+	"word-spacing", "text-decoration", "writing-mode", "direction", "unicode-bidi",
+	"dx", "dy", "rotate", "textLength", "lengthAdjust", "startOffset", "method", "spacing", "side",
+	// paint servers, clipping and markers
+	"gradientUnits", "gradientTransform", "spreadMethod", "offset", "patternUnits", "patternContentUnits",
+	"patternTransform", "clipPathUnits", "maskUnits", "maskContentUnits", "markerUnits",
+	"markerWidth", "markerHeight", "refX", "refY", "orient",
+	// filters
+	"filterUnits", "primitiveUnits", "in", "in2", "result", "stdDeviation", "mode", "type", "values",
+	"tableValues", "slope", "intercept", "amplitude", "exponent", "operator", "k1", "k2", "k3", "k4",
+	"order", "kernelMatrix", "divisor", "bias", "targetX", "targetY", "edgeMode", "preserveAlpha",
+	"surfaceScale", "diffuseConstant", "specularConstant", "specularExponent", "kernelUnitLength", "scale",
+	"xChannelSelector", "yChannelSelector", "radius", "baseFrequency", "numOctaves", "seed", "stitchTiles",
+	"azimuth", "elevation", "z", "pointsAtX", "pointsAtY", "pointsAtZ", "limitingConeAngle",
+)
+
+// svgNSAttrs are attributes with namespace prefix kept in svg, namespace declarations are kept too.
+var svgNSAttrs = nameSet("xlink:href", "xlink:title", "xml:space", "xml:lang")
+
+func nameSet(names ...string) map[string]struct{} {
+	res := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		res[name] = struct{}{}
+	}
+	return res
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "\n", "&#xA;")
+)
+
+// isSVG reports whether data looks like svg document.
+func isSVG(data []byte) bool {
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	head = bytes.TrimSpace(head)
+	if !bytes.HasPrefix(head, []byte("<")) {
+		return false
+	}
+	return bytes.Contains(head, []byte("<svg"))
+}
+
+// SanitizeSVG keeps only allowed elements and attributes of svg. Links are kept if they refer
+// to a fragment of the document or to an embedded raster image, comments and DTD are dropped.
+func SanitizeSVG(data []byte) ([]byte, error) {
+	const fn = "imaging.SanitizeSVG"
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = true
+
+	var out bytes.Buffer
+	// open are names of open elements, RawToken doesn't check that elements are balanced
+	var open []string
+	skip := 0
+	for {
+		tok, err := d.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			open = append(open, qualified(t.Name))
+			if _, ok := svgElements[t.Name.Local]; !ok || t.Name.Space != "" || skip > 0 {
+				skip++
+				continue
+			}
+			out.WriteString("<" + qualified(t.Name))
+			for _, attr := range t.Attr {
+				if !safeSVGAttr(attr) {
+					continue
+				}
+				out.WriteString(" " + qualified(attr.Name) + `="` + attrEscaper.Replace(attr.Value) + `"`)
+			}
+			out.WriteString(">")
+		case xml.EndElement:
+			if len(open) == 0 || open[len(open)-1] != qualified(t.Name) {
+				return nil, fmt.Errorf("%s: unbalanced svg elements", fn)
+			}
+			open = open[:len(open)-1]
+			if skip > 0 {
+				skip--
+				continue
+			}
+			out.WriteString("</" + qualified(t.Name) + ">")
+		case xml.CharData:
+			if skip == 0 {
+				out.WriteString(textEscaper.Replace(string(t)))
+			}
+		case xml.ProcInst:
+			if t.Target == "xml" && skip == 0 {
+				out.WriteString("<?xml " + string(t.Inst) + "?>")
+			}
+		}
+		// comments and directives (DOCTYPE, entities) are dropped
+	}
+
+	if len(open) != 0 {
+		return nil, fmt.Errorf("%s: unbalanced svg elements", fn)
+	}
+
+	return out.Bytes(), nil
+}
+
+func qualified(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// safeSVGAttr reports whether attribute is allowed and can't load external content or run a script.
+func safeSVGAttr(attr xml.Attr) bool {
+	switch {
+	case attr.Name.Space == "" && attr.Name.Local == "xmlns", attr.Name.Space == "xmlns":
+		return true
+	case attr.Name.Space == "":
+		if _, ok := svgAttrs[attr.Name.Local]; !ok {
+			return false
+		}
+	default:
+		if _, ok := svgNSAttrs[qualified(attr.Name)]; !ok {
+			return false
+		}
+	}
+
+	value := strings.ToLower(strings.Join(strings.Fields(attr.Value), ""))
+	if attr.Name.Local == "href" {
+		return safeSVGLink(value)
+	}
+	// paint and filter references, e.g. fill="url(#gradient)"
+	for rest := value; ; {
+		i := strings.Index(rest, "url(")
+		if i < 0 {
+			return true
+		}
+		rest = strings.TrimLeft(rest[i+len("url("):], `"'`)
+		if !strings.HasPrefix(rest, "#") {
+			return false
+		}
+	}
+}
+
+// safeSVGLink reports whether normalized link refers to a fragment of the document or to an embedded
+// raster image. Embedded svg isn't allowed, it isn't sanitized.
+func safeSVGLink(value string) bool {
+	if strings.HasPrefix(value, "#") {
+		return true
+	}
+	return strings.HasPrefix(value, "data:image/") && !strings.HasPrefix(value, "data:image/svg")
+}
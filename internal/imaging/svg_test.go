@@ -0,0 +1,133 @@
+package imaging
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeSVG(t *testing.T) {
+	tests := []struct {
+		name    string
+		svg     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "plain drawing",
+			svg: `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10">` +
+				`<rect x="1" y="1" width="8" height="8" fill="red"/></svg>`,
+			want: `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10">` +
+				`<rect x="1" y="1" width="8" height="8" fill="red"></rect></svg>`,
+		},
+		{
+			name: "script",
+			svg:  `<svg><script>alert(1)</script><circle r="1"/></svg>`,
+			want: `<svg><circle r="1"></circle></svg>`,
+		},
+		{
+			name: "event handler",
+			svg:  `<svg onload="alert(1)"><rect onclick="alert(1)" width="1"/></svg>`,
+			want: `<svg><rect width="1"></rect></svg>`,
+		},
+		{
+			name: "animate href",
+			svg: `<svg><a><animate attributeName="href" values="javascript:alert(1)"/>` +
+				`<text>x</text></a></svg>`,
+			want: `<svg><a><text>x</text></a></svg>`,
+		},
+		{
+			name: "set href",
+			svg:  `<svg><a><set attributeName="href" to="javascript:alert(1)"/><text>x</text></a></svg>`,
+			want: `<svg><a><text>x</text></a></svg>`,
+		},
+		{
+			name: "style element",
+			svg:  `<svg><style>rect{background:url(https://evil.example/)}</style><rect width="1"/></svg>`,
+			want: `<svg><rect width="1"></rect></svg>`,
+		},
+		{
+			name: "style attribute",
+			svg:  `<svg><rect style="fill:url(https://evil.example/)" width="1"/></svg>`,
+			want: `<svg><rect width="1"></rect></svg>`,
+		},
+		{
+			name: "foreign object",
+			svg:  `<svg><foreignObject><iframe src="javascript:alert(1)"></iframe></foreignObject></svg>`,
+			want: `<svg></svg>`,
+		},
+		{
+			name: "javascript link",
+			svg:  `<svg><a href=" java&#x09;script:alert(1)"><text>x</text></a></svg>`,
+			want: `<svg><a><text>x</text></a></svg>`,
+		},
+		{
+			name: "javascript xlink",
+			svg: `<svg xmlns:xlink="http://www.w3.org/1999/xlink">` +
+				`<a xlink:href="javascript:alert(1)"><text>x</text></a></svg>`,
+			want: `<svg xmlns:xlink="http://www.w3.org/1999/xlink"><a><text>x</text></a></svg>`,
+		},
+		{
+			name: "external link",
+			svg:  `<svg><use href="https://evil.example/sprite.svg#icon"/></svg>`,
+			want: `<svg><use></use></svg>`,
+		},
+		{
+			name: "fragment link",
+			svg:  `<svg><defs><path id="p" d="M0 0"/></defs><use href="#p"/></svg>`,
+			want: `<svg><defs><path id="p" d="M0 0"></path></defs><use href="#p"></use></svg>`,
+		},
+		{
+			name: "embedded raster image",
+			svg:  `<svg><image href="data:image/png;base64,iVBORw0KGgo="/></svg>`,
+			want: `<svg><image href="data:image/png;base64,iVBORw0KGgo="></image></svg>`,
+		},
+		{
+			name: "embedded svg image",
+			svg:  `<svg><image href="data:image/svg+xml;base64,PHN2Zz4="/></svg>`,
+			want: `<svg><image></image></svg>`,
+		},
+		{
+			name: "html data link",
+			svg:  `<svg><a href="data:text/html,&lt;script&gt;alert(1)&lt;/script&gt;"><text>x</text></a></svg>`,
+			want: `<svg><a><text>x</text></a></svg>`,
+		},
+		{
+			name: "external paint",
+			svg:  `<svg><rect fill="url('https://evil.example/p.svg#g')" stroke="url(#g)"/></svg>`,
+			want: `<svg><rect stroke="url(#g)"></rect></svg>`,
+		},
+		{
+			name:    "entity expansion",
+			svg:     `<!DOCTYPE svg [<!ENTITY x "boom">]><svg><text>&x;</text></svg>`,
+			wantErr: true,
+		},
+		{
+			name: "doctype and comment",
+			svg:  `<?xml version="1.0"?><!DOCTYPE svg><!-- c --><svg></svg>`,
+			want: `<?xml version="1.0"?><svg></svg>`,
+		},
+		{
+			name:    "malformed",
+			svg:     `<svg><rect></svg>`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SanitizeSVG([]byte(tt.svg))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SanitizeSVG() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if string(got) != tt.want {
+				t.Fatalf("SanitizeSVG() = %s, want %s", got, tt.want)
+			}
+			if strings.Contains(strings.ToLower(string(got)), "javascript") {
+				t.Fatalf("SanitizeSVG() kept javascript: %s", got)
+			}
+		})
+	}
+}
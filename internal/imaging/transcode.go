@@ -0,0 +1,36 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image/jpeg"
+	"image/png"
+)
+
+const jpegQuality = 90
+
+// Transcode decodes the image and encodes it to the format of target extension.
+// Source format must have a decoder registered with image.RegisterFormat.
+func Transcode(data []byte, ext string) ([]byte, error) {
+	const fn = "imaging.Transcode"
+
+	img, err := Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	var buf bytes.Buffer
+	switch ext {
+	case ".jpg", ".jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	case ".png":
+		err = png.Encode(&buf, img)
+	default:
+		return nil, fmt.Errorf("%s: unsupported target format %s", fn, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return buf.Bytes(), nil
+}
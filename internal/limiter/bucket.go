@@ -0,0 +1,70 @@
+package limiter
+
+import (
+	"math"
+	"time"
+)
+
+// bucket is a token bucket refilled with rate tokens per second up to burst.
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate float64, burst int, now time.Time) *bucket {
+	if burst <= 0 {
+		burst = int(math.Ceil(rate))
+	}
+	return &bucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// resize changes rate and burst, tokens above the new burst are dropped.
+func (b *bucket) resize(rate float64, burst int, now time.Time) {
+	b.refill(now)
+	if burst <= 0 {
+		burst = int(math.Ceil(rate))
+	}
+	b.rate = rate
+	b.burst = float64(burst)
+	b.tokens = min(b.tokens, b.burst)
+}
+
+func (b *bucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// allow takes one token if available, otherwise returns how long until it is.
+func (b *bucket) allow(now time.Time) (time.Duration, bool) {
+	b.refill(now)
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / b.rate * float64(time.Second)), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// reserve takes n tokens going into debt and returns how long to wait until the debt is paid.
+func (b *bucket) reserve(n int, now time.Time) time.Duration {
+	b.refill(now)
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// full reports whether the bucket has refilled completely, so it may be forgotten.
+func (b *bucket) full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
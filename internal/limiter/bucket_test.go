@@ -0,0 +1,109 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketReserve(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+
+	// steps are reservations of n tokens after elapsed time since start
+	type step struct {
+		elapsed time.Duration
+		n       int
+		want    time.Duration
+	}
+	tests := []struct {
+		name  string
+		rate  float64
+		burst int
+		steps []step
+	}{
+		{name: "within burst", rate: 10, burst: 10, steps: []step{
+			{n: 5}, {n: 5},
+		}},
+		{name: "debt is waited for", rate: 10, burst: 10, steps: []step{
+			{n: 15, want: 500 * time.Millisecond},
+		}},
+		{name: "debt accumulates", rate: 10, burst: 10, steps: []step{
+			{n: 10}, {n: 10, want: time.Second}, {n: 10, want: 2 * time.Second},
+		}},
+		{name: "refill pays debt", rate: 10, burst: 10, steps: []step{
+			{n: 20, want: time.Second},
+			{elapsed: time.Second, n: 1, want: 100 * time.Millisecond},
+		}},
+		{name: "refill stops at burst", rate: 10, burst: 10, steps: []step{
+			{n: 10},
+			{elapsed: time.Hour, n: 15, want: 500 * time.Millisecond},
+		}},
+		{name: "default burst is a second of rate", rate: 2.5, steps: []step{
+			{n: 3}, {n: 1, want: 400 * time.Millisecond},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBucket(tt.rate, tt.burst, start)
+			for i, s := range tt.steps {
+				if got := b.reserve(s.n, start.Add(s.elapsed)); got != s.want {
+					t.Fatalf("step %d: reserve(%d) = %s, want %s", i, s.n, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBucketAllow(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	b := newBucket(2, 2, start)
+
+	for i := 0; i < 2; i++ {
+		if _, ok := b.allow(start); !ok {
+			t.Fatalf("allow %d denied within burst", i)
+		}
+	}
+	if wait, ok := b.allow(start); ok || wait != 500*time.Millisecond {
+		t.Fatalf("allow() = %s, %t, want 500ms, false", wait, ok)
+	}
+	if _, ok := b.allow(start.Add(500 * time.Millisecond)); !ok {
+		t.Fatal("allow denied after refill")
+	}
+
+	// debt of a transfer delays requests of the bucket until paid
+	b.reserve(3, start.Add(500*time.Millisecond))
+	if wait, ok := b.allow(start.Add(500 * time.Millisecond)); ok || wait != 2*time.Second {
+		t.Fatalf("allow() in debt = %s, %t, want 2s, false", wait, ok)
+	}
+}
+
+func TestBucketResize(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name       string
+		reserved   int
+		rate       float64
+		burst      int
+		wantTokens float64
+	}{
+		{name: "tokens above new burst are dropped", rate: 5, burst: 4, wantTokens: 4},
+		{name: "tokens below new burst are kept", reserved: 8, rate: 5, burst: 4, wantTokens: 2},
+		{name: "debt is kept", reserved: 15, rate: 5, burst: 20, wantTokens: -5},
+		{name: "grow doesn't add tokens", reserved: 5, rate: 20, burst: 20, wantTokens: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBucket(10, 10, start)
+			b.reserve(tt.reserved, start)
+			b.resize(tt.rate, tt.burst, start)
+			if b.tokens != tt.wantTokens {
+				t.Fatalf("tokens = %g, want %g", b.tokens, tt.wantTokens)
+			}
+			if b.full(start) != (tt.wantTokens >= float64(tt.burst)) {
+				t.Fatalf("full() = %t with %g tokens of %d", b.full(start), b.tokens, tt.burst)
+			}
+		})
+	}
+}
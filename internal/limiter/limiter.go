@@ -0,0 +1,170 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrRateLimited = errors.New("request rate limit exceeded")
+
+// pruneInterval is how often full buckets of idle clients are forgotten.
+const pruneInterval = time.Minute
+
+// Config is per client limits, zero rate disables the limit.
+type Config struct {
+	// Requests is request rate per second.
+	Requests      float64
+	RequestsBurst int
+	// Bandwidth is transfer rate in bytes per second.
+	Bandwidth      int
+	BandwidthBurst int
+}
+
+// Limiter is a set of per client token buckets for requests and bandwidth.
+type Limiter struct {
+	mu        sync.Mutex
+	cfg       Config
+	requests  map[string]*bucket
+	bandwidth map[string]*bucket
+	lastPrune time.Time
+}
+
+func New(cfg Config) *Limiter {
+	return &Limiter{
+		cfg:       cfg,
+		requests:  make(map[string]*bucket),
+		bandwidth: make(map[string]*bucket),
+		lastPrune: time.Now(),
+	}
+}
+
+// Allow takes request token of the client, otherwise returns how long until it is available.
+func (l *Limiter) Allow(client string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cfg.Requests <= 0 {
+		return 0, true
+	}
+
+	now := time.Now()
+	l.prune(now)
+
+	b, ok := l.requests[client]
+	if !ok {
+		b = newBucket(l.cfg.Requests, l.cfg.RequestsBurst, now)
+		l.requests[client] = b
+	}
+	return b.allow(now)
+}
+
+// Throttle waits until the client may transfer n more bytes or ctx is done.
+func (l *Limiter) Throttle(ctx context.Context, client string, n int) error {
+	l.mu.Lock()
+	if l.cfg.Bandwidth <= 0 || n <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+
+	now := time.Now()
+	l.prune(now)
+	b, ok := l.bandwidth[client]
+	if !ok {
+		b = newBucket(float64(l.cfg.Bandwidth), l.cfg.BandwidthBurst, now)
+		l.bandwidth[client] = b
+	}
+	wait := b.reserve(n, now)
+	l.mu.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SetConfig changes limits, token balances of known clients are kept up to the new burst.
+func (l *Limiter) SetConfig(cfg Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cfg = cfg
+	now := time.Now()
+	resize := func(buckets map[string]*bucket, rate float64, burst int) {
+		for client, b := range buckets {
+			if rate <= 0 {
+				delete(buckets, client)
+				continue
+			}
+			b.resize(rate, burst, now)
+		}
+	}
+	resize(l.requests, cfg.Requests, cfg.RequestsBurst)
+	resize(l.bandwidth, float64(cfg.Bandwidth), cfg.BandwidthBurst)
+}
+
+// ClientState is token balance of a client.
+type ClientState struct {
+	Client          string
+	RequestTokens   float64
+	BandwidthTokens float64
+}
+
+// State returns token balances of known clients sorted by client.
+func (l *Limiter) State() []ClientState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	states := make(map[string]*ClientState)
+	get := func(client string) *ClientState {
+		s, ok := states[client]
+		if !ok {
+			s = &ClientState{Client: client}
+			states[client] = s
+		}
+		return s
+	}
+	for client, b := range l.requests {
+		b.refill(now)
+		get(client).RequestTokens = b.tokens
+	}
+	for client, b := range l.bandwidth {
+		b.refill(now)
+		get(client).BandwidthTokens = b.tokens
+	}
+
+	res := make([]ClientState, 0, len(states))
+	for _, s := range states {
+		res = append(res, *s)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Client < res[j].Client
+	})
+	return res
+}
+
+// prune forgets full buckets, mu must be held.
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < pruneInterval {
+		return
+	}
+	l.lastPrune = now
+	for _, buckets := range []map[string]*bucket{l.requests, l.bandwidth} {
+		for client, b := range buckets {
+			if b.full(now) {
+				delete(buckets, client)
+			}
+		}
+	}
+}
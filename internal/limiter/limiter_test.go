@@ -0,0 +1,85 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		calls   int
+		allowed int
+	}{
+		{name: "disabled", cfg: Config{}, calls: 100, allowed: 100},
+		{name: "burst", cfg: Config{Requests: 1, RequestsBurst: 3}, calls: 5, allowed: 3},
+		{name: "default burst", cfg: Config{Requests: 2}, calls: 5, allowed: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(tt.cfg)
+			allowed := 0
+			for i := 0; i < tt.calls; i++ {
+				if _, ok := l.Allow("client"); ok {
+					allowed++
+				}
+			}
+			if allowed != tt.allowed {
+				t.Fatalf("allowed %d, want %d", allowed, tt.allowed)
+			}
+
+			// clients have separate buckets
+			if _, ok := l.Allow("other"); !ok {
+				t.Fatal("other client is limited")
+			}
+		})
+	}
+}
+
+func TestLimiterThrottle(t *testing.T) {
+	l := New(Config{Bandwidth: 1000, BandwidthBurst: 1000})
+	if err := l.Throttle(context.Background(), "client", 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	// the debt of a second isn't waited for after cancel
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := l.Throttle(ctx, "client", 1000); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Throttle() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("Throttle() returned after %s", d)
+	}
+}
+
+func TestLimiterSetConfig(t *testing.T) {
+	l := New(Config{Requests: 1, RequestsBurst: 10, Bandwidth: 100})
+	for i := 0; i < 8; i++ {
+		l.Allow("client")
+	}
+	if err := l.Throttle(context.Background(), "client", 50); err != nil {
+		t.Fatal(err)
+	}
+
+	// balance is kept, disabled bandwidth limit forgets buckets
+	l.SetConfig(Config{Requests: 1, RequestsBurst: 5})
+	state := l.State()
+	if len(state) != 1 || state[0].Client != "client" {
+		t.Fatalf("State() = %+v, want one client", state)
+	}
+	if tokens := state[0].RequestTokens; tokens < 2 || tokens > 2.5 {
+		t.Fatalf("request tokens = %g, want about 2", tokens)
+	}
+	if tokens := state[0].BandwidthTokens; tokens != 0 {
+		t.Fatalf("bandwidth tokens = %g, want 0 without limit", tokens)
+	}
+	if err := l.Throttle(context.Background(), "client", 1<<30); err != nil {
+		t.Fatalf("Throttle() without limit error = %v", err)
+	}
+}
@@ -0,0 +1,234 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrQueueFull   = errors.New("too many calls are waiting for a slot")
+	ErrWaitTimeout = errors.New("timed out waiting for a slot")
+)
+
+// FairQueue limits concurrent slots. When all slots are busy, waiting clients
+// are served round-robin, so a client with many requests can't starve others.
+type FairQueue struct {
+	mu       sync.Mutex
+	capacity int
+	maxQueue int
+	maxWait  time.Duration
+	inUse    int
+	holders  map[string]int
+	waiters  map[string][]chan struct{}
+	// ring is clients with waiters in service order.
+	ring []string
+}
+
+// NewFairQueue creates queue with capacity slots. Zero maxQueue or maxWait disables the limit.
+func NewFairQueue(capacity int, maxQueue int, maxWait time.Duration) *FairQueue {
+	return &FairQueue{
+		capacity: capacity,
+		maxQueue: maxQueue,
+		maxWait:  maxWait,
+		holders:  make(map[string]int),
+		waiters:  make(map[string][]chan struct{}),
+	}
+}
+
+// Acquire waits for a slot and returns function releasing it. It fails if the queue is full,
+// the wait exceeds max wait or ctx is done.
+func (q *FairQueue) Acquire(ctx context.Context, client string) (func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	if q.inUse < q.capacity && len(q.ring) == 0 {
+		q.inUse++
+		q.holders[client]++
+		q.mu.Unlock()
+		return q.releaseFunc(client), nil
+	}
+	if q.maxQueue > 0 && q.waiting() >= q.maxQueue {
+		q.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+
+	ready := make(chan struct{})
+	if len(q.waiters[client]) == 0 {
+		q.ring = append(q.ring, client)
+	}
+	q.waiters[client] = append(q.waiters[client], ready)
+	maxWait := q.maxWait
+	q.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if maxWait > 0 {
+		timer := time.NewTimer(maxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	// slot is handed over by release
+	var err error
+	select {
+	case <-ready:
+		return q.releaseFunc(client), nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timeout:
+		err = ErrWaitTimeout
+	}
+
+	q.mu.Lock()
+	removed := q.removeWaiter(client, ready)
+	q.mu.Unlock()
+	if !removed {
+		// the slot was handed over concurrently, pass it on
+		q.release(client)
+	}
+	return nil, err
+}
+
+// removeWaiter removes waiter which hasn't got a slot yet, mu must be held.
+func (q *FairQueue) removeWaiter(client string, ready chan struct{}) bool {
+	waiters := q.waiters[client]
+	i := slices.Index(waiters, ready)
+	if i < 0 {
+		return false
+	}
+
+	waiters = slices.Delete(waiters, i, i+1)
+	if len(waiters) > 0 {
+		q.waiters[client] = waiters
+		return true
+	}
+	delete(q.waiters, client)
+	q.ring = slices.DeleteFunc(q.ring, func(c string) bool {
+		return c == client
+	})
+	return true
+}
+
+// waiting returns number of waiting calls, mu must be held.
+func (q *FairQueue) waiting() int {
+	n := 0
+	for _, waiters := range q.waiters {
+		n += len(waiters)
+	}
+	return n
+}
+
+func (q *FairQueue) releaseFunc(client string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			q.release(client)
+		})
+	}
+}
+
+// release passes the slot to the next client in the ring or frees it.
+func (q *FairQueue) release(client string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.holders[client]--
+	if q.holders[client] == 0 {
+		delete(q.holders, client)
+	}
+
+	// slots above capacity reduced by resize are freed
+	if len(q.ring) == 0 || q.inUse > q.capacity {
+		q.inUse--
+		return
+	}
+
+	q.handOver()
+}
+
+// handOver passes the slot to the next client in the ring, mu must be held.
+func (q *FairQueue) handOver() {
+	next := q.ring[0]
+	q.ring = q.ring[1:]
+	ready := q.waiters[next][0]
+	q.waiters[next] = q.waiters[next][1:]
+	if len(q.waiters[next]) > 0 {
+		q.ring = append(q.ring, next)
+	} else {
+		delete(q.waiters, next)
+	}
+
+	q.holders[next]++
+	close(ready)
+}
+
+// Resize changes limits of the queue. Current holders keep their slots when capacity shrinks,
+// the slots are freed as they are released. Waiters get slots added by growth at once.
+func (q *FairQueue) Resize(capacity int, maxQueue int, maxWait time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.capacity = capacity
+	q.maxQueue = maxQueue
+	q.maxWait = maxWait
+
+	for q.inUse < q.capacity && len(q.ring) > 0 {
+		q.inUse++
+		q.handOver()
+	}
+}
+
+// SlotState is slots held and awaited by a client.
+type SlotState struct {
+	Client  string
+	Held    int
+	Waiting int
+}
+
+// QueueState is occupancy of the queue.
+type QueueState struct {
+	InUse    int
+	Capacity int
+	Waiting  int
+	Clients  []SlotState
+}
+
+// State returns current occupancy sorted by client.
+func (q *FairQueue) State() QueueState {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	state := QueueState{
+		InUse:    q.inUse,
+		Capacity: q.capacity,
+	}
+	clients := make(map[string]*SlotState)
+	get := func(client string) *SlotState {
+		s, ok := clients[client]
+		if !ok {
+			s = &SlotState{Client: client}
+			clients[client] = s
+		}
+		return s
+	}
+	for client, n := range q.holders {
+		get(client).Held = n
+	}
+	for client, waiters := range q.waiters {
+		get(client).Waiting = len(waiters)
+	}
+	state.Waiting = q.waiting()
+
+	for _, s := range clients {
+		state.Clients = append(state.Clients, *s)
+	}
+	sort.Slice(state.Clients, func(i, j int) bool {
+		return state.Clients[i].Client < state.Clients[j].Client
+	})
+	return state
+}
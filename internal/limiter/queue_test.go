@@ -0,0 +1,330 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor waits until cond holds for the queue state.
+func waitFor(t *testing.T, q *FairQueue, cond func(QueueState) bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond(q.State()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("state %+v didn't change in time", q.State())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// acquired is result of Acquire called in background.
+type acquired struct {
+	label   string
+	release func()
+	err     error
+}
+
+// enqueue calls Acquire in background and waits until the call is waiting.
+func enqueue(t *testing.T, ctx context.Context, q *FairQueue, client string, label string, res chan<- acquired) {
+	t.Helper()
+
+	waiting := q.State().Waiting
+	go func() {
+		release, err := q.Acquire(ctx, client)
+		res <- acquired{label: label, release: release, err: err}
+	}()
+	waitFor(t, q, func(s QueueState) bool { return s.Waiting == waiting+1 })
+}
+
+func TestFairQueueRoundRobin(t *testing.T) {
+	tests := []struct {
+		name string
+		// waiters are client and label of waiting calls in arrival order
+		waiters [][2]string
+		want    []string
+	}{
+		{
+			name:    "one client",
+			waiters: [][2]string{{"a", "a1"}, {"a", "a2"}, {"a", "a3"}},
+			want:    []string{"a1", "a2", "a3"},
+		},
+		{
+			name:    "greedy client doesn't starve others",
+			waiters: [][2]string{{"a", "a1"}, {"a", "a2"}, {"a", "a3"}, {"b", "b1"}, {"c", "c1"}},
+			want:    []string{"a1", "b1", "c1", "a2", "a3"},
+		},
+		{
+			name:    "client returning to the ring is served last",
+			waiters: [][2]string{{"a", "a1"}, {"b", "b1"}, {"b", "b2"}, {"a", "a2"}},
+			want:    []string{"a1", "b1", "a2", "b2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewFairQueue(1, 0, 0)
+			release, err := q.Acquire(context.Background(), "holder")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res := make(chan acquired, len(tt.waiters))
+			for _, w := range tt.waiters {
+				enqueue(t, context.Background(), q, w[0], w[1], res)
+			}
+
+			var got []string
+			for range tt.waiters {
+				release()
+				r := <-res
+				if r.err != nil {
+					t.Fatal(r.err)
+				}
+				got = append(got, r.label)
+				release = r.release
+			}
+			release()
+
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("served %v, want %v", got, tt.want)
+			}
+			if s := q.State(); s.InUse != 0 || s.Waiting != 0 || len(s.Clients) != 0 {
+				t.Fatalf("state after release = %+v, want empty", s)
+			}
+		})
+	}
+}
+
+func TestFairQueueLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxQueue int
+		maxWait  time.Duration
+		// waiting is number of calls waiting before the checked one
+		waiting int
+		wantErr error
+	}{
+		{name: "queue full", maxQueue: 2, waiting: 2, wantErr: ErrQueueFull},
+		{name: "queue has room", maxQueue: 2, waiting: 1, maxWait: 10 * time.Millisecond, wantErr: ErrWaitTimeout},
+		{name: "wait timeout", maxWait: 10 * time.Millisecond, wantErr: ErrWaitTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewFairQueue(1, tt.maxQueue, tt.maxWait)
+			release, err := q.Acquire(context.Background(), "holder")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer release()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			res := make(chan acquired, tt.waiting)
+			for i := 0; i < tt.waiting; i++ {
+				enqueue(t, ctx, q, "other", "", res)
+			}
+
+			if _, err := q.Acquire(context.Background(), "client"); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Acquire() error = %v, want %v", err, tt.wantErr)
+			}
+			// rejected call doesn't wait
+			if s := q.State(); tt.maxWait == 0 && s.Waiting != tt.waiting {
+				t.Fatalf("waiting = %d, want %d", s.Waiting, tt.waiting)
+			}
+
+			cancel()
+			for i := 0; i < tt.waiting; i++ {
+				if r := <-res; !errors.Is(r.err, context.Canceled) && !errors.Is(r.err, ErrWaitTimeout) {
+					t.Fatalf("waiter error = %v, want %v or %v", r.err, context.Canceled, ErrWaitTimeout)
+				}
+			}
+			if s := q.State(); s.Waiting != 0 {
+				t.Fatalf("waiting after cancel = %d, want 0", s.Waiting)
+			}
+		})
+	}
+}
+
+func TestFairQueueCancelled(t *testing.T) {
+	q := NewFairQueue(1, 0, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := q.Acquire(ctx, "client"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Acquire() error = %v, want %v", err, context.Canceled)
+	}
+	if s := q.State(); s.InUse != 0 {
+		t.Fatalf("in use = %d, want 0", s.InUse)
+	}
+}
+
+// TestFairQueueCancelDuringHandOver hands the slot over to a waiter whose context is done
+// but which hasn't removed itself yet: the slot must pass on to the next waiter.
+func TestFairQueueCancelDuringHandOver(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		q := NewFairQueue(1, 0, 0)
+		release, err := q.Acquire(context.Background(), "holder")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		res := make(chan acquired, 2)
+		enqueue(t, ctx, q, "a", "a", res)
+		enqueue(t, context.Background(), q, "b", "b", res)
+
+		// the waiter wakes up on cancel and blocks on the lock held by the hand-over
+		q.mu.Lock()
+		cancel()
+		time.Sleep(time.Millisecond)
+		q.mu.Unlock()
+		release()
+
+		for j := 0; j < 2; j++ {
+			r := <-res
+			switch {
+			case r.err == nil:
+				r.release()
+			case r.label != "a" || !errors.Is(r.err, context.Canceled):
+				t.Fatalf("%s: Acquire() error = %v", r.label, r.err)
+			}
+		}
+		if s := q.State(); s.InUse != 0 || s.Waiting != 0 || len(s.Clients) != 0 {
+			t.Fatalf("state = %+v, want empty", s)
+		}
+	}
+}
+
+func TestFairQueueResize(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		holders  int
+		waiters  int
+		resize   int
+		// wantInUse and wantWaiting are right after resize
+		wantInUse   int
+		wantWaiting int
+		// wantFreed is number of releases of holders which free the slot instead of handing it over
+		wantFreed int
+	}{
+		{name: "grow serves waiters at once", capacity: 1, holders: 1, waiters: 3, resize: 3,
+			wantInUse: 3, wantWaiting: 1},
+		{name: "grow above waiters", capacity: 1, holders: 1, waiters: 1, resize: 5,
+			wantInUse: 2, wantWaiting: 0},
+		{name: "shrink keeps holders", capacity: 3, holders: 3, waiters: 2, resize: 1,
+			wantInUse: 3, wantWaiting: 2, wantFreed: 2},
+		{name: "shrink to holders", capacity: 3, holders: 2, waiters: 0, resize: 2,
+			wantInUse: 2, wantWaiting: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewFairQueue(tt.capacity, 0, 0)
+			var releases []func()
+			for i := 0; i < tt.holders; i++ {
+				release, err := q.Acquire(context.Background(), fmt.Sprintf("holder%d", i))
+				if err != nil {
+					t.Fatal(err)
+				}
+				releases = append(releases, release)
+			}
+			res := make(chan acquired, tt.waiters)
+			for i := 0; i < tt.waiters; i++ {
+				enqueue(t, context.Background(), q, fmt.Sprintf("waiter%d", i), "", res)
+			}
+
+			q.Resize(tt.resize, 0, 0)
+			if s := q.State(); s.InUse != tt.wantInUse || s.Waiting != tt.wantWaiting || s.Capacity != tt.resize {
+				t.Fatalf("state after resize = %+v, want in use %d, waiting %d", s, tt.wantInUse, tt.wantWaiting)
+			}
+
+			// releases above the new capacity free slots, the rest hand them over
+			served := tt.wantInUse - tt.holders
+			for i := 0; i < served; i++ {
+				r := <-res
+				releases = append(releases, r.release)
+			}
+			for i := 0; i < tt.wantFreed; i++ {
+				releases[0]()
+				releases = releases[1:]
+				if s := q.State(); s.InUse != tt.wantInUse-i-1 || s.Waiting != tt.wantWaiting {
+					t.Fatalf("state after release %d = %+v", i, s)
+				}
+			}
+			// each release hands the slot over to a waiter until none is left
+			for i := served; i < tt.waiters; i++ {
+				releases[0]()
+				releases = releases[1:]
+				r := <-res
+				releases = append(releases, r.release)
+			}
+			for _, release := range releases {
+				release()
+			}
+			if s := q.State(); s.InUse != 0 || s.Waiting != 0 || len(s.Clients) != 0 {
+				t.Fatalf("final state = %+v, want empty", s)
+			}
+		})
+	}
+}
+
+// TestFairQueueConcurrent checks slots never exceed capacity and are all returned
+// while calls time out, get cancelled and the queue is resized.
+func TestFairQueueConcurrent(t *testing.T) {
+	q := NewFairQueue(3, 0, 5*time.Millisecond)
+	var (
+		held    atomic.Int32
+		maxHeld atomic.Int32
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(int64(i)))
+			for j := 0; j < 50; j++ {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Duration(rnd.Intn(3000))*time.Microsecond)
+				release, err := q.Acquire(ctx, fmt.Sprintf("client%d", i%5))
+				if err == nil {
+					n := held.Add(1)
+					for {
+						m := maxHeld.Load()
+						if n <= m || maxHeld.CompareAndSwap(m, n) {
+							break
+						}
+					}
+					time.Sleep(time.Duration(rnd.Intn(200)) * time.Microsecond)
+					held.Add(-1)
+					release()
+					release()
+				}
+				cancel()
+			}
+		}(i)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for _, capacity := range []int{5, 1, 4, 2, 3} {
+			time.Sleep(2 * time.Millisecond)
+			q.Resize(capacity, 0, 5*time.Millisecond)
+		}
+	}()
+	wg.Wait()
+
+	if m := maxHeld.Load(); m > 5 {
+		t.Fatalf("max held = %d, want at most the largest capacity", m)
+	}
+	if s := q.State(); s.InUse != 0 || s.Waiting != 0 || len(s.Clients) != 0 {
+		t.Fatalf("final state = %+v, want empty", s)
+	}
+}
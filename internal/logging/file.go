@@ -0,0 +1,144 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	filePerm = 0o640
+	dirPerm  = 0o750
+	// rotatedTimeFormat sorts lexically in time order.
+	rotatedTimeFormat = "20060102T150405.000000000"
+)
+
+// File is log file with size based rotation, server and audit logs are written to it.
+type File struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenFile opens log file for appending. Zero maxSize disables rotation, zero maxBackups keeps all rotated files.
+func OpenFile(path string, maxSize int64, maxBackups int) (*File, error) {
+	const fn = "logging.OpenFile"
+
+	if err := os.MkdirAll(filepath.Dir(path), dirPerm); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	f := &File{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := f.open(); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	return f, nil
+}
+
+// Write writes p rotating the file first if p doesn't fit.
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the file.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Close()
+}
+
+// open opens current file for appending, mu must be held or file not shared yet.
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, filePerm)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// rotate renames current file to a timestamped one, removes old backups and starts a new file, mu must be held.
+func (f *File) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.path, rotatedPath(f.path, time.Now())); err != nil {
+		return err
+	}
+
+	if f.maxBackups > 0 {
+		backups, err := Rotated(f.path)
+		if err != nil {
+			return err
+		}
+		for len(backups) > f.maxBackups {
+			if err := os.Remove(backups[0]); err != nil {
+				return err
+			}
+			backups = backups[1:]
+		}
+	}
+	return f.open()
+}
+
+// Rotated returns rotated files of the log at path in time order. Only names made by rotation match,
+// e.g. server-20240102T150405.000000000.log for server.log, other files of the folder are left alone.
+func Rotated(path string) ([]string, error) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	matches, err := filepath.Glob(globEscape(base) + "-*" + globEscape(ext))
+	if err != nil {
+		return nil, err
+	}
+
+	res := matches[:0]
+	for _, name := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, base+"-"), ext)
+		if _, err := time.Parse(rotatedTimeFormat, stamp); err == nil && len(stamp) == len(rotatedTimeFormat) {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// rotatedPath returns name of rotated file: server.log -> server-<time>.log.
+func rotatedPath(path string, t time.Time) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + t.UTC().Format(rotatedTimeFormat) + ext
+}
+
+func globEscape(s string) string {
+	r := strings.NewReplacer(`*`, `\*`, `?`, `\?`, `[`, `\[`, `\`, `\\`)
+	return r.Replace(s)
+}
@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileRotate(t *testing.T) {
+	// other files of the folder, some looking like rotated ones
+	unrelated := []string{"server-old.log", "server-2024.log", "server-20240102T150405.log", "server-a.b.log", "other.log"}
+
+	tests := []struct {
+		name       string
+		maxBackups int
+		writes     int
+		wantFiles  int
+	}{
+		{name: "all backups", maxBackups: 0, writes: 5, wantFiles: 4},
+		{name: "limited backups", maxBackups: 2, writes: 5, wantFiles: 2},
+		{name: "no rotation yet", maxBackups: 2, writes: 1, wantFiles: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range unrelated {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte("keep\n"), filePerm); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			path := filepath.Join(dir, "server.log")
+			f, err := OpenFile(path, 10, tt.maxBackups)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < tt.writes; i++ {
+				if _, err := f.Write([]byte(strings.Repeat("x", 9) + "\n")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			rotated, err := Rotated(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rotated) != tt.wantFiles {
+				t.Fatalf("Rotated() = %q, want %d files", rotated, tt.wantFiles)
+			}
+			for _, name := range unrelated {
+				if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+					t.Fatalf("unrelated file: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestRotated(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit[1].jsonl")
+	newer := rotatedPath(path, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+	older := rotatedPath(path, time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC))
+	for _, name := range []string{newer, older, path, filepath.Join(dir, "audit[1]-x.jsonl"), newer + ".tmp"} {
+		if err := os.WriteFile(name, nil, filePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := Rotated(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{older, newer}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Rotated() = %q, want %q", got, want)
+	}
+}
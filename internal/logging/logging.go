@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"cloud/internal/config"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var ErrUnknownFormat = errors.New("unknown log format")
+
+// New creates logger writing to stdout or rotated file. Request id of the context is added to every record.
+// Returned closer closes the log file.
+func New(cfg config.LogConfig) (*slog.Logger, io.Closer, error) {
+	const fn = "logging.New"
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil && cfg.Level != "" {
+		return nil, nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	var (
+		w      io.Writer = os.Stdout
+		closer io.Closer = nopCloser{}
+	)
+	if cfg.Path != "" {
+		file, err := OpenFile(cfg.Path, cfg.MaxSize, cfg.MaxBackups)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", fn, err)
+		}
+		w, closer = file, file
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case FormatText, "":
+		h = slog.NewTextHandler(w, opts)
+	case FormatJSON:
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		closer.Close()
+		return nil, nil, fmt.Errorf("%s: %w: %q", fn, ErrUnknownFormat, cfg.Format)
+	}
+
+	return slog.New(contextHandler{h}), closer, nil
+}
+
+// nopCloser is closer of stdout, which stays open.
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"cloud/internal/config"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewRedactsSecrets(t *testing.T) {
+	cfg := &config.Config{
+		Auth: config.AuthConfig{
+			APIKeys:   config.APIKeys{{Name: "ci", Key: "api-key-secret"}},
+			JWTSecret: "jwt-secret",
+		},
+		Share: config.ShareConfig{Secret: "share-secret"},
+		Audit: config.AuditConfig{Key: "audit-secret"},
+		Admin: config.AdminConfig{APIKeys: config.APIKeys{{Name: "ops", Key: "admin-key-secret"}}},
+	}
+	secrets := []string{"api-key-secret", "jwt-secret", "share-secret", "audit-secret", "admin-key-secret"}
+
+	for _, format := range []string{FormatJSON, FormatText} {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "server.log")
+			log, closer, err := New(config.LogConfig{Format: format, Path: path})
+			if err != nil {
+				t.Fatal(err)
+			}
+			log.Info("start", slog.Any("config", cfg), slog.Any("secret", cfg.Share.Secret))
+			if err := closer.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, secret := range secrets {
+				if strings.Contains(string(data), secret) {
+					t.Errorf("log has %q: %s", secret, data)
+				}
+			}
+			if !strings.Contains(string(data), "[REDACTED]") {
+				t.Errorf("log has no redacted secrets: %s", data)
+			}
+		})
+	}
+}
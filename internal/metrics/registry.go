@@ -0,0 +1,319 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// contentType is Prometheus text exposition format.
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets are latency buckets in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+// Registry is a set of metrics exposed in Prometheus text format.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.metrics = append(r.metrics, m)
+}
+
+// Write writes all metrics in registration order.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler serves metrics.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		_ = r.Write(w)
+	})
+}
+
+// desc is metric name, help and label names.
+type desc struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+}
+
+func (d desc) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.typ)
+}
+
+// writeSample writes one sample, extra label is appended if name isn't empty.
+func (d desc) writeSample(w *bufio.Writer, suffix string, values []string, extraName, extraValue string, v float64) {
+	w.WriteString(d.name + suffix)
+	if len(d.labels) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, label := range d.labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(label + `="` + escapeLabel(values[i]) + `"`)
+		}
+		if extraName != "" {
+			if len(d.labels) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraName + `="` + escapeLabel(extraValue) + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func (d desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// series is label values with a value of any kind.
+type series[T any] struct {
+	values []string
+	value  T
+}
+
+// vec is a set of series by label values.
+type vec[T any] struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*series[T]
+	init   func() T
+}
+
+// with returns series of the label values, mu must be held.
+func (v *vec[T]) with(values []string) *series[T] {
+	key := v.key(values)
+	s, ok := v.series[key]
+	if !ok {
+		s = &series[T]{values: append([]string(nil), values...), value: v.init()}
+		v.series[key] = s
+	}
+	return s
+}
+
+// sorted returns series sorted by label values, mu must be held.
+func (v *vec[T]) sorted() []*series[T] {
+	res := make([]*series[T], 0, len(v.series))
+	for _, s := range v.series {
+		res = append(res, s)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return strings.Join(res[i].values, "\xff") < strings.Join(res[j].values, "\xff")
+	})
+	return res
+}
+
+// CounterVec is monotonically increasing values by labels.
+type CounterVec struct {
+	vec[float64]
+}
+
+func (r *Registry) NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec[float64]{
+		desc:   desc{name: name, help: help, typ: "counter", labels: labels},
+		series: make(map[string]*series[float64]),
+		init:   func() float64 { return 0 },
+	}}
+	r.register(c)
+	return c
+}
+
+// Add adds non-negative v to the counter of the label values.
+func (c *CounterVec) Add(v float64, values ...string) {
+	if v < 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.with(values).value += v
+}
+
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writeHeader(w)
+	for _, s := range c.sorted() {
+		c.writeSample(w, "", s.values, "", "", s.value)
+	}
+}
+
+// GaugeVec is values by labels which go up and down.
+type GaugeVec struct {
+	vec[float64]
+}
+
+func (r *Registry) NewGaugeVec(name string, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{vec[float64]{
+		desc:   desc{name: name, help: help, typ: "gauge", labels: labels},
+		series: make(map[string]*series[float64]),
+		init:   func() float64 { return 0 },
+	}}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeVec) Set(v float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.with(values).value = v
+}
+
+func (g *GaugeVec) Add(v float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.with(values).value += v
+}
+
+func (g *GaugeVec) write(w *bufio.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.writeHeader(w)
+	for _, s := range g.sorted() {
+		g.writeSample(w, "", s.values, "", "", s.value)
+	}
+}
+
+// GaugeFunc is gauge values collected on every scrape.
+type GaugeFunc struct {
+	desc
+	collect func(emit func(v float64, values ...string))
+}
+
+// NewGaugeFunc registers gauge whose values are reported by collect calling emit for every series.
+func (r *Registry) NewGaugeFunc(name string, help string, labels []string,
+	collect func(emit func(v float64, values ...string))) *GaugeFunc {
+	g := &GaugeFunc{
+		desc:    desc{name: name, help: help, typ: "gauge", labels: labels},
+		collect: collect,
+	}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	g.writeHeader(w)
+	g.collect(func(v float64, values ...string) {
+		g.key(values)
+		g.writeSample(w, "", values, "", "", v)
+	})
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// HistogramVec is distributions of observed values by labels.
+type HistogramVec struct {
+	vec[*histogram]
+	buckets []float64
+}
+
+func (r *Registry) NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		vec: vec[*histogram]{
+			desc:   desc{name: name, help: help, typ: "histogram", labels: labels},
+			series: make(map[string]*series[*histogram]),
+			init: func() *histogram {
+				return &histogram{counts: make([]uint64, len(buckets))}
+			},
+		},
+		buckets: buckets,
+	}
+	r.register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.with(values).value
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.writeHeader(w)
+	for _, s := range h.sorted() {
+		for i, upper := range h.buckets {
+			h.writeSample(w, "_bucket", s.values, "le", formatFloat(upper), float64(s.value.counts[i]))
+		}
+		h.writeSample(w, "_bucket", s.values, "le", "+Inf", float64(s.value.count))
+		h.writeSample(w, "_sum", s.values, "", "", s.value.sum)
+		h.writeSample(w, "_count", s.values, "", "", float64(s.value.count))
+	}
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,149 @@
+package scrub
+
+import (
+	"cloud/internal/storage/drive"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	filePerm = 0o640
+	dirPerm  = 0o750
+)
+
+// Checker verifies stored images of a tenant.
+type Checker interface {
+	Fsck(ctx context.Context, opts drive.FsckOptions) (drive.FsckReport, error)
+}
+
+// Target is storage of a tenant to check.
+type Target struct {
+	Tenant  string
+	Checker Checker
+	Opts    drive.FsckOptions
+}
+
+// Report is fsck result of a tenant.
+type Report struct {
+	Tenant string `json:"tenant"`
+	drive.FsckReport
+	Error string `json:"error,omitempty"`
+}
+
+// Check checks targets one by one. Failed checks are reported with their error and don't stop others.
+func Check(ctx context.Context, targets []Target) ([]Report, error) {
+	reports := make([]Report, 0, len(targets))
+	var errs []error
+	for _, t := range targets {
+		report, err := t.Checker.Fsck(ctx, t.Opts)
+		r := Report{Tenant: t.Tenant, FsckReport: report}
+		if err != nil {
+			r.Error = err.Error()
+			errs = append(errs, fmt.Errorf("tenant %s: %w", t.Tenant, err))
+		}
+		reports = append(reports, r)
+	}
+	return reports, errors.Join(errs...)
+}
+
+// WriteReport replaces the file with JSON reports, readers never see a partial file.
+func WriteReport(path string, reports []Report) error {
+	const fn = "scrub.WriteReport"
+
+	data, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), dirPerm); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), filePerm); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	return nil
+}
+
+// Scrubber checks storages of tenants in background.
+type Scrubber struct {
+	log        *slog.Logger
+	targets    []Target
+	interval   time.Duration
+	reportPath string
+}
+
+// New creates scrubber which checks targets every interval and writes the report to reportPath
+// if it isn't empty.
+func New(log *slog.Logger, targets []Target, interval time.Duration, reportPath string) *Scrubber {
+	return &Scrubber{
+		log:        log,
+		targets:    targets,
+		interval:   interval,
+		reportPath: reportPath,
+	}
+}
+
+// Run checks targets every interval until ctx is done. The first check runs after interval,
+// so it doesn't compete with startup.
+func (s *Scrubber) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		s.Scrub(ctx)
+	}
+}
+
+// Scrub checks all targets once and logs the summary. Corrupt images are logged one by one.
+func (s *Scrubber) Scrub(ctx context.Context) {
+	const fn = "scrub.Scrub"
+
+	reports, err := Check(ctx, s.targets)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		s.log.Error(err.Error(), slog.String("fn", fn))
+	}
+
+	for _, r := range reports {
+		log := s.log.With(slog.String("fn", fn), slog.String("tenant", r.Tenant))
+		for _, p := range r.Problems {
+			if p.Corrupt() {
+				log.Error("corrupt image", slog.String("kind", p.Kind), slog.String("path", p.Path),
+					slog.String("detail", p.Detail), slog.String("action", p.Action))
+			}
+		}
+
+		level := slog.LevelInfo
+		if len(r.Problems) > 0 {
+			level = slog.LevelWarn
+		}
+		log.Log(ctx, level, "scrub finished", slog.Int("images", r.Images), slog.Int64("bytes", r.Bytes),
+			slog.Int("problems", len(r.Problems)), slog.Int("corrupt", r.Corrupt()),
+			slog.Int("repaired", r.Repaired()), slog.Int64("duration_ms", r.DurationMs))
+	}
+
+	if s.reportPath != "" {
+		if err := WriteReport(s.reportPath, reports); err != nil {
+			s.log.Error(err.Error(), slog.String("fn", fn))
+		}
+	}
+}
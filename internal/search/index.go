@@ -0,0 +1,263 @@
+package search
+
+import (
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// trigram length used to index names for substring search
+const gram = 3
+
+// Doc is an indexed image.
+type Doc struct {
+	Name      string
+	Size      int64
+	CreatedAt time.Time
+	Tags      []string
+	Metadata  map[string]string
+}
+
+// Index is an in-memory inverted index of images.
+// Postings map tokens (name trigrams, tags, ext, metadata pairs) to image names.
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[string]Doc
+	postings map[string]map[string]struct{}
+}
+
+func New() *Index {
+	return &Index{
+		docs:     make(map[string]Doc),
+		postings: make(map[string]map[string]struct{}),
+	}
+}
+
+// Put adds or replaces image in the index.
+func (i *Index) Put(doc Doc) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(doc.Name)
+	put(i.docs, i.postings, doc)
+}
+
+// Remove removes image from the index.
+func (i *Index) Remove(name string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(name)
+}
+
+// Reset replaces all index content. Searches see either old or new content, never a partial one.
+func (i *Index) Reset(docs []Doc) {
+	// the last of docs with the same name wins, like with Put
+	byName := make(map[string]Doc, len(docs))
+	for _, doc := range docs {
+		byName[doc.Name] = doc
+	}
+	postings := make(map[string]map[string]struct{})
+	for _, doc := range byName {
+		put(byName, postings, doc)
+	}
+
+	i.mu.Lock()
+	i.docs = byName
+	i.postings = postings
+	i.mu.Unlock()
+}
+
+// Len returns number of indexed images.
+func (i *Index) Len() int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return len(i.docs)
+}
+
+// Size returns total size of indexed images.
+func (i *Index) Size() int64 {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	var size int64
+	for _, doc := range i.docs {
+		size += doc.Size
+	}
+	return size
+}
+
+// Search returns up to limit images matching the query sorted by name. Zero limit means no limit.
+func (i *Index) Search(q Query, limit int) []Doc {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	var res []Doc
+	for _, name := range i.candidates(q) {
+		doc := i.docs[name]
+		if q.match(doc) {
+			res = append(res, doc)
+		}
+	}
+
+	sort.Slice(res, func(a, b int) bool {
+		return res[a].Name < res[b].Name
+	})
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	return res
+}
+
+// put adds image to docs and postings, the image must not be indexed yet.
+func put(docs map[string]Doc, postings map[string]map[string]struct{}, doc Doc) {
+	docs[doc.Name] = doc
+	for _, token := range tokens(doc) {
+		names, ok := postings[token]
+		if !ok {
+			names = make(map[string]struct{})
+			postings[token] = names
+		}
+		names[doc.Name] = struct{}{}
+	}
+}
+
+// remove removes image from the index, mu must be held.
+func (i *Index) remove(name string) {
+	doc, ok := i.docs[name]
+	if !ok {
+		return
+	}
+
+	for _, token := range tokens(doc) {
+		names := i.postings[token]
+		delete(names, name)
+		if len(names) == 0 {
+			delete(i.postings, token)
+		}
+	}
+	delete(i.docs, name)
+}
+
+// candidates intersects postings of positive indexed terms.
+// Without such terms all images are candidates.
+func (i *Index) candidates(q Query) []string {
+	var sets []map[string]struct{}
+	for _, t := range q.terms {
+		if t.negate {
+			continue
+		}
+		for _, token := range termTokens(t) {
+			sets = append(sets, i.postings[token])
+		}
+	}
+
+	if len(sets) == 0 {
+		names := make([]string, 0, len(i.docs))
+		for name := range i.docs {
+			names = append(names, name)
+		}
+		return names
+	}
+
+	// start from the smallest set
+	slices.SortFunc(sets, func(a, b map[string]struct{}) int {
+		return len(a) - len(b)
+	})
+
+	var names []string
+	for name := range sets[0] {
+		found := true
+		for _, set := range sets[1:] {
+			if _, ok := set[name]; !ok {
+				found = false
+				break
+			}
+		}
+		if found {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func tokens(doc Doc) []string {
+	base := strings.ToLower(path.Base(doc.Name))
+
+	res := trigrams(base)
+	res = append(res, "ext:"+path.Ext(base))
+	for _, tag := range doc.Tags {
+		res = append(res, "tag:"+tag)
+	}
+	for k, v := range doc.Metadata {
+		res = append(res, "meta:"+k+"="+v)
+	}
+	return res
+}
+
+// termTokens returns index tokens every matching image must have.
+func termTokens(t term) []string {
+	switch t.field {
+	case fieldName:
+		return trigrams(t.value)
+	case fieldTag:
+		return []string{"tag:" + t.value}
+	case fieldExt:
+		return []string{"ext:" + t.value}
+	case fieldMeta:
+		return []string{"meta:" + t.key + "=" + t.value}
+	}
+	return nil
+}
+
+func trigrams(s string) []string {
+	if len(s) < gram {
+		return nil
+	}
+
+	seen := make(map[string]struct{}, len(s))
+	res := make([]string, 0, len(s))
+	for i := 0; i+gram <= len(s); i++ {
+		g := "gram:" + s[i:i+gram]
+		if _, ok := seen[g]; ok {
+			continue
+		}
+		seen[g] = struct{}{}
+		res = append(res, g)
+	}
+	return res
+}
+
+func (q Query) match(doc Doc) bool {
+	for _, t := range q.terms {
+		if t.match(doc) == t.negate {
+			return false
+		}
+	}
+	return true
+}
+
+func (t term) match(doc Doc) bool {
+	switch t.field {
+	case fieldName:
+		return strings.Contains(strings.ToLower(path.Base(doc.Name)), t.value)
+	case fieldTag:
+		return slices.Contains(doc.Tags, t.value)
+	case fieldExt:
+		return strings.ToLower(path.Ext(doc.Name)) == t.value
+	case fieldFolder:
+		return strings.HasPrefix(strings.ToLower(doc.Name), t.value+"/")
+	case fieldMeta:
+		v, ok := doc.Metadata[t.key]
+		return ok && v == t.value
+	case fieldSize:
+		return compareInt(doc.Size, t.op, t.num)
+	case fieldCreated:
+		return compareTime(doc.CreatedAt, t.op, t.time)
+	}
+	return false
+}
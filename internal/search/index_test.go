@@ -0,0 +1,141 @@
+package search
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func names(docs []Doc) []string {
+	res := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		res = append(res, doc.Name)
+	}
+	return res
+}
+
+func TestIndexSearch(t *testing.T) {
+	created := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	docs := []Doc{
+		{Name: "cat.png", Size: 100, CreatedAt: created, Tags: []string{"red"}},
+		{Name: "albums/black cat.jpg", Size: 2 << 20, CreatedAt: created.AddDate(0, 0, 1)},
+		{Name: "dog.png", Size: 300, CreatedAt: created, Tags: []string{"red"}, Metadata: map[string]string{"owner": "ivan"}},
+		{Name: "catalog.png", Size: 400, CreatedAt: created, Tags: []string{"blue"}},
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		limit int
+		want  []string
+	}{
+		{name: "all", query: "", want: []string{"albums/black cat.jpg", "cat.png", "catalog.png", "dog.png"}},
+		{name: "name", query: "cat", want: []string{"albums/black cat.jpg", "cat.png", "catalog.png"}},
+		{name: "tag", query: "tag:red", want: []string{"cat.png", "dog.png"}},
+		{name: "negated", query: "cat -tag:blue", want: []string{"albums/black cat.jpg", "cat.png"}},
+		{name: "folder", query: "folder:albums", want: []string{"albums/black cat.jpg"}},
+		{name: "metadata", query: "owner=ivan", want: []string{"dog.png"}},
+		{name: "size", query: "size>1MB", want: []string{"albums/black cat.jpg"}},
+		{name: "created", query: "created>2024-01-02", want: []string{"albums/black cat.jpg"}},
+		{name: "limit", query: "ext:png", limit: 2, want: []string{"cat.png", "catalog.png"}},
+		// limit applies to matching images, not to candidates of the index
+		{name: "limit after filter", query: "ext:png -tag:red", limit: 1, want: []string{"catalog.png"}},
+		{name: "nothing", query: "tag:green", want: []string{}},
+	}
+
+	i := New()
+	i.Reset(docs)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Parse(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := names(i.Search(q, tt.limit))
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("Search(%q, %d) = %q, want %q", tt.query, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexReset(t *testing.T) {
+	tests := []struct {
+		name  string
+		put   []Doc
+		reset []Doc
+		query string
+		want  []string
+	}{
+		{
+			name:  "replaces content",
+			put:   []Doc{{Name: "old.png", Tags: []string{"red"}}},
+			reset: []Doc{{Name: "new.png", Tags: []string{"blue"}}},
+			query: "tag:red",
+			want:  []string{},
+		},
+		{
+			name:  "last duplicate wins",
+			reset: []Doc{{Name: "a.png", Tags: []string{"red"}}, {Name: "a.png", Tags: []string{"blue"}}},
+			query: "tag:red",
+			want:  []string{},
+		},
+		{
+			name:  "indexes tokens",
+			reset: []Doc{{Name: "a.png", Tags: []string{"red"}}, {Name: "b.png", Tags: []string{"red"}}},
+			query: "tag:red",
+			want:  []string{"a.png", "b.png"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := New()
+			for _, doc := range tt.put {
+				i.Put(doc)
+			}
+			i.Reset(tt.reset)
+
+			q, err := Parse(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := names(i.Search(q, 0))
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("Search(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexResetAtomic(t *testing.T) {
+	sets := make([][]Doc, 2)
+	for n, size := range []int{1000, 2000} {
+		for k := 0; k < size; k++ {
+			sets[n] = append(sets[n], Doc{Name: fmt.Sprintf("%d.png", k)})
+		}
+	}
+
+	i := New()
+	i.Reset(sets[0])
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for n := 1; n <= 20; n++ {
+			i.Reset(sets[n%2])
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if n := i.Len(); n != 1000 && n != 2000 {
+			<-done
+			t.Fatalf("Len() during Reset = %d, want 1000 or 2000", n)
+		}
+	}
+}
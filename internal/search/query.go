@@ -0,0 +1,226 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+const dateFormat = "2006-01-02"
+
+type field int
+
+const (
+	fieldName field = iota
+	fieldTag
+	fieldExt
+	fieldFolder
+	fieldMeta
+	fieldSize
+	fieldCreated
+)
+
+type op int
+
+const (
+	opEq op = iota
+	opLt
+	opLe
+	opGt
+	opGe
+)
+
+// term is a single query condition.
+type term struct {
+	negate bool
+	field  field
+	op     op
+	key    string
+	value  string
+	num    int64
+	time   time.Time
+}
+
+// Query is a parsed search query, all terms must match.
+type Query struct {
+	terms []term
+}
+
+// Parse parses search query. Terms are separated by spaces and all must match:
+//
+//	cat            name contains "cat"
+//	name:cat       the same
+//	tag:red        has tag
+//	ext:png        extension
+//	folder:albums  image is in the folder or its subfolders
+//	owner=ivan     metadata value
+//	size>1MB       size comparison: = < <= > >=, units B, KB, MB, GB
+//	created<2024-01-02  upload date comparison: = < <= > >=
+//
+// Term prefixed with "-" is negated.
+func Parse(query string) (Query, error) {
+	fields := strings.Fields(query)
+	q := Query{terms: make([]term, 0, len(fields))}
+
+	for _, f := range fields {
+		t, err := parseTerm(f)
+		if err != nil {
+			return Query{}, err
+		}
+		q.terms = append(q.terms, t)
+	}
+	return q, nil
+}
+
+func parseTerm(s string) (term, error) {
+	var t term
+	if rest, ok := strings.CutPrefix(s, "-"); ok && rest != "" {
+		t.negate = true
+		s = rest
+	}
+
+	for _, prefix := range []struct {
+		name  string
+		field field
+	}{
+		{"name:", fieldName},
+		{"tag:", fieldTag},
+		{"ext:", fieldExt},
+		{"folder:", fieldFolder},
+	} {
+		if value, ok := strings.CutPrefix(s, prefix.name); ok {
+			if value == "" {
+				return term{}, fmt.Errorf("%w: empty value in %q", ErrInvalidQuery, s)
+			}
+			t.field = prefix.field
+			t.value = strings.ToLower(value)
+			if t.field == fieldExt && !strings.HasPrefix(t.value, ".") {
+				t.value = "." + t.value
+			}
+			if t.field == fieldFolder {
+				t.value = strings.Trim(t.value, "/")
+			}
+			return t, nil
+		}
+	}
+
+	if key, o, value, ok := cutOp(s); ok {
+		switch key {
+		case "size":
+			n, err := parseSize(value)
+			if err != nil {
+				return term{}, fmt.Errorf("%w: %q: %v", ErrInvalidQuery, s, err)
+			}
+			t.field, t.op, t.num = fieldSize, o, n
+		case "created":
+			tm, err := parseTime(value)
+			if err != nil {
+				return term{}, fmt.Errorf("%w: %q: %v", ErrInvalidQuery, s, err)
+			}
+			t.field, t.op, t.time = fieldCreated, o, tm
+		default:
+			if o != opEq || key == "" {
+				return term{}, fmt.Errorf("%w: %q: metadata supports only =", ErrInvalidQuery, s)
+			}
+			t.field, t.key, t.value = fieldMeta, key, value
+		}
+		return t, nil
+	}
+
+	t.field = fieldName
+	t.value = strings.ToLower(s)
+	return t, nil
+}
+
+// cutOp splits "key<op>value" term.
+func cutOp(s string) (string, op, string, bool) {
+	i := strings.IndexAny(s, "=<>")
+	if i < 0 {
+		return "", 0, "", false
+	}
+	key, rest := s[:i], s[i:]
+
+	for _, o := range []struct {
+		token string
+		op    op
+	}{
+		{"<=", opLe},
+		{">=", opGe},
+		{"<", opLt},
+		{">", opGt},
+		{"=", opEq},
+	} {
+		if value, ok := strings.CutPrefix(rest, o.token); ok {
+			return key, o.op, value, true
+		}
+	}
+	return "", 0, "", false
+}
+
+func parseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		mul    int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	}
+
+	upper := strings.ToUpper(s)
+	mul := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(upper, u.suffix) {
+			upper = strings.TrimSuffix(upper, u.suffix)
+			mul = u.mul
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * mul, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(dateFormat, s)
+}
+
+func compareInt(a int64, o op, b int64) bool {
+	switch o {
+	case opLt:
+		return a < b
+	case opLe:
+		return a <= b
+	case opGt:
+		return a > b
+	case opGe:
+		return a >= b
+	}
+	return a == b
+}
+
+// compareTime compares time with the query value. Equality means the same day.
+func compareTime(a time.Time, o op, b time.Time) bool {
+	switch o {
+	case opLt:
+		return a.Before(b)
+	case opLe:
+		return !a.After(b)
+	case opGt:
+		return a.After(b)
+	case opGe:
+		return !a.Before(b)
+	}
+	return a.UTC().Format(dateFormat) == b.UTC().Format(dateFormat)
+}
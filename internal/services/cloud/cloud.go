@@ -2,75 +2,467 @@ package cloud
 
 import (
 	"bytes"
+	"cloud/internal/domain/models"
+	"cloud/internal/imaging"
+	"cloud/internal/search"
+	"cloud/internal/storage"
 	"cloud/internal/storage/drive"
+	"cloud/internal/tracing"
+	"context"
+	"errors"
 	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"image"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tracer traces service calls, spans are exported if tracing is set up.
+var tracer = otel.Tracer("cloud/internal/services/cloud")
+
+var (
+	ErrInvalidTag      = errors.New("invalid tag")
+	ErrInvalidMetadata = errors.New("invalid metadata")
+	ErrInvalidFilter   = errors.New("invalid filter")
+	ErrIndexNotLoaded  = errors.New("search index is not loaded")
+	ErrLowDiskSpace    = errors.New("free disk space is below threshold")
+)
+
+const (
+	// minReindexBackoff and maxReindexBackoff bound delay between retries of failed startup reindex.
+	minReindexBackoff = time.Second
+	maxReindexBackoff = 5 * time.Minute
 )
 
 type Cloud struct {
 	log     *slog.Logger
 	storage Storage
+	index   *search.Index
+	// indexed is set once the search index is built from storage.
+	indexed atomic.Bool
+	// reindexMu guards retries of the failed startup reindex, see Check.
+	reindexMu      sync.Mutex
+	reindexAt      time.Time
+	reindexBackoff time.Duration
+
+	// pendingMu makes similarity check and reservation of the hash atomic.
+	pendingMu sync.Mutex
+	// pending are perceptual hashes of decoded uploads being saved by reservation id,
+	// so concurrent similar uploads see each other.
+	pending   map[uint64]uint64
+	pendingID uint64
 }
 
 func New(
 	log *slog.Logger,
 	drive Storage,
 ) *Cloud {
-	return &Cloud{
+	c := &Cloud{
 		log:     log,
 		storage: drive,
+		index:   search.New(),
+		pending: make(map[uint64]uint64),
 	}
+
+	// nothing is uploading yet, so tmp files are left by uploads interrupted by crash
+	removed, err := drive.CleanTmp(context.Background(), 0)
+	if err != nil {
+		log.Error(err.Error(), slog.String("fn", "services.cloud.New"))
+	}
+	if removed > 0 {
+		log.Info("removed tmp files of interrupted uploads", slog.String("fn", "services.cloud.New"),
+			slog.Int("count", removed))
+	}
+
+	// failed reindex is logged and retried by Check
+	_ = c.retryReindex(context.Background())
+
+	return c
 }
 
 type Storage interface {
-	Save(filename string, buf bytes.Buffer) error
-	List() ([]drive.Image, error)
-	Search(filename string) (*os.File, error)
-	FileExists(filename string) (bool, error)
+	Save(ctx context.Context, filename string, buf bytes.Buffer, meta drive.Meta) error
+	List(ctx context.Context) ([]drive.Image, error)
+	Open(ctx context.Context, filename string) (*os.File, error)
+	Delete(ctx context.Context, filename string) error
+	TmpFiles(ctx context.Context) (int, error)
+	CleanTmp(ctx context.Context, olderThan time.Duration) (int, error)
+	Fsck(ctx context.Context, opts drive.FsckOptions) (drive.FsckReport, error)
+	Stat(ctx context.Context, filename string) (drive.Image, error)
+	FileExists(ctx context.Context, filename string) (bool, error)
+	GetMeta(ctx context.Context, filename string) (drive.Meta, error)
+	ListMeta(ctx context.Context) ([]drive.Meta, error)
+	UpdateMeta(ctx context.Context, filename string, update func(meta *drive.Meta)) (drive.Meta, error)
+	CreateFolder(ctx context.Context, folder string) error
+	ListFolder(ctx context.Context, folder string, recursive bool) ([]string, []drive.Image, error)
+	Move(ctx context.Context, filename string, folder string) (string, error)
+	CheckWritable(ctx context.Context) error
+	FreeSpace(ctx context.Context) (uint64, error)
 }
 
-func (c *Cloud) Upload(filename string, buf bytes.Buffer) error {
+// Upload prepares image according to the options and saves it. Returns the stored filename
+// which differs from the original one if the image was transcoded.
+func (c *Cloud) Upload(ctx context.Context, filename string, buf bytes.Buffer, opts models.UploadOptions) (_ string, err error) {
 	const fn = "services.cloud.Upload"
+	ctx, span := tracer.Start(ctx, fn, trace.WithAttributes(attribute.String("filename", filename)))
+	defer tracing.End(span, &err)
 
-	// some business logic
+	tags, err := normalizeTags(opts.Tags)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", fn, err)
+	}
+	if err := validateMetadata(opts.Metadata); err != nil {
+		return "", fmt.Errorf("%s: %w", fn, err)
+	}
+
+	data := buf.Bytes()
+	mime := opts.MIME
+
+	switch {
+	case opts.TranscodeTo != "":
+		_, span := tracer.Start(ctx, "imaging.Transcode")
+		transcoded, err := imaging.Transcode(data, opts.TranscodeTo)
+		tracing.End(span, &err)
+		if err != nil {
+			c.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+			return "", fmt.Errorf("%s: %w", fn, storage.ErrInvalidImage)
+		}
+		data = transcoded
+		filename = strings.TrimSuffix(filename, filepath.Ext(filename)) + opts.TranscodeTo
+		mime = imaging.DetectMIME(data)
+	case mime == imaging.MIMESVG:
+		_, span := tracer.Start(ctx, "imaging.SanitizeSVG")
+		sanitized, err := imaging.SanitizeSVG(data)
+		tracing.End(span, &err)
+		if err != nil {
+			c.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+			return "", fmt.Errorf("%s: %w", fn, storage.ErrInvalidImage)
+		}
+		data = sanitized
+	}
+
+	meta := drive.Meta{
+		Name:      filename,
+		Size:      int64(len(data)),
+		MIME:      mime,
+		Tags:      tags,
+		Metadata:  cleanMetadata(opts.Metadata),
+		CreatedAt: time.Now(),
+	}
+
+	// perceptual data is computed only for formats we can decode
+	_, decodeSpan := tracer.Start(ctx, "imaging.Decode")
+	img, err := imaging.Decode(data)
+	tracing.End(decodeSpan, &err)
+	switch {
+	case errors.Is(err, image.ErrFormat):
+		if opts.RejectSimilar {
+			c.log.InfoContext(ctx, "similarity check skipped: format can't be decoded", slog.String("fn", fn),
+				slog.String("mime", mime))
+		}
+	case err != nil:
+		c.log.InfoContext(ctx, err.Error(), slog.String("fn", fn))
+		return "", fmt.Errorf("%s: %w", fn, storage.ErrInvalidImage)
+	default:
+		_, hashSpan := tracer.Start(ctx, "imaging.Hash")
+		hashImage(&meta, img)
+		hashSpan.End()
 
-	err := c.storage.Save(filename, buf)
+		// the hash is reserved until the image is saved and indexed
+		release, err := c.reserve(ctx, meta.PHash, opts)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", fn, err)
+		}
+		defer release()
+	}
+
+	err = c.storage.Save(ctx, filename, *bytes.NewBuffer(data), meta)
 	if err != nil {
-		return fmt.Errorf("%s: %w", fn, err)
+		return "", fmt.Errorf("%s: %w", fn, err)
 	}
-	return nil
+
+	c.indexImage(ctx, filename)
+
+	return filename, nil
 }
 
-func (c *Cloud) CanUpload(filename string) (bool, error) {
+func (c *Cloud) CanUpload(ctx context.Context, filename string) (_ bool, err error) {
 	const fn = "services.cloud.CanUpload"
-	isExist, err := c.storage.FileExists(filename)
+	ctx, span := tracer.Start(ctx, fn, trace.WithAttributes(attribute.String("filename", filename)))
+	defer tracing.End(span, &err)
+
+	isExist, err := c.storage.FileExists(ctx, filename)
 	if err != nil {
 		return false, fmt.Errorf("%s: %w", fn, err)
 	}
 	return !isExist, err
 }
 
-func (c *Cloud) List() ([]drive.Image, error) {
+// List returns images matching the filter, empty filter matches all images.
+func (c *Cloud) List(ctx context.Context, filter string) (_ []drive.Image, err error) {
 	const fn = "services.cloud.List"
+	ctx, span := tracer.Start(ctx, fn)
+	defer tracing.End(span, &err)
 
-	// some business logic
+	terms, err := parseFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
 
-	images, err := c.storage.List()
+	images, err := c.storage.List(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", fn, err)
 	}
-	return images, nil
+
+	if len(terms) == 0 {
+		return images, nil
+	}
+
+	res := images[:0]
+	for _, file := range images {
+		if matchFilter(terms, file.Tags, file.Metadata) {
+			res = append(res, file)
+		}
+	}
+	return res, nil
 }
 
-func (c *Cloud) Search(filename string) (*os.File, error) {
-	const fn = "services.cloud.Search"
+// Open opens stored image by name.
+func (c *Cloud) Open(ctx context.Context, filename string) (_ *os.File, err error) {
+	const fn = "services.cloud.Open"
+	ctx, span := tracer.Start(ctx, fn, trace.WithAttributes(attribute.String("filename", filename)))
+	defer tracing.End(span, &err)
 
 	// some business logic
 
-	file, err := c.storage.Search(filename)
+	file, err := c.storage.Open(ctx, filename)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", fn, err)
 	}
 	return file, nil
 }
+
+// Stats returns number and size of images and number of tmp files.
+func (c *Cloud) Stats(ctx context.Context) (models.StorageStats, error) {
+	const fn = "services.cloud.Stats"
+
+	tmp, err := c.storage.TmpFiles(ctx)
+	if err != nil {
+		return models.StorageStats{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return models.StorageStats{
+		Images:   c.index.Len(),
+		Bytes:    c.index.Size(),
+		TmpFiles: tmp,
+	}, nil
+}
+
+// CleanTmp removes tmp files older than olderThan, 0 removes all of them. Returns number of removed files.
+func (c *Cloud) CleanTmp(ctx context.Context, olderThan time.Duration) (int, error) {
+	const fn = "services.cloud.CleanTmp"
+
+	removed, err := c.storage.CleanTmp(ctx, olderThan)
+	if err != nil {
+		return removed, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	c.log.InfoContext(ctx, "tmp files removed", slog.String("fn", fn), slog.Int("count", removed),
+		slog.Duration("older_than", olderThan))
+
+	return removed, nil
+}
+
+// Fsck verifies stored images and metadata. Search index is rebuilt if repair quarantined
+// or removed anything, so quarantined images are no longer listed.
+func (c *Cloud) Fsck(ctx context.Context, opts drive.FsckOptions) (drive.FsckReport, error) {
+	const fn = "services.cloud.Fsck"
+
+	report, err := c.storage.Fsck(ctx, opts)
+	if err != nil {
+		return report, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if report.Repaired() > 0 {
+		if _, err := c.Reindex(ctx); err != nil {
+			return report, fmt.Errorf("%s: %w", fn, err)
+		}
+	}
+
+	return report, nil
+}
+
+// Check reports whether the service can serve calls: search index is loaded, storage folders are
+// writable and at least minFreeSpace bytes are free. Free space isn't checked if the platform can't tell it.
+// Failed startup reindex is retried with backoff, so the service recovers once storage is readable.
+func (c *Cloud) Check(ctx context.Context, minFreeSpace uint64) error {
+	const fn = "services.cloud.Check"
+
+	if !c.indexed.Load() {
+		if err := c.retryReindex(ctx); err != nil {
+			return fmt.Errorf("%s: %w: %w", fn, ErrIndexNotLoaded, err)
+		}
+	}
+
+	if err := c.storage.CheckWritable(ctx); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	free, err := c.storage.FreeSpace(ctx)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	if free < minFreeSpace {
+		return fmt.Errorf("%s: %w", fn, ErrLowDiskSpace)
+	}
+	return nil
+}
+
+// retryReindex rebuilds the index unless the previous attempt failed less than backoff ago.
+// Backoff doubles on every failure up to maxReindexBackoff.
+func (c *Cloud) retryReindex(ctx context.Context) error {
+	const fn = "services.cloud.retryReindex"
+
+	c.reindexMu.Lock()
+	defer c.reindexMu.Unlock()
+
+	if c.indexed.Load() {
+		return nil
+	}
+	if wait := time.Until(c.reindexAt); wait > 0 {
+		return fmt.Errorf("%s: next retry in %s", fn, wait.Round(time.Second))
+	}
+
+	_, err := c.Reindex(ctx)
+	if err == nil {
+		c.reindexBackoff = 0
+		return nil
+	}
+	c.reindexBackoff = min(max(2*c.reindexBackoff, minReindexBackoff), maxReindexBackoff)
+	c.reindexAt = time.Now().Add(c.reindexBackoff)
+	c.log.WarnContext(ctx, err.Error(), slog.String("fn", fn), slog.Duration("backoff", c.reindexBackoff))
+	return err
+}
+
+// Delete removes image from storage and search index.
+func (c *Cloud) Delete(ctx context.Context, filename string) (err error) {
+	const fn = "services.cloud.Delete"
+	ctx, span := tracer.Start(ctx, fn, trace.WithAttributes(attribute.String("filename", filename)))
+	defer tracing.End(span, &err)
+
+	if err := c.storage.Delete(ctx, filename); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	c.index.Remove(filename)
+
+	return nil
+}
+
+// FindSimilar returns images whose perceptual hash is within threshold of the given image.
+// Images which format can't be decoded have no hash and no similar images.
+func (c *Cloud) FindSimilar(ctx context.Context, filename string, threshold int) (_ []models.Similar, err error) {
+	const fn = "services.cloud.FindSimilar"
+	ctx, span := tracer.Start(ctx, fn, trace.WithAttributes(attribute.String("filename", filename)))
+	defer tracing.End(span, &err)
+
+	meta, err := c.storage.GetMeta(ctx, filename)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if !meta.Hashed() {
+		return nil, nil
+	}
+
+	similar, err := c.similar(ctx, meta.PHash, threshold, filename)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	return similar, nil
+}
+
+// reserve registers the hash of an upload being saved. If the upload rejects similar images, stored
+// images and other uploads being saved are checked first, atomically with the registration.
+// The returned func removes the reservation.
+func (c *Cloud) reserve(ctx context.Context, hash uint64, opts models.UploadOptions) (func(), error) {
+	const fn = "services.cloud.reserve"
+
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+
+	if opts.RejectSimilar {
+		similar, err := c.similar(ctx, hash, opts.SimilarityThreshold, "")
+		if err != nil {
+			return nil, err
+		}
+		if len(similar) > 0 {
+			c.log.InfoContext(ctx, "similar image found", slog.String("fn", fn),
+				slog.String("similar", similar[0].Name), slog.Int("distance", similar[0].Distance))
+			return nil, storage.ErrSimilarExists
+		}
+		for _, pending := range c.pending {
+			if d := imaging.Distance(hash, pending); d <= opts.SimilarityThreshold {
+				c.log.InfoContext(ctx, "similar image is being uploaded", slog.String("fn", fn), slog.Int("distance", d))
+				return nil, storage.ErrSimilarExists
+			}
+		}
+	}
+
+	c.pendingID++
+	id := c.pendingID
+	c.pending[id] = hash
+
+	return func() {
+		c.pendingMu.Lock()
+		delete(c.pending, id)
+		c.pendingMu.Unlock()
+	}, nil
+}
+
+// hashImage fills perceptual data of the decoded image.
+func hashImage(meta *drive.Meta, img image.Image) {
+	meta.PHash = imaging.DHash(img)
+	meta.HasPHash = true
+	meta.BlurHash = imaging.BlurHash(img)
+	meta.DominantColor = imaging.DominantColor(img)
+}
+
+// similar returns hashed images within threshold of the hash sorted by distance, skipping the excluded one.
+func (c *Cloud) similar(ctx context.Context, hash uint64, threshold int, exclude string) ([]models.Similar, error) {
+	metas, err := c.storage.ListMeta(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []models.Similar
+	for _, meta := range metas {
+		// images without hash would match flat images at distance 0
+		if meta.Name == exclude || !meta.Hashed() {
+			continue
+		}
+		d := imaging.Distance(hash, meta.PHash)
+		if d <= threshold {
+			res = append(res, models.Similar{Name: meta.Name, Distance: d})
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Distance != res[j].Distance {
+			return res[i].Distance < res[j].Distance
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res, nil
+}
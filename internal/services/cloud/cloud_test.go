@@ -0,0 +1,343 @@
+package cloud
+
+import (
+	"bytes"
+	"cloud/internal/config"
+	"cloud/internal/domain/models"
+	"cloud/internal/imaging"
+	"cloud/internal/storage"
+	"cloud/internal/storage/drive"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestCloud(t *testing.T, stored map[string][]byte) *Cloud {
+	t.Helper()
+
+	// storage paths end with separator, like in config
+	root := t.TempDir()
+	cfg := config.StorageConfig{
+		TmpPath:       filepath.Join(root, "tmp") + "/",
+		CompletedPath: filepath.Join(root, "completed") + "/",
+		MetaPath:      filepath.Join(root, "meta") + "/",
+	}
+	for _, dir := range []string{cfg.TmpPath, cfg.CompletedPath, cfg.MetaPath} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// images stored without metadata, like images uploaded before it existed
+	for name, data := range stored {
+		if err := os.WriteFile(filepath.Join(cfg.CompletedPath, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := drive.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(slog.New(slog.NewTextHandler(io.Discard, nil)), s)
+}
+
+// gradient encodes a PNG which brightness grows left to right, or right to left if reversed.
+func gradient(t *testing.T, reversed bool) []byte {
+	t.Helper()
+
+	img := image.NewGray(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			v := uint8(x * 4)
+			if reversed {
+				v = 255 - v
+			}
+			img.SetGray(x, y, color.Gray{Y: v})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUploadRejectSimilar(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		reject    bool
+		threshold int
+		wantErr   error
+	}{
+		{name: "same image", data: gradient(t, false), reject: true, threshold: 10, wantErr: storage.ErrSimilarExists},
+		{name: "exact matches only", data: gradient(t, false), reject: true, threshold: 0, wantErr: storage.ErrSimilarExists},
+		{name: "different image", data: gradient(t, true), reject: true, threshold: 10},
+		{name: "check disabled", data: gradient(t, false), reject: false, threshold: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCloud(t, nil)
+			ctx := context.Background()
+
+			if _, err := c.Upload(ctx, "first.png", *bytes.NewBuffer(gradient(t, false)), models.UploadOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			_, err := c.Upload(ctx, "second.png", *bytes.NewBuffer(tt.data), models.UploadOptions{
+				RejectSimilar:       tt.reject,
+				SimilarityThreshold: tt.threshold,
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Upload() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSimilarSkipsUnhashed(t *testing.T) {
+	c := newTestCloud(t, nil)
+	ctx := context.Background()
+
+	// svg can't be decoded, dHash of a flat image is 0
+	svg := []byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><rect width="10" height="10"/></svg>`)
+	flat := image.NewGray(image.Rect(0, 0, 16, 16))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, flat); err != nil {
+		t.Fatal(err)
+	}
+	reject := models.UploadOptions{RejectSimilar: true}
+
+	if _, err := c.Upload(ctx, "a.svg", *bytes.NewBuffer(svg), models.UploadOptions{MIME: imaging.MIMESVG}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Upload(ctx, "flat.png", *bytes.NewBuffer(buf.Bytes()), reject); err != nil {
+		t.Fatalf("Upload() of flat image error = %v, want nil", err)
+	}
+
+	for _, name := range []string{"a.svg", "flat.png"} {
+		similar, err := c.FindSimilar(ctx, name, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(similar) != 0 {
+			t.Fatalf("FindSimilar(%s) = %+v, want none", name, similar)
+		}
+	}
+
+	// hashed flat images are still similar
+	_, err := c.Upload(ctx, "flat2.png", *bytes.NewBuffer(buf.Bytes()), reject)
+	if !errors.Is(err, storage.ErrSimilarExists) {
+		t.Fatalf("Upload() of second flat image error = %v, want %v", err, storage.ErrSimilarExists)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	tests := []struct {
+		name    string
+		pending uint64
+		hash    uint64
+		opts    models.UploadOptions
+		wantErr error
+	}{
+		{name: "same hash", pending: 0xff, hash: 0xff, opts: models.UploadOptions{RejectSimilar: true},
+			wantErr: storage.ErrSimilarExists},
+		{name: "within threshold", pending: 0xff, hash: 0xfe,
+			opts: models.UploadOptions{RejectSimilar: true, SimilarityThreshold: 1}, wantErr: storage.ErrSimilarExists},
+		{name: "beyond threshold", pending: 0xff, hash: 0xfc,
+			opts: models.UploadOptions{RejectSimilar: true, SimilarityThreshold: 1}},
+		{name: "check disabled", pending: 0xff, hash: 0xff},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCloud(t, nil)
+			ctx := context.Background()
+
+			release, err := c.reserve(ctx, tt.pending, models.UploadOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := c.reserve(ctx, tt.hash, tt.opts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("reserve() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				second()
+			}
+
+			// released hash doesn't reject uploads anymore
+			release()
+			second, err = c.reserve(ctx, tt.hash, tt.opts)
+			if err != nil {
+				t.Fatalf("reserve() after release error = %v", err)
+			}
+			second()
+		})
+	}
+}
+
+func TestReindexBackfill(t *testing.T) {
+	tests := []struct {
+		name     string
+		stored   map[string][]byte
+		filename string
+		want     []string
+		wantMIME string
+	}{
+		{
+			name:     "similar legacy images",
+			stored:   map[string][]byte{"a.png": gradient(t, false), "b.png": gradient(t, false), "c.png": gradient(t, true)},
+			filename: "a.png",
+			want:     []string{"b.png"},
+			wantMIME: "image/png",
+		},
+		{
+			name:     "undecodable image",
+			stored:   map[string][]byte{"a.bin": []byte("not an image")},
+			filename: "a.bin",
+			want:     nil,
+			wantMIME: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// New reindexes storage
+			c := newTestCloud(t, tt.stored)
+			ctx := context.Background()
+
+			meta, err := c.storage.GetMeta(ctx, tt.filename)
+			if err != nil {
+				t.Fatalf("GetMeta() error = %v", err)
+			}
+			if meta.MIME != tt.wantMIME || meta.Size != int64(len(tt.stored[tt.filename])) {
+				t.Fatalf("GetMeta() = %+v, want mime %q", meta, tt.wantMIME)
+			}
+
+			similar, err := c.FindSimilar(ctx, tt.filename, 0)
+			if err != nil {
+				t.Fatalf("FindSimilar() error = %v", err)
+			}
+			var got []string
+			for _, s := range similar {
+				got = append(got, s.Name)
+			}
+			if len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) {
+				t.Fatalf("FindSimilar() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   int
+		removed string
+		want    []string
+	}{
+		{name: "no limit", limit: 0, want: []string{"a.png", "b.png", "c.png"}},
+		{name: "limit", limit: 2, want: []string{"a.png", "b.png"}},
+		{name: "limit after removed", limit: 2, removed: "a.png", want: []string{"b.png", "c.png"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := gradient(t, false)
+			c := newTestCloud(t, map[string][]byte{"a.png": data, "b.png": data, "c.png": data})
+			ctx := context.Background()
+
+			// removed from disk behind the index
+			if tt.removed != "" {
+				file, err := c.storage.Open(ctx, tt.removed)
+				if err != nil {
+					t.Fatal(err)
+				}
+				file.Close()
+				if err := os.Remove(file.Name()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			images, err := c.Search(ctx, "ext:png", tt.limit)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			var got []string
+			for _, image := range images {
+				got = append(got, image.Name)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Search() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Search() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// failingStorage fails listing while fail is set.
+type failingStorage struct {
+	Storage
+	fail bool
+}
+
+func (s *failingStorage) List(ctx context.Context) ([]drive.Image, error) {
+	if s.fail {
+		return nil, errors.New("storage is unavailable")
+	}
+	return s.Storage.List(ctx)
+}
+
+func TestCheckRetriesReindex(t *testing.T) {
+	tests := []struct {
+		name string
+		// recovered is whether storage is readable by the retry
+		recovered bool
+		// elapsed is whether backoff has passed since the failed attempt
+		elapsed     bool
+		wantErr     error
+		wantBackoff time.Duration
+	}{
+		{name: "recovered", recovered: true, elapsed: true},
+		{name: "still failing", elapsed: true, wantErr: ErrIndexNotLoaded, wantBackoff: 2 * minReindexBackoff},
+		{name: "within backoff", recovered: true, wantErr: ErrIndexNotLoaded, wantBackoff: minReindexBackoff},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCloud(t, map[string][]byte{"a.png": gradient(t, false)})
+			s := &failingStorage{Storage: c.storage, fail: true}
+			c = New(slog.New(slog.NewTextHandler(io.Discard, nil)), s)
+			if err := c.Check(context.Background(), 0); !errors.Is(err, ErrIndexNotLoaded) {
+				t.Fatalf("Check() error = %v, want %v", err, ErrIndexNotLoaded)
+			}
+
+			s.fail = !tt.recovered
+			if tt.elapsed {
+				c.reindexAt = time.Now()
+			}
+			if err := c.Check(context.Background(), 0); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Check() error = %v, want %v", err, tt.wantErr)
+			}
+			if c.reindexBackoff != tt.wantBackoff {
+				t.Fatalf("backoff = %s, want %s", c.reindexBackoff, tt.wantBackoff)
+			}
+			if tt.wantErr == nil && c.index.Len() != 1 {
+				t.Fatalf("indexed %d images, want 1", c.index.Len())
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package cloud
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// filterTerm is a single condition of a list filter.
+type filterTerm struct {
+	negate bool
+	tag    string
+	key    string
+	value  string
+	// hasValue is false for key existence checks.
+	hasValue bool
+}
+
+// parseFilter parses space separated filter terms:
+// tag:name, !tag:name, key=value, key!=value, key, !key.
+func parseFilter(filter string) ([]filterTerm, error) {
+	fields := strings.Fields(filter)
+	terms := make([]filterTerm, 0, len(fields))
+
+	for _, f := range fields {
+		var t filterTerm
+
+		switch {
+		case strings.Contains(f, "!="):
+			t.key, t.value, _ = strings.Cut(f, "!=")
+			t.negate, t.hasValue = true, true
+		case strings.Contains(f, "="):
+			t.key, t.value, _ = strings.Cut(f, "=")
+			t.hasValue = true
+		default:
+			if rest, ok := strings.CutPrefix(f, "!"); ok {
+				t.negate = true
+				f = rest
+			}
+			if tag, ok := strings.CutPrefix(f, "tag:"); ok {
+				t.tag = strings.ToLower(tag)
+				if !labelRe.MatchString(t.tag) {
+					return nil, fmt.Errorf("%w: %q", ErrInvalidFilter, f)
+				}
+			} else {
+				t.key = f
+			}
+		}
+
+		if t.tag == "" && !labelRe.MatchString(t.key) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidFilter, f)
+		}
+
+		terms = append(terms, t)
+	}
+
+	return terms, nil
+}
+
+// matchFilter reports whether image tags and metadata match all terms.
+func matchFilter(terms []filterTerm, tags []string, metadata map[string]string) bool {
+	for _, t := range terms {
+		var ok bool
+		switch {
+		case t.tag != "":
+			ok = slices.Contains(tags, t.tag)
+		case t.hasValue:
+			v, exists := metadata[t.key]
+			ok = exists && v == t.value
+		default:
+			_, ok = metadata[t.key]
+		}
+
+		if ok == t.negate {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,52 @@
+package cloud
+
+import (
+	"cloud/internal/storage/drive"
+	"cloud/internal/tracing"
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CreateFolder creates folder with all parents.
+func (c *Cloud) CreateFolder(ctx context.Context, folder string) (err error) {
+	const fn = "services.cloud.CreateFolder"
+	ctx, span := tracer.Start(ctx, fn, trace.WithAttributes(attribute.String("folder", folder)))
+	defer tracing.End(span, &err)
+
+	if err := c.storage.CreateFolder(ctx, folder); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	return nil
+}
+
+// ListFolder returns subfolders and images of the folder.
+func (c *Cloud) ListFolder(ctx context.Context, folder string, recursive bool) (_ []string, _ []drive.Image, err error) {
+	const fn = "services.cloud.ListFolder"
+	ctx, span := tracer.Start(ctx, fn, trace.WithAttributes(attribute.String("folder", folder)))
+	defer tracing.End(span, &err)
+
+	folders, images, err := c.storage.ListFolder(ctx, folder, recursive)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	return folders, images, nil
+}
+
+// MoveToFolder moves image to the folder and returns its new name.
+func (c *Cloud) MoveToFolder(ctx context.Context, filename string, folder string) (_ string, err error) {
+	const fn = "services.cloud.MoveToFolder"
+	ctx, span := tracer.Start(ctx, fn, trace.WithAttributes(attribute.String("filename", filename)))
+	defer tracing.End(span, &err)
+
+	name, err := c.storage.Move(ctx, filename, folder)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", fn, err)
+	}
+
+	c.index.Remove(filename)
+	c.indexImage(ctx, name)
+
+	return name, nil
+}
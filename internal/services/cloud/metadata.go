@@ -0,0 +1,157 @@
+package cloud
+
+import (
+	"cloud/internal/storage/drive"
+	"cloud/internal/tracing"
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const maxMetadataValue = 256
+
+var labelRe = regexp.MustCompile(`^[a-zA-Z0-9_.\-/]{1,64}$`)
+
+// GetMeta returns image metadata.
+func (c *Cloud) GetMeta(ctx context.Context, filename string) (_ drive.Meta, err error) {
+	const fn = "services.cloud.GetMeta"
+	ctx, span := tracer.Start(ctx, fn, trace.WithAttributes(attribute.String("filename", filename)))
+	defer tracing.End(span, &err)
+
+	meta, err := c.storage.GetMeta(ctx, filename)
+	if err != nil {
+		return drive.Meta{}, fmt.Errorf("%s: %w", fn, err)
+	}
+	return meta, nil
+}
+
+// SetMetadata merges metadata into image metadata or replaces it. Empty value removes the key.
+func (c *Cloud) SetMetadata(ctx context.Context, filename string, metadata map[string]string, replace bool) (_ drive.Meta, err error) {
+	const fn = "services.cloud.SetMetadata"
+	ctx, span := tracer.Start(ctx, fn, trace.WithAttributes(attribute.String("filename", filename)))
+	defer tracing.End(span, &err)
+
+	if err := validateMetadata(metadata); err != nil {
+		return drive.Meta{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	meta, err := c.updateMeta(ctx, filename, func(meta *drive.Meta) {
+		if replace || meta.Metadata == nil {
+			meta.Metadata = make(map[string]string, len(metadata))
+		}
+		for k, v := range metadata {
+			if v == "" {
+				delete(meta.Metadata, k)
+				continue
+			}
+			meta.Metadata[k] = v
+		}
+	})
+	if err != nil {
+		return drive.Meta{}, fmt.Errorf("%s: %w", fn, err)
+	}
+	return meta, nil
+}
+
+// AddTags adds tags to image.
+func (c *Cloud) AddTags(ctx context.Context, filename string, tags []string) (_ drive.Meta, err error) {
+	const fn = "services.cloud.AddTags"
+	ctx, span := tracer.Start(ctx, fn, trace.WithAttributes(attribute.String("filename", filename)))
+	defer tracing.End(span, &err)
+
+	tags, err = normalizeTags(tags)
+	if err != nil {
+		return drive.Meta{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	meta, err := c.updateMeta(ctx, filename, func(meta *drive.Meta) {
+		meta.Tags = mergeTags(meta.Tags, tags)
+	})
+	if err != nil {
+		return drive.Meta{}, fmt.Errorf("%s: %w", fn, err)
+	}
+	return meta, nil
+}
+
+// RemoveTags removes tags from image.
+func (c *Cloud) RemoveTags(ctx context.Context, filename string, tags []string) (_ drive.Meta, err error) {
+	const fn = "services.cloud.RemoveTags"
+	ctx, span := tracer.Start(ctx, fn, trace.WithAttributes(attribute.String("filename", filename)))
+	defer tracing.End(span, &err)
+
+	tags, err = normalizeTags(tags)
+	if err != nil {
+		return drive.Meta{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	meta, err := c.updateMeta(ctx, filename, func(meta *drive.Meta) {
+		meta.Tags = slices.DeleteFunc(meta.Tags, func(tag string) bool {
+			return slices.Contains(tags, tag)
+		})
+	})
+	if err != nil {
+		return drive.Meta{}, fmt.Errorf("%s: %w", fn, err)
+	}
+	return meta, nil
+}
+
+// updateMeta updates image metadata and search index.
+func (c *Cloud) updateMeta(ctx context.Context, filename string, update func(meta *drive.Meta)) (drive.Meta, error) {
+	meta, err := c.storage.UpdateMeta(ctx, filename, update)
+	if err != nil {
+		return drive.Meta{}, err
+	}
+
+	c.indexImage(ctx, filename)
+
+	return meta, nil
+}
+
+// normalizeTags lowercases, validates, sorts and deduplicates tags.
+func normalizeTags(tags []string) ([]string, error) {
+	res := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !labelRe.MatchString(tag) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidTag, tag)
+		}
+		res = append(res, tag)
+	}
+	slices.Sort(res)
+	return slices.Compact(res), nil
+}
+
+func mergeTags(tags, add []string) []string {
+	res := append(slices.Clone(tags), add...)
+	slices.Sort(res)
+	return slices.Compact(res)
+}
+
+func validateMetadata(metadata map[string]string) error {
+	for k, v := range metadata {
+		if !labelRe.MatchString(k) {
+			return fmt.Errorf("%w: %q", ErrInvalidMetadata, k)
+		}
+		if len(v) > maxMetadataValue {
+			return fmt.Errorf("%w: value of %q is too long", ErrInvalidMetadata, k)
+		}
+	}
+	return nil
+}
+
+// cleanMetadata returns a copy of metadata without empty values.
+func cleanMetadata(metadata map[string]string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+	res := maps.Clone(metadata)
+	maps.DeleteFunc(res, func(_, v string) bool {
+		return v == ""
+	})
+	return res
+}
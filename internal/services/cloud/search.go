@@ -0,0 +1,145 @@
+package cloud
+
+import (
+	"cloud/internal/imaging"
+	"cloud/internal/search"
+	"cloud/internal/storage/drive"
+	"cloud/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// Search returns images matching the query, see search.Parse for the query language.
+func (c *Cloud) Search(ctx context.Context, query string, limit int) (_ []drive.Image, err error) {
+	const fn = "services.cloud.Search"
+	ctx, span := tracer.Start(ctx, fn)
+	defer tracing.End(span, &err)
+
+	q, err := search.Parse(query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	// limited after images removed from disk are skipped
+	docs := c.index.Search(q, 0)
+
+	images := make([]drive.Image, 0, len(docs))
+	for _, doc := range docs {
+		if limit > 0 && len(images) == limit {
+			break
+		}
+		image, err := c.storage.Stat(ctx, doc.Name)
+		if errors.Is(err, os.ErrNotExist) {
+			// removed from disk behind our back
+			c.index.Remove(doc.Name)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+// Reindex rebuilds search index from storage and returns number of indexed images.
+// Images stored without metadata or perceptual data get them, so FindSimilar finds them.
+func (c *Cloud) Reindex(ctx context.Context) (_ int, err error) {
+	const fn = "services.cloud.Reindex"
+	ctx, span := tracer.Start(ctx, fn)
+	defer tracing.End(span, &err)
+
+	images, err := c.storage.List(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	docs := make([]search.Doc, 0, len(images))
+	for _, image := range images {
+		meta, err := c.storage.GetMeta(ctx, image.Name)
+		// size is set on upload, so it's empty for images stored before metadata or tagged since
+		if err != nil || (meta.Size == 0 && image.Size > 0) {
+			meta, err = c.backfill(ctx, image)
+			if err != nil {
+				c.log.WarnContext(ctx, err.Error(), slog.String("fn", fn), slog.String("filename", image.Name))
+			}
+		}
+		docs = append(docs, searchDoc(image, meta))
+	}
+	c.index.Reset(docs)
+	c.indexed.Store(true)
+
+	c.log.InfoContext(ctx, "search index rebuilt", slog.String("fn", fn), slog.Int("images", len(docs)))
+
+	return len(docs), nil
+}
+
+// backfill detects format of the stored image and computes its perceptual data if the format can be
+// decoded, then saves them into its metadata.
+func (c *Cloud) backfill(ctx context.Context, image drive.Image) (drive.Meta, error) {
+	const fn = "services.cloud.backfill"
+
+	file, err := c.storage.Open(ctx, image.Name)
+	if err != nil {
+		return drive.Meta{}, fmt.Errorf("%s: %w", fn, err)
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		return drive.Meta{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	var perceptual drive.Meta
+	if img, err := imaging.Decode(data); err == nil {
+		hashImage(&perceptual, img)
+	}
+
+	meta, err := c.storage.UpdateMeta(ctx, image.Name, func(meta *drive.Meta) {
+		meta.Size = int64(len(data))
+		meta.MIME = imaging.DetectMIME(data)
+		meta.PHash = perceptual.PHash
+		meta.HasPHash = perceptual.HasPHash
+		meta.BlurHash = perceptual.BlurHash
+		meta.DominantColor = perceptual.DominantColor
+		if meta.CreatedAt.IsZero() {
+			meta.CreatedAt = image.ModTime
+		}
+	})
+	if err != nil {
+		return drive.Meta{}, fmt.Errorf("%s: %w", fn, err)
+	}
+	return meta, nil
+}
+
+// indexImage updates image in search index.
+func (c *Cloud) indexImage(ctx context.Context, filename string) {
+	const fn = "services.cloud.indexImage"
+
+	image, err := c.storage.Stat(ctx, filename)
+	if err != nil {
+		c.log.ErrorContext(ctx, err.Error(), slog.String("fn", fn))
+		return
+	}
+	meta, _ := c.storage.GetMeta(ctx, filename)
+
+	c.index.Put(searchDoc(image, meta))
+}
+
+// searchDoc builds index document, images uploaded without metadata use file info.
+func searchDoc(image drive.Image, meta drive.Meta) search.Doc {
+	doc := search.Doc{
+		Name:      image.Name,
+		Size:      image.Size,
+		CreatedAt: meta.CreatedAt,
+		Tags:      image.Tags,
+		Metadata:  image.Metadata,
+	}
+	if doc.CreatedAt.IsZero() {
+		doc.CreatedAt = image.ModTime
+	}
+	return doc
+}
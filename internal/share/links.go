@@ -0,0 +1,268 @@
+package share
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidLink    = errors.New("invalid share link")
+	ErrExpired        = errors.New("share link expired")
+	ErrLimitExceeded  = errors.New("share link download limit exceeded")
+	ErrInvalidTTL     = errors.New("share link ttl exceeds the limit")
+	ErrMissingSecret  = errors.New("share link secret is not set")
+	ErrMissingBaseURL = errors.New("share link base url is not set")
+)
+
+const (
+	filePerm = 0o640
+	dirPerm  = 0o750
+)
+
+// Link is a signed permission to download one image.
+type Link struct {
+	ID     string `json:"id"`
+	Tenant string `json:"t"`
+	Name   string `json:"n"`
+	// ExpiresAt is unix time in seconds.
+	ExpiresAt int64 `json:"e"`
+	// MaxDownloads is download limit, 0 means no limit.
+	MaxDownloads int `json:"m,omitempty"`
+}
+
+// Links issues and verifies share links.
+//
+// Link is self-contained: image, expiry and limit are signed with HMAC-SHA256,
+// only download counters of limited links are kept until the link expires.
+type Links struct {
+	secret     []byte
+	baseURL    string
+	defaultTTL time.Duration
+	maxTTL     time.Duration
+	// statePath is file counters are saved to on every change, empty - they are reset by restart.
+	statePath string
+
+	mu       sync.Mutex
+	counters map[string]counter
+}
+
+// counter is downloads of a link.
+type counter struct {
+	Downloads int `json:"downloads"`
+	// ExpiresAt is unix time in seconds the counter is forgotten at.
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+// New creates link issuer. Zero maxTTL disables ttl limit. Counters are loaded from statePath
+// if it exists, empty statePath keeps them in memory only.
+func New(secret string, baseURL string, defaultTTL time.Duration, maxTTL time.Duration, statePath string) (*Links, error) {
+	const fn = "share.New"
+
+	if secret == "" {
+		return nil, fmt.Errorf("%s: %w", fn, ErrMissingSecret)
+	}
+	if baseURL == "" {
+		return nil, fmt.Errorf("%s: %w", fn, ErrMissingBaseURL)
+	}
+
+	l := &Links{
+		secret:     []byte(secret),
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		defaultTTL: defaultTTL,
+		maxTTL:     maxTTL,
+		statePath:  statePath,
+		counters:   make(map[string]counter),
+	}
+	if err := l.load(); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	return l, nil
+}
+
+// Create returns signed url of the image and its expiry time. Zero ttl means default one.
+func (l *Links) Create(tenant string, name string, ttl time.Duration, maxDownloads int) (string, time.Time, error) {
+	const fn = "share.Create"
+
+	if ttl <= 0 {
+		ttl = l.defaultTTL
+	}
+	if l.maxTTL > 0 && ttl > l.maxTTL {
+		return "", time.Time{}, fmt.Errorf("%s: %w: %s", fn, ErrInvalidTTL, l.maxTTL)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", time.Time{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	token, err := l.sign(Link{
+		ID:           hex.EncodeToString(id),
+		Tenant:       tenant,
+		Name:         name,
+		ExpiresAt:    expiresAt.Unix(),
+		MaxDownloads: maxDownloads,
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	// file name at the end is for browsers and is not verified
+	return l.baseURL + "/s/" + token + "/" + url.PathEscape(path.Base(name)), expiresAt, nil
+}
+
+// Verify checks token signature and expiry.
+func (l *Links) Verify(token string) (Link, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return Link{}, ErrInvalidLink
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, l.mac(payload)) {
+		return Link{}, ErrInvalidLink
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return Link{}, ErrInvalidLink
+	}
+	var link Link
+	if err := json.Unmarshal(data, &link); err != nil {
+		return Link{}, ErrInvalidLink
+	}
+
+	if time.Now().Unix() >= link.ExpiresAt {
+		return Link{}, ErrExpired
+	}
+	return link, nil
+}
+
+// Use counts a download of the link. The download isn't counted if it can't be saved.
+func (l *Links) Use(link Link) error {
+	const fn = "share.Use"
+
+	if link.MaxDownloads <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune()
+
+	c := l.counters[link.ID]
+	if c.Downloads >= link.MaxDownloads {
+		return ErrLimitExceeded
+	}
+	l.counters[link.ID] = counter{Downloads: c.Downloads + 1, ExpiresAt: link.ExpiresAt}
+	if err := l.save(); err != nil {
+		l.counters[link.ID] = c
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	return nil
+}
+
+// Release takes back a download counted by Use which didn't serve the image.
+func (l *Links) Release(link Link) error {
+	const fn = "share.Release"
+
+	if link.MaxDownloads <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c, ok := l.counters[link.ID]
+	if !ok || c.Downloads == 0 {
+		return nil
+	}
+	l.counters[link.ID] = counter{Downloads: c.Downloads - 1, ExpiresAt: c.ExpiresAt}
+	if err := l.save(); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	return nil
+}
+
+// prune forgets counters of expired links, mu must be held.
+func (l *Links) prune() {
+	now := time.Now().Unix()
+	for id, c := range l.counters {
+		if now >= c.ExpiresAt {
+			delete(l.counters, id)
+		}
+	}
+}
+
+// load reads counters saved by previous runs.
+func (l *Links) load() error {
+	if l.statePath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(l.statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &l.counters); err != nil {
+		return fmt.Errorf("%s: %w", l.statePath, err)
+	}
+	l.prune()
+	return nil
+}
+
+// save replaces saved counters, mu must be held.
+func (l *Links) save() error {
+	if l.statePath == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(l.counters)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.statePath), dirPerm); err != nil {
+		return err
+	}
+
+	tmp := l.statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, filePerm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, l.statePath); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func (l *Links) sign(link Link) (string, error) {
+	data, err := json.Marshal(link)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(l.mac(payload)), nil
+}
+
+func (l *Links) mac(payload string) []byte {
+	h := hmac.New(sha256.New, l.secret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
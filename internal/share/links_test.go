@@ -0,0 +1,168 @@
+package share
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLinks(t *testing.T, statePath string) *Links {
+	t.Helper()
+
+	l, err := New("secret", "http://localhost/", time.Hour, 24*time.Hour, statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// token returns token of the link url.
+func token(t *testing.T, url string) string {
+	t.Helper()
+
+	rest, ok := strings.CutPrefix(url, "http://localhost/s/")
+	if !ok {
+		t.Fatalf("unexpected link %s", url)
+	}
+	token, _, _ := strings.Cut(rest, "/")
+	return token
+}
+
+func TestVerify(t *testing.T) {
+	l := newTestLinks(t, "")
+	other, err := New("other", "http://localhost", time.Hour, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid, _, err := l.Create("default", "albums/a.png", 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, _, err := other.Create("default", "albums/a.png", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := l.sign(Link{ID: "1", Tenant: "default", Name: "a.png", ExpiresAt: time.Now().Add(-time.Second).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		want    string
+		wantErr error
+	}{
+		{name: "valid", token: token(t, valid), want: "albums/a.png"},
+		{name: "forged", token: token(t, forged), wantErr: ErrInvalidLink},
+		{name: "expired", token: expired, wantErr: ErrExpired},
+		{name: "tampered", token: "x" + token(t, valid), wantErr: ErrInvalidLink},
+		{name: "malformed", token: "abc", wantErr: ErrInvalidLink},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link, err := l.Verify(tt.token)
+			if !errors.Is(err, tt.wantErr) || link.Name != tt.want {
+				t.Fatalf("Verify() = %+v, %v, want %q, %v", link, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateTTL(t *testing.T) {
+	l := newTestLinks(t, "")
+
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		want    time.Duration
+		wantErr error
+	}{
+		{name: "default", ttl: 0, want: time.Hour},
+		{name: "requested", ttl: 2 * time.Hour, want: 2 * time.Hour},
+		{name: "above limit", ttl: 48 * time.Hour, wantErr: ErrInvalidTTL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, expiresAt, err := l.Create("default", "a.png", tt.ttl, 0)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Create() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := time.Until(expiresAt); got > tt.want || got < tt.want-2*time.Second {
+				t.Fatalf("Create() expires in %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUse(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour).Unix()
+
+	tests := []struct {
+		name     string
+		max      int
+		uses     int
+		releases int
+		// restart reloads counters from the state file before the last use
+		restart bool
+		wantErr error
+	}{
+		{name: "unlimited", max: 0, uses: 10},
+		{name: "within limit", max: 3, uses: 2},
+		{name: "at limit", max: 2, uses: 2, wantErr: ErrLimitExceeded},
+		{name: "released", max: 2, uses: 2, releases: 1},
+		{name: "restart keeps counters", max: 2, uses: 2, restart: true, wantErr: ErrLimitExceeded},
+		{name: "restart keeps released", max: 2, uses: 2, releases: 1, restart: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statePath := filepath.Join(t.TempDir(), "state", "links.json")
+			l := newTestLinks(t, statePath)
+			link := Link{ID: "id", Tenant: "default", Name: "a.png", ExpiresAt: expiresAt, MaxDownloads: tt.max}
+
+			for i := 0; i < tt.uses; i++ {
+				if err := l.Use(link); err != nil {
+					t.Fatalf("Use() #%d error = %v", i+1, err)
+				}
+			}
+			for i := 0; i < tt.releases; i++ {
+				if err := l.Release(link); err != nil {
+					t.Fatalf("Release() error = %v", err)
+				}
+			}
+			if tt.restart {
+				l = newTestLinks(t, statePath)
+			}
+
+			if err := l.Use(link); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Use() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadPrunesExpired(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "links.json")
+	l := newTestLinks(t, statePath)
+
+	link := Link{ID: "id", ExpiresAt: time.Now().Add(time.Second).Unix(), MaxDownloads: 1}
+	if err := l.Use(link); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Until(time.Unix(link.ExpiresAt, 0)))
+
+	l = newTestLinks(t, statePath)
+	if n := len(l.counters); n != 0 {
+		t.Fatalf("counters after expiry = %d, want 0", n)
+	}
+}
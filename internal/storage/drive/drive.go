@@ -4,23 +4,72 @@ import (
 	"bytes"
 	"cloud/internal/config"
 	"cloud/internal/storage"
+	"cloud/internal/tracing"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/djherbis/times"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"io/fs"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"time"
+)
+
+// tracer traces disk operations, spans are exported if tracing is set up.
+var tracer = otel.Tracer("cloud/internal/storage/drive")
+
+const (
+	metaExt = ".json"
+	dirPerm = 0o755
 )
 
 type Storage struct {
-	tmpPath       string
-	completedPath string
-	mu            sync.Mutex
+	tmpPath        string
+	completedPath  string
+	metaPath       string
+	quarantinePath string
+	mu             sync.Mutex
+	metaMu         sync.RWMutex
+	meta           map[string]Meta
 }
 
 type Image struct {
-	Name      string
-	CreatedAt string
-	UpdatedAt string
+	Name          string
+	CreatedAt     string
+	UpdatedAt     string
+	BlurHash      string
+	DominantColor string
+	Tags          []string
+	Metadata      map[string]string
+	Size          int64
+	ModTime       time.Time
+}
+
+// Meta is image metadata stored next to the image.
+type Meta struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	// SHA256 is hex checksum of the stored file, empty for images uploaded before checksums.
+	SHA256 string `json:"sha256,omitempty"`
+	MIME   string `json:"mime"`
+	PHash  uint64 `json:"phash"`
+	// HasPHash is set if PHash was computed, images which format can't be decoded have no hash.
+	HasPHash      bool              `json:"has_phash,omitempty"`
+	BlurHash      string            `json:"blur_hash"`
+	DominantColor string            `json:"dominant_color"`
+	CreatedAt     time.Time         `json:"created_at"`
+	Tags          []string          `json:"tags,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
 }
 
 // New init storage.
@@ -43,32 +92,62 @@ func New(cfg config.StorageConfig) (*Storage, error) {
 		return nil, fmt.Errorf("completed storage must be directory")
 	}
 
-	return &Storage{
-		tmpPath:       tmpPath,
-		completedPath: completedPath,
-	}, nil
+	metaPath := cfg.MetaPath
+	info, err = os.Stat(metaPath)
+	if os.IsNotExist(err) {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("meta storage must be directory")
+	}
+
+	s := &Storage{
+		tmpPath:        tmpPath,
+		completedPath:  completedPath,
+		metaPath:       metaPath,
+		quarantinePath: cfg.QuarantinePath,
+	}
+
+	if err := s.loadMeta(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
 }
 
-// Save saves image on disk.
-func (s *Storage) Save(filename string, buf bytes.Buffer) error {
+// Save saves image and its metadata on disk. Checksum of the image is stored in metadata.
+func (s *Storage) Save(ctx context.Context, filename string, buf bytes.Buffer, meta Meta) (err error) {
 	const fn = "drive.Save"
+	ctx, span := tracer.Start(ctx, fn, trace.WithAttributes(attribute.String("filename", filename)))
+	defer tracing.End(span, &err)
+
+	sum := sha256.Sum256(buf.Bytes())
+	meta.SHA256 = hex.EncodeToString(sum[:])
 
-	file, err := s.createFile(filename)
+	file, err := s.createFile(ctx, filename)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
+	_, writeSpan := tracer.Start(ctx, "drive.write", trace.WithAttributes(attribute.Int("size", buf.Len())))
 	_, err = buf.WriteTo(file)
+	tracing.End(writeSpan, &err)
 	if err != nil {
-		err := os.Remove(s.tmpPath + filename)
-		if err != nil {
-			return fmt.Errorf("%s: %w", fn, err)
-		}
-		return fmt.Errorf("%s: cannot write buf to file: %w", fn, err)
+		return fmt.Errorf("%s: cannot write buf to file: %w", fn, errors.Join(err, s.discard(file, filename)))
 	}
 
-	err = s.successUpload(filename)
+	// upload cancelled by client or cut off by shutdown doesn't reach completed folder
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s: %w", fn, errors.Join(context.Cause(ctx), s.discard(file, filename)))
+	}
+
+	err = s.successUpload(ctx, filename)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	err = s.saveMeta(ctx, meta)
 	if err != nil {
 		return fmt.Errorf("%s: %w", fn, err)
 	}
@@ -77,8 +156,10 @@ func (s *Storage) Save(filename string, buf bytes.Buffer) error {
 }
 
 // createFile checks if the file exists and saves it thread safe.
-func (s *Storage) createFile(filename string) (*os.File, error) {
+func (s *Storage) createFile(ctx context.Context, filename string) (_ *os.File, err error) {
 	const fn = "drive.createFile"
+	_, span := tracer.Start(ctx, fn, trace.WithAttributes(attribute.String("filename", filename)))
+	defer tracing.End(span, &err)
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -103,6 +184,9 @@ func (s *Storage) createFile(filename string) (*os.File, error) {
 
 	// create file
 	path := fmt.Sprintf("%s/%s", s.tmpPath, filename)
+	if err := os.MkdirAll(filepath.Dir(path), dirPerm); err != nil {
+		return nil, fmt.Errorf("%s: cannot create tmp folder: %w", fn, err)
+	}
 	file, err := os.Create(path)
 	if err != nil {
 		return nil, fmt.Errorf("%s: cannot create image file: %w", fn, err)
@@ -110,55 +194,89 @@ func (s *Storage) createFile(filename string) (*os.File, error) {
 	return file, nil
 }
 
+// discard closes and removes tmp file of failed upload.
+func (s *Storage) discard(file *os.File, filename string) error {
+	file.Close()
+	if err := os.Remove(s.tmpPath + filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
 // successUpload move file to completed directory
-func (s *Storage) successUpload(filename string) error {
+func (s *Storage) successUpload(ctx context.Context, filename string) (err error) {
 	const fn = "drive.successUpload"
-	err := os.Rename(s.tmpPath+filename, s.completedPath+filename)
+	_, span := tracer.Start(ctx, fn, trace.WithAttributes(attribute.String("filename", filename)))
+	defer tracing.End(span, &err)
+
+	err = os.MkdirAll(filepath.Dir(s.completedPath+filename), dirPerm)
+	if err != nil {
+		return fmt.Errorf("%v: %w", fn, err)
+	}
+	err = os.Rename(s.tmpPath+filename, s.completedPath+filename)
 	if err != nil {
 		return fmt.Errorf("%v: %w", fn, err)
 	}
 	return nil
 }
 
-// List returns all images.
-func (s *Storage) List() ([]Image, error) {
+// List returns all images including ones in folders.
+func (s *Storage) List(ctx context.Context) ([]Image, error) {
 	const fn = "drive.List"
 
-	entries, err := os.ReadDir(s.completedPath)
+	_, images, err := s.ListFolder(ctx, "", true)
 	if err != nil {
 		return nil, fmt.Errorf("%v: %w", fn, err)
 	}
+	return images, nil
+}
 
-	images := make([]Image, 0, len(entries))
-	timeFormat := "02.01.2006 15:04:05"
-	for _, e := range entries {
-		filename := e.Name()
+// Stat returns image info of stored file.
+func (s *Storage) Stat(ctx context.Context, filename string) (Image, error) {
+	const fn = "drive.Stat"
 
-		fileInfo, err := times.Stat(s.completedPath + filename)
-		if err != nil {
-			return nil, fmt.Errorf("%v: %w", fn, err)
-		}
+	stat, err := os.Stat(s.completedPath + filename)
+	if err != nil {
+		return Image{}, fmt.Errorf("%v: %w", fn, err)
+	}
+
+	// times.Get can't read birth time from os.FileInfo on every platform
+	fileInfo, err := times.Stat(s.completedPath + filename)
+	if err != nil {
+		return Image{}, fmt.Errorf("%v: %w", fn, err)
+	}
 
-		updatedAt := fileInfo.ModTime().Format(timeFormat)
+	timeFormat := "02.01.2006 15:04:05"
+	updatedAt := fileInfo.ModTime().Format(timeFormat)
 
-		createdAt := "-"
-		if fileInfo.HasBirthTime() {
-			createdAt = fileInfo.BirthTime().Format(timeFormat)
-		}
+	createdAt := "-"
+	if fileInfo.HasBirthTime() {
+		createdAt = fileInfo.BirthTime().Format(timeFormat)
+	}
 
-		images = append(images, Image{
-			Name:      filename,
-			CreatedAt: createdAt,
-			UpdatedAt: updatedAt,
-		})
+	image := Image{
+		Name:      filename,
+		CreatedAt: createdAt,
+		UpdatedAt: updatedAt,
+		Size:      stat.Size(),
+		ModTime:   fileInfo.ModTime(),
+	}
+	if meta, err := s.GetMeta(ctx, filename); err == nil {
+		image.BlurHash = meta.BlurHash
+		image.DominantColor = meta.DominantColor
+		image.Tags = meta.Tags
+		image.Metadata = meta.Metadata
 	}
 
-	return images, nil
+	return image, nil
 }
 
-// Search searches image on disk.
-func (s *Storage) Search(filename string) (*os.File, error) {
-	const fn = "drive.Search"
+// Open opens image on disk.
+func (s *Storage) Open(ctx context.Context, filename string) (_ *os.File, err error) {
+	const fn = "drive.Open"
+	_, span := tracer.Start(ctx, fn, trace.WithAttributes(attribute.String("filename", filename)))
+	defer tracing.End(span, &err)
+
 	file, err := os.Open(s.completedPath + filename)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", fn, err)
@@ -166,10 +284,53 @@ func (s *Storage) Search(filename string) (*os.File, error) {
 	return file, nil
 }
 
+// Delete removes image with its metadata.
+func (s *Storage) Delete(ctx context.Context, filename string) (err error) {
+	const fn = "drive.Delete"
+	_, span := tracer.Start(ctx, fn, trace.WithAttributes(attribute.String("filename", filename)))
+	defer tracing.End(span, &err)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Lstat(s.completedPath + filename)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	// folders are not images
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s: %w", fn, os.ErrNotExist)
+	}
+
+	if err := os.Remove(s.completedPath + filename); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if err := s.deleteMeta(filename); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return nil
+}
+
+// deleteMeta removes image metadata.
+func (s *Storage) deleteMeta(filename string) error {
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+
+	delete(s.meta, filename)
+
+	err := os.Remove(s.metaPath + filename + metaExt)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
 // FileExists checks file exists.
-func (s *Storage) FileExists(filename string) (bool, error) {
+func (s *Storage) FileExists(ctx context.Context, filename string) (bool, error) {
 	const fn = "drive.FileExists"
-	file, err := s.Search(filename)
+	file, err := s.Open(ctx, filename)
 	if errors.Is(err, os.ErrNotExist) {
 		return false, nil
 	}
@@ -194,3 +355,244 @@ func (s *Storage) fileExistsWithPath(path string, filename string) (bool, error)
 
 	return true, nil
 }
+
+// TmpFiles returns number of files in tmp folder, i.e. uploads in progress or left by failures.
+func (s *Storage) TmpFiles(ctx context.Context) (int, error) {
+	const fn = "drive.TmpFiles"
+
+	count := 0
+	err := filepath.WalkDir(s.tmpPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", fn, err)
+	}
+	return count, nil
+}
+
+// CleanTmp removes files from tmp folder not modified for olderThan, i.e. left by interrupted uploads.
+// Zero olderThan removes all files, it's safe only while there are no uploads in progress.
+func (s *Storage) CleanTmp(ctx context.Context, olderThan time.Duration) (_ int, err error) {
+	const fn = "drive.CleanTmp"
+	_, span := tracer.Start(ctx, fn)
+	defer tracing.End(span, &err)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	err = filepath.WalkDir(s.tmpPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// writability probes are removed right away
+		if !d.Type().IsRegular() || strings.HasPrefix(d.Name(), ".probe-") || d.Name() == ".gitkeep" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if olderThan > 0 && time.Since(info.ModTime()) < olderThan {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("%s: %w", fn, err)
+	}
+	return removed, nil
+}
+
+// CheckWritable creates and removes a probe file in tmp, completed and meta folders.
+func (s *Storage) CheckWritable(ctx context.Context) error {
+	const fn = "drive.CheckWritable"
+
+	for _, dir := range []string{s.tmpPath, s.completedPath, s.metaPath} {
+		file, err := os.CreateTemp(dir, ".probe-*")
+		if err != nil {
+			return fmt.Errorf("%s: %w", fn, err)
+		}
+		file.Close()
+		if err := os.Remove(file.Name()); err != nil {
+			return fmt.Errorf("%s: %w", fn, err)
+		}
+	}
+	return nil
+}
+
+// FreeSpace returns the least free space of file systems of tmp, completed and meta folders.
+// errors.ErrUnsupported is returned if the platform can't tell it.
+func (s *Storage) FreeSpace(ctx context.Context) (uint64, error) {
+	const fn = "drive.FreeSpace"
+
+	var res uint64
+	for i, dir := range []string{s.tmpPath, s.completedPath, s.metaPath} {
+		free, err := freeSpace(dir)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", fn, err)
+		}
+		if i == 0 || free < res {
+			res = free
+		}
+	}
+	return res, nil
+}
+
+// GetMeta returns image metadata.
+func (s *Storage) GetMeta(ctx context.Context, filename string) (Meta, error) {
+	const fn = "drive.GetMeta"
+
+	s.metaMu.RLock()
+	defer s.metaMu.RUnlock()
+
+	meta, ok := s.meta[filename]
+	if !ok {
+		return Meta{}, fmt.Errorf("%s: %w", fn, os.ErrNotExist)
+	}
+	return meta, nil
+}
+
+// ListMeta returns metadata of all images.
+func (s *Storage) ListMeta(ctx context.Context) ([]Meta, error) {
+	s.metaMu.RLock()
+	defer s.metaMu.RUnlock()
+
+	metas := make([]Meta, 0, len(s.meta))
+	for _, meta := range s.meta {
+		metas = append(metas, meta)
+	}
+	return metas, nil
+}
+
+// UpdateMeta atomically applies update to image metadata and saves it.
+// Images uploaded before metadata was introduced get an empty one.
+func (s *Storage) UpdateMeta(ctx context.Context, filename string, update func(meta *Meta)) (_ Meta, err error) {
+	const fn = "drive.UpdateMeta"
+	_, span := tracer.Start(ctx, fn, trace.WithAttributes(attribute.String("filename", filename)))
+	defer tracing.End(span, &err)
+
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+
+	meta, ok := s.meta[filename]
+	if !ok {
+		isExist, err := s.fileExistsWithPath(s.completedPath, filename)
+		if err != nil {
+			return Meta{}, fmt.Errorf("%s: %w", fn, err)
+		}
+		if !isExist {
+			return Meta{}, fmt.Errorf("%s: %w", fn, os.ErrNotExist)
+		}
+		meta = Meta{Name: filename}
+	}
+
+	// readers may hold the old tags and metadata, so they are never changed in place
+	meta = meta.clone()
+	update(&meta)
+
+	if err := s.writeMeta(meta); err != nil {
+		return Meta{}, fmt.Errorf("%s: %w", fn, err)
+	}
+	return meta, nil
+}
+
+// Hashed reports whether the image has perceptual hash. Metadata saved before HasPHash
+// is trusted only with a non-zero hash.
+func (m Meta) Hashed() bool {
+	return m.HasPHash || m.PHash != 0
+}
+
+func (m Meta) clone() Meta {
+	m.Tags = slices.Clone(m.Tags)
+	m.Metadata = maps.Clone(m.Metadata)
+	return m
+}
+
+// saveMeta writes image metadata to disk and updates the index.
+func (s *Storage) saveMeta(ctx context.Context, meta Meta) (err error) {
+	_, span := tracer.Start(ctx, "drive.saveMeta")
+	defer tracing.End(span, &err)
+
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+
+	return s.writeMeta(meta)
+}
+
+// writeMeta writes image metadata to disk and updates the index, metaMu must be held.
+// The file is written to a temporary file first so a crash never leaves half-written metadata.
+func (s *Storage) writeMeta(meta Meta) error {
+	const fn = "drive.writeMeta"
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	path := s.metaPath + meta.Name + metaExt
+	if err := os.MkdirAll(filepath.Dir(path), dirPerm); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	s.meta[meta.Name] = meta
+	return nil
+}
+
+// loadMeta loads metadata index from disk.
+func (s *Storage) loadMeta() error {
+	const fn = "drive.loadMeta"
+
+	s.meta = make(map[string]Meta)
+
+	err := filepath.WalkDir(s.metaPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != metaExt {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		// unreadable metadata doesn't stop the server, fsck reports it
+		var meta Meta
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return nil
+		}
+		if meta.Name == "" {
+			rel, err := filepath.Rel(s.metaPath, path)
+			if err != nil {
+				return err
+			}
+			meta.Name = strings.TrimSuffix(filepath.ToSlash(rel), metaExt)
+		}
+		s.meta[meta.Name] = meta
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return nil
+}
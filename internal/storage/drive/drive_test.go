@@ -0,0 +1,71 @@
+package drive
+
+import (
+	"cloud/internal/config"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestCleanTmp(t *testing.T) {
+	tests := []struct {
+		name      string
+		olderThan time.Duration
+		want      []string
+	}{
+		{name: "all files", olderThan: 0, want: []string{".gitkeep", ".probe-1"}},
+		{name: "older files", olderThan: time.Hour, want: []string{".gitkeep", ".probe-1", "new.png"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			cfg := config.StorageConfig{
+				TmpPath:       filepath.Join(root, "tmp") + "/",
+				CompletedPath: filepath.Join(root, "completed") + "/",
+				MetaPath:      filepath.Join(root, "meta") + "/",
+			}
+			for _, dir := range []string{cfg.TmpPath, cfg.CompletedPath, cfg.MetaPath} {
+				if err := os.Mkdir(dir, 0o755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			old := time.Now().Add(-2 * time.Hour)
+			for _, name := range []string{".gitkeep", ".probe-1", "old.png", "new.png"} {
+				if err := os.WriteFile(cfg.TmpPath+name, nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				if name != "new.png" {
+					if err := os.Chtimes(cfg.TmpPath+name, old, old); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			s, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.CleanTmp(context.Background(), tt.olderThan); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := os.ReadDir(cfg.TmpPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Name())
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("left %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package drive
+
+import (
+	"cloud/internal/storage"
+	"cloud/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// CreateFolder creates folder for images.
+func (s *Storage) CreateFolder(ctx context.Context, folder string) (err error) {
+	const fn = "drive.CreateFolder"
+	_, span := tracer.Start(ctx, fn, trace.WithAttributes(attribute.String("folder", folder)))
+	defer tracing.End(span, &err)
+
+	err = os.Mkdir(s.completedPath+folder, dirPerm)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s: %w", fn, storage.ErrFolderExists)
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		// parent folders are created as well
+		err = os.MkdirAll(s.completedPath+folder, dirPerm)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	return nil
+}
+
+// ListFolder returns subfolders and images of the folder. Recursive listing returns
+// the whole tree, names are relative to the storage root.
+func (s *Storage) ListFolder(ctx context.Context, folder string, recursive bool) (_ []string, _ []Image, err error) {
+	const fn = "drive.ListFolder"
+	ctx, span := tracer.Start(ctx, fn, trace.WithAttributes(attribute.String("folder", folder)))
+	defer tracing.End(span, &err)
+
+	root := s.completedPath + folder
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	if !info.IsDir() {
+		return nil, nil, fmt.Errorf("%s: %w", fn, os.ErrNotExist)
+	}
+
+	var (
+		folders []string
+		images  []Image
+	)
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		// hidden files like .gitkeep are not images
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.completedPath, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			folders = append(folders, name)
+			if !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		image, err := s.Stat(ctx, name)
+		if err != nil {
+			return err
+		}
+		images = append(images, image)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return folders, images, nil
+}
+
+// Move moves image with its metadata to the folder and returns new image name.
+func (s *Storage) Move(ctx context.Context, filename string, folder string) (_ string, err error) {
+	const fn = "drive.Move"
+	_, span := tracer.Start(ctx, fn, trace.WithAttributes(attribute.String("filename", filename)))
+	defer tracing.End(span, &err)
+
+	dest := path.Join(folder, path.Base(filename))
+	if dest == filename {
+		return dest, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	isExist, err := s.fileExistsWithPath(s.completedPath, filename)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", fn, err)
+	}
+	if !isExist {
+		return "", fmt.Errorf("%s: %w", fn, os.ErrNotExist)
+	}
+
+	for _, root := range []string{s.completedPath, s.tmpPath} {
+		isExist, err := s.fileExistsWithPath(root, dest)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", fn, err)
+		}
+		if isExist {
+			return "", fmt.Errorf("%s: %w", fn, storage.ErrFileExists)
+		}
+	}
+
+	if err := os.MkdirAll(s.completedPath+folder, dirPerm); err != nil {
+		return "", fmt.Errorf("%s: %w", fn, err)
+	}
+	if err := os.Rename(s.completedPath+filename, s.completedPath+dest); err != nil {
+		return "", fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if err := s.moveMeta(filename, dest); err != nil {
+		return "", fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return dest, nil
+}
+
+// moveMeta renames image metadata.
+func (s *Storage) moveMeta(filename string, dest string) error {
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+
+	meta, ok := s.meta[filename]
+	if !ok {
+		return nil
+	}
+
+	meta.Name = dest
+	if err := s.writeMeta(meta); err != nil {
+		return err
+	}
+	delete(s.meta, filename)
+
+	err := os.Remove(s.metaPath + filename + metaExt)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
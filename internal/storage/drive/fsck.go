@@ -0,0 +1,482 @@
+package drive
+
+import (
+	"cloud/internal/tracing"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrNoQuarantine = errors.New("quarantine_path is not set, repair is disabled")
+
+// Problem kinds found by Fsck.
+const (
+	// ProblemChecksum is image which content doesn't match checksum of its metadata.
+	ProblemChecksum = "checksum_mismatch"
+	// ProblemSize is image which size doesn't match its metadata.
+	ProblemSize = "size_mismatch"
+	// ProblemZeroSize is empty image file.
+	ProblemZeroSize = "zero_size"
+	// ProblemExt is image with extension no format policy accepts.
+	ProblemExt = "unsupported_ext"
+	// ProblemNoMeta is image without metadata, e.g. uploaded before metadata was introduced.
+	ProblemNoMeta = "missing_meta"
+	// ProblemNoChecksum is image which metadata has no checksum, e.g. uploaded before checksums.
+	ProblemNoChecksum = "missing_checksum"
+	// ProblemOrphanMeta is metadata of image which doesn't exist.
+	ProblemOrphanMeta = "orphan_meta"
+	// ProblemInvalidMeta is metadata file which can't be read or describes another image.
+	ProblemInvalidMeta = "invalid_meta"
+	// ProblemOrphanTmp is tmp file left by interrupted upload or metadata write.
+	ProblemOrphanTmp = "orphan_tmp"
+)
+
+// Repair actions.
+const (
+	ActionQuarantined = "quarantined"
+	ActionRemoved     = "removed"
+	ActionBackfilled  = "backfilled"
+)
+
+// quarantineTimeFormat suffixes quarantined files, so repeated problems of one name don't collide.
+const quarantineTimeFormat = "20060102T150405"
+
+// Problem is inconsistency of stored files.
+type Problem struct {
+	Kind string `json:"kind"`
+	// Path is image name or path of tmp and metadata files relative to their folder.
+	Path   string `json:"path"`
+	Detail string `json:"detail,omitempty"`
+	// Action is what repair did, empty if the problem is only reported.
+	Action string `json:"action,omitempty"`
+}
+
+// Corrupt reports whether the image must not be served.
+func (p Problem) Corrupt() bool {
+	return p.Kind == ProblemChecksum || p.Kind == ProblemSize || p.Kind == ProblemZeroSize
+}
+
+// FsckOptions configure Fsck.
+type FsckOptions struct {
+	// Exts are extensions of supported images, empty - extensions aren't checked.
+	Exts []string
+	// TmpAge is age after which tmp files are orphaned, younger ones belong to uploads in progress. 0 - any age.
+	TmpAge time.Duration
+	// Repair quarantines corrupt images and invalid metadata, removes orphaned tmp and metadata files
+	// and saves missing checksums of images which size matches their metadata.
+	Repair bool
+}
+
+// FsckReport is result of Fsck.
+type FsckReport struct {
+	Started    time.Time `json:"started"`
+	DurationMs int64     `json:"duration_ms"`
+	Images     int       `json:"images"`
+	Bytes      int64     `json:"bytes"`
+	Problems   []Problem `json:"problems"`
+}
+
+// Corrupt returns number of images which must not be served.
+func (r FsckReport) Corrupt() int {
+	n := 0
+	for _, p := range r.Problems {
+		if p.Corrupt() {
+			n++
+		}
+	}
+	return n
+}
+
+// Repaired returns number of problems repair fixed.
+func (r FsckReport) Repaired() int {
+	n := 0
+	for _, p := range r.Problems {
+		if p.Action != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// Fsck verifies stored images against checksums and sizes of their metadata, checks that metadata
+// and images match and finds tmp files left by interrupted uploads. It may run while the storage is used.
+func (s *Storage) Fsck(ctx context.Context, opts FsckOptions) (_ FsckReport, err error) {
+	const fn = "drive.Fsck"
+	ctx, span := tracer.Start(ctx, fn)
+	defer tracing.End(span, &err)
+
+	if opts.Repair && s.quarantinePath == "" {
+		return FsckReport{}, fmt.Errorf("%s: %w", fn, ErrNoQuarantine)
+	}
+
+	report := FsckReport{Started: time.Now(), Problems: make([]Problem, 0)}
+	for _, check := range []func(context.Context, FsckOptions, *FsckReport) error{
+		s.fsckImages,
+		s.fsckMeta,
+		s.fsckTmp,
+	} {
+		if err := check(ctx, opts, &report); err != nil {
+			return report, fmt.Errorf("%s: %w", fn, err)
+		}
+	}
+	report.DurationMs = time.Since(report.Started).Milliseconds()
+
+	return report, nil
+}
+
+// fsckImages checks every image of completed folder.
+func (s *Storage) fsckImages(ctx context.Context, opts FsckOptions, report *FsckReport) error {
+	exts := make(map[string]struct{}, len(opts.Exts))
+	for _, ext := range opts.Exts {
+		exts[strings.ToLower(ext)] = struct{}{}
+	}
+
+	return filepath.WalkDir(s.completedPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// removed while walking
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// writability probes are removed right away
+		if !d.Type().IsRegular() || strings.HasPrefix(d.Name(), ".probe-") || d.Name() == ".gitkeep" {
+			return nil
+		}
+
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.completedPath, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		report.Images++
+		report.Bytes += info.Size()
+
+		problem, err := s.checkImage(name, info, exts)
+		if err != nil || problem == nil {
+			return err
+		}
+		switch {
+		case opts.Repair && problem.Corrupt():
+			ok, err := s.quarantine(name, info)
+			if err != nil {
+				return err
+			}
+			if ok {
+				problem.Action = ActionQuarantined
+			}
+		case opts.Repair && problem.Kind == ProblemNoChecksum:
+			ok, err := s.backfillChecksum(name, info)
+			if err != nil {
+				return err
+			}
+			if ok {
+				problem.Action = ActionBackfilled
+			}
+		}
+		report.Problems = append(report.Problems, *problem)
+		return nil
+	})
+}
+
+// checkImage returns the most severe problem of the image or nil.
+func (s *Storage) checkImage(name string, info fs.FileInfo, exts map[string]struct{}) (*Problem, error) {
+	if info.Size() == 0 {
+		return &Problem{Kind: ProblemZeroSize, Path: name}, nil
+	}
+
+	meta, metaErr := s.GetMeta(context.Background(), name)
+	if metaErr == nil && meta.Size > 0 && meta.Size != info.Size() {
+		return &Problem{
+			Kind:   ProblemSize,
+			Path:   name,
+			Detail: fmt.Sprintf("size %d, metadata %d", info.Size(), meta.Size),
+		}, nil
+	}
+	if metaErr == nil && meta.SHA256 != "" {
+		sum, err := fileChecksum(s.completedPath + name)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if sum != meta.SHA256 {
+			return &Problem{
+				Kind:   ProblemChecksum,
+				Path:   name,
+				Detail: fmt.Sprintf("sha256 %s, metadata %s", sum, meta.SHA256),
+			}, nil
+		}
+	}
+
+	if _, ok := exts[strings.ToLower(filepath.Ext(name))]; len(exts) > 0 && !ok {
+		return &Problem{Kind: ProblemExt, Path: name}, nil
+	}
+	if metaErr != nil {
+		return &Problem{Kind: ProblemNoMeta, Path: name}, nil
+	}
+	if meta.SHA256 == "" {
+		return &Problem{Kind: ProblemNoChecksum, Path: name}, nil
+	}
+	return nil, nil
+}
+
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// quarantine moves corrupt image and its metadata out of completed folder, so it's no longer served.
+// The image isn't moved if it was replaced after the check. Returns whether the image was moved.
+func (s *Storage) quarantine(name string, checked fs.FileInfo) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Lstat(s.completedPath + name)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if info.Size() != checked.Size() || !info.ModTime().Equal(checked.ModTime()) {
+		return false, nil
+	}
+
+	dest := s.quarantinePath + name + "." + time.Now().UTC().Format(quarantineTimeFormat)
+	if err := os.MkdirAll(filepath.Dir(dest), dirPerm); err != nil {
+		return false, err
+	}
+	if err := os.Rename(s.completedPath+name, dest); err != nil {
+		return false, err
+	}
+
+	// metadata is kept next to the image for investigation
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+
+	delete(s.meta, name)
+	err = os.Rename(s.metaPath+name+metaExt, dest+metaExt)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return true, err
+	}
+	return true, nil
+}
+
+// backfillChecksum saves checksum of image which metadata has none. The checksum is saved only if
+// the image wasn't replaced after the check and its size matches the metadata, so content which
+// may be already corrupt isn't trusted. Returns whether the checksum was saved.
+func (s *Storage) backfillChecksum(name string, checked fs.FileInfo) (bool, error) {
+	// hashing doesn't block uploads, the image is compared with the checked one below
+	sum, err := fileChecksum(s.completedPath + name)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Lstat(s.completedPath + name)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if info.Size() != checked.Size() || !info.ModTime().Equal(checked.ModTime()) {
+		return false, nil
+	}
+
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+
+	meta, ok := s.meta[name]
+	if !ok || meta.SHA256 != "" || meta.Size != info.Size() {
+		return false, nil
+	}
+	meta = meta.clone()
+	meta.SHA256 = sum
+	if err := s.writeMeta(meta); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// fsckMeta checks metadata files describe existing images.
+func (s *Storage) fsckMeta(ctx context.Context, opts FsckOptions, report *FsckReport) error {
+	return filepath.WalkDir(s.metaPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.metaPath, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		switch {
+		// metadata is written to a tmp file first
+		case strings.HasSuffix(rel, metaExt+".tmp"):
+			return s.fsckTmpFile(s.metaPath, rel, d, opts, report)
+		case filepath.Ext(rel) != metaExt:
+			return nil
+		}
+
+		name := strings.TrimSuffix(rel, metaExt)
+		problem := s.checkMeta(path, name)
+		if problem == nil {
+			return nil
+		}
+		if opts.Repair {
+			action, err := s.repairMeta(rel, name, problem.Kind)
+			if err != nil {
+				return err
+			}
+			problem.Action = action
+		}
+		report.Problems = append(report.Problems, *problem)
+		return nil
+	})
+}
+
+// checkMeta returns problem of metadata file of the named image or nil.
+func (s *Storage) checkMeta(path string, name string) *Problem {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	var meta Meta
+	if err == nil {
+		err = json.Unmarshal(data, &meta)
+	}
+	if err != nil {
+		return &Problem{Kind: ProblemInvalidMeta, Path: name, Detail: err.Error()}
+	}
+	if meta.Name != "" && meta.Name != name {
+		return &Problem{Kind: ProblemInvalidMeta, Path: name, Detail: fmt.Sprintf("describes %q", meta.Name)}
+	}
+
+	if _, err := os.Lstat(s.completedPath + name); errors.Is(err, os.ErrNotExist) {
+		return &Problem{Kind: ProblemOrphanMeta, Path: name}
+	}
+	return nil
+}
+
+// repairMeta removes orphaned metadata and quarantines invalid one. Returns the action taken.
+func (s *Storage) repairMeta(rel string, name string, kind string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if kind == ProblemOrphanMeta {
+		// image may have been uploaded after the check
+		if _, err := os.Lstat(s.completedPath + name); err == nil {
+			return "", nil
+		}
+		if err := s.deleteMeta(name); err != nil {
+			return "", err
+		}
+		return ActionRemoved, nil
+	}
+
+	dest := s.quarantinePath + rel + "." + time.Now().UTC().Format(quarantineTimeFormat)
+	if err := os.MkdirAll(filepath.Dir(dest), dirPerm); err != nil {
+		return "", err
+	}
+	if err := os.Rename(s.metaPath+rel, dest); err != nil {
+		return "", err
+	}
+	return ActionQuarantined, nil
+}
+
+// fsckTmp finds tmp files left by interrupted uploads.
+func (s *Storage) fsckTmp(ctx context.Context, opts FsckOptions, report *FsckReport) error {
+	return filepath.WalkDir(s.tmpPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !d.Type().IsRegular() || strings.HasPrefix(d.Name(), ".probe-") || d.Name() == ".gitkeep" {
+			return nil
+		}
+		rel, err := filepath.Rel(s.tmpPath, path)
+		if err != nil {
+			return err
+		}
+		return s.fsckTmpFile(s.tmpPath, filepath.ToSlash(rel), d, opts, report)
+	})
+}
+
+// fsckTmpFile reports tmp file of dir older than tmp age and removes it in repair mode.
+func (s *Storage) fsckTmpFile(dir string, rel string, d fs.DirEntry, opts FsckOptions, report *FsckReport) error {
+	info, err := d.Info()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	age := time.Since(info.ModTime())
+	if opts.TmpAge > 0 && age < opts.TmpAge {
+		return nil
+	}
+
+	problem := Problem{Kind: ProblemOrphanTmp, Path: rel, Detail: "age " + age.Round(time.Second).String()}
+	if opts.Repair {
+		s.mu.Lock()
+		err := os.Remove(dir + rel)
+		s.mu.Unlock()
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		problem.Action = ActionRemoved
+	}
+	report.Problems = append(report.Problems, problem)
+	return nil
+}
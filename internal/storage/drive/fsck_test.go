@@ -0,0 +1,120 @@
+package drive
+
+import (
+	"cloud/internal/config"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestStorage stores images with their metadata in a temp dir, metadata without name isn't written.
+func newTestStorage(t *testing.T, images map[string][]byte, metas ...Meta) *Storage {
+	t.Helper()
+
+	// storage paths end with separator, like in config
+	root := t.TempDir()
+	cfg := config.StorageConfig{
+		TmpPath:        filepath.Join(root, "tmp") + "/",
+		CompletedPath:  filepath.Join(root, "completed") + "/",
+		MetaPath:       filepath.Join(root, "meta") + "/",
+		QuarantinePath: filepath.Join(root, "quarantine") + "/",
+	}
+	for _, dir := range []string{cfg.TmpPath, cfg.CompletedPath, cfg.MetaPath} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, data := range images {
+		if err := os.WriteFile(cfg.CompletedPath+name, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, meta := range metas {
+		data, err := json.Marshal(meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(cfg.MetaPath+meta.Name+metaExt, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestFsckBackfillsChecksum(t *testing.T) {
+	data := []byte("image")
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name       string
+		meta       Meta
+		repair     bool
+		wantKind   string
+		wantAction string
+		wantSHA256 string
+	}{
+		{name: "size matches", meta: Meta{Name: "a.png", Size: 5}, repair: true,
+			wantKind: ProblemNoChecksum, wantAction: ActionBackfilled, wantSHA256: checksum},
+		{name: "without repair", meta: Meta{Name: "a.png", Size: 5},
+			wantKind: ProblemNoChecksum},
+		{name: "unknown size", meta: Meta{Name: "a.png"}, repair: true,
+			wantKind: ProblemNoChecksum},
+		{name: "size differs", meta: Meta{Name: "a.png", Size: 4}, repair: true,
+			wantKind: ProblemSize, wantAction: ActionQuarantined},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t, map[string][]byte{"a.png": data}, tt.meta)
+
+			report, err := s.Fsck(context.Background(), FsckOptions{Repair: tt.repair})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Problems) != 1 {
+				t.Fatalf("problems = %+v, want one", report.Problems)
+			}
+			if p := report.Problems[0]; p.Kind != tt.wantKind || p.Action != tt.wantAction {
+				t.Fatalf("problem = %+v, want kind %q, action %q", p, tt.wantKind, tt.wantAction)
+			}
+			if tt.wantAction == ActionQuarantined {
+				return
+			}
+
+			meta, err := s.GetMeta(context.Background(), "a.png")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if meta.SHA256 != tt.wantSHA256 {
+				t.Fatalf("SHA256 = %q, want %q", meta.SHA256, tt.wantSHA256)
+			}
+
+			// the checksum is saved, not only indexed
+			if err := s.loadMeta(); err != nil {
+				t.Fatal(err)
+			}
+			if s.meta["a.png"].SHA256 != tt.wantSHA256 {
+				t.Fatalf("saved SHA256 = %q, want %q", s.meta["a.png"].SHA256, tt.wantSHA256)
+			}
+
+			// the next check verifies the backfilled checksum
+			report, err = s.Fsck(context.Background(), FsckOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantSHA256 != "" && len(report.Problems) != 0 {
+				t.Fatalf("problems after backfill = %+v, want none", report.Problems)
+			}
+		})
+	}
+}
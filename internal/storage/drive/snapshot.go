@@ -0,0 +1,269 @@
+package drive
+
+import (
+	"cloud/internal/tracing"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrChecksumMismatch = errors.New("checksum doesn't match")
+
+// snapshotAttempts is how many times an image is read again if its metadata was replaced while reading,
+// and how many times images moved while snapshotting are looked up again.
+const snapshotAttempts = 3
+
+// SnapshotImage is stored image read consistently with its metadata.
+type SnapshotImage struct {
+	Name string
+	Size int64
+	// SHA256 is hex checksum of the content, computed while reading.
+	SHA256  string
+	ModTime time.Time
+	// Meta is nil for images without metadata.
+	Meta *Meta
+}
+
+// Snapshot calls visit for every image of completed folder with its content and metadata read
+// from disk. Files of uploads in progress aren't visited: they are in tmp folder until complete.
+// Images are those stored when it starts, images moved to another folder meanwhile are visited
+// by their new names. Content always matches checksum of the metadata, an image replaced while
+// it's read is read again. Images which don't match their checksum are corrupt, they're skipped
+// and returned as problems. It may run while the storage is used, also from another process.
+func (s *Storage) Snapshot(ctx context.Context, visit func(img SnapshotImage, content io.Reader) error) (_ []Problem, err error) {
+	const fn = "drive.Snapshot"
+	ctx, span := tracer.Start(ctx, fn)
+	defer tracing.End(span, &err)
+
+	names, err := s.snapshotNames(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	problems := make([]Problem, 0)
+	visited := make(map[string]struct{}, len(names))
+	// moved counts base names of listed images which were gone when read
+	moved := make(map[string]int)
+	for attempt := 0; ; attempt++ {
+		for _, name := range names {
+			if ctx.Err() != nil {
+				return problems, fmt.Errorf("%s: %w", fn, ctx.Err())
+			}
+			visited[name] = struct{}{}
+
+			found, problem, err := s.snapshotImage(name, visit)
+			if err != nil {
+				return problems, fmt.Errorf("%s: %w", fn, err)
+			}
+			if !found {
+				moved[path.Base(name)]++
+			}
+			if problem != nil {
+				problems = append(problems, *problem)
+			}
+		}
+		if len(moved) == 0 || attempt == snapshotAttempts-1 {
+			break
+		}
+
+		// another process doesn't share the lock, so images listed by it may be moved
+		// to folders already walked; Move keeps base name of the image
+		all, err := s.snapshotNames(ctx)
+		if err != nil {
+			return problems, fmt.Errorf("%s: %w", fn, err)
+		}
+		names = names[:0]
+		for _, name := range all {
+			if _, ok := visited[name]; ok {
+				continue
+			}
+			base := path.Base(name)
+			if moved[base] == 0 {
+				continue
+			}
+			moved[base]--
+			if moved[base] == 0 {
+				delete(moved, base)
+			}
+			names = append(names, name)
+		}
+		if len(names) == 0 {
+			break
+		}
+	}
+
+	return problems, nil
+}
+
+// snapshotNames lists images of completed folder. Images aren't moved while they're listed.
+func (s *Storage) snapshotNames(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var names []string
+	err := filepath.WalkDir(s.completedPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if p == s.completedPath {
+			return nil
+		}
+		// hidden files like .gitkeep are not images
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.completedPath, p)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// snapshotImage visits the image once its content matches its metadata.
+// Returns whether the image exists.
+func (s *Storage) snapshotImage(name string, visit func(img SnapshotImage, content io.Reader) error) (bool, *Problem, error) {
+	var detail string
+	for attempt := 0; attempt < snapshotAttempts; attempt++ {
+		// the opened file doesn't change: images are replaced by rename, never written in place
+		file, err := os.Open(s.completedPath + name)
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil, nil
+		}
+		if err != nil {
+			return true, nil, err
+		}
+
+		img, err := s.readSnapshotImage(name, file)
+		if err != nil {
+			file.Close()
+			return true, nil, err
+		}
+		if img.Meta != nil && img.Meta.SHA256 != "" && img.Meta.SHA256 != img.SHA256 {
+			file.Close()
+			detail = fmt.Sprintf("sha256 %s, metadata %s", img.SHA256, img.Meta.SHA256)
+			continue
+		}
+
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			file.Close()
+			return true, nil, err
+		}
+		err = visit(img, file)
+		file.Close()
+		return true, nil, err
+	}
+
+	return true, &Problem{Kind: ProblemChecksum, Path: name, Detail: detail}, nil
+}
+
+// readSnapshotImage computes checksum of the opened image and reads its metadata.
+func (s *Storage) readSnapshotImage(name string, file *os.File) (SnapshotImage, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return SnapshotImage{}, err
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return SnapshotImage{}, err
+	}
+
+	img := SnapshotImage{
+		Name:    name,
+		Size:    info.Size(),
+		SHA256:  hex.EncodeToString(h.Sum(nil)),
+		ModTime: info.ModTime(),
+	}
+
+	// metadata is read after the content, so it's never older than the content of a new upload
+	data, err := os.ReadFile(s.metaPath + name + metaExt)
+	if errors.Is(err, os.ErrNotExist) {
+		return img, nil
+	}
+	if err != nil {
+		return SnapshotImage{}, err
+	}
+	var meta Meta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		// invalid metadata isn't backed up, fsck reports it
+		return img, nil
+	}
+	meta.Name = name
+	img.Meta = &meta
+
+	return img, nil
+}
+
+// Restore stores image of a snapshot with its metadata, nil meta leaves the image without metadata.
+// Existing images aren't replaced. Content which doesn't match sum isn't stored.
+func (s *Storage) Restore(ctx context.Context, img SnapshotImage, content io.Reader) (err error) {
+	const fn = "drive.Restore"
+	ctx, span := tracer.Start(ctx, fn)
+	defer tracing.End(span, &err)
+
+	file, err := s.createFile(ctx, img.Name)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, h), content); err != nil {
+		return fmt.Errorf("%s: %w", fn, errors.Join(err, s.discard(file, img.Name)))
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != img.SHA256 {
+		err := fmt.Errorf("%s: %s: %w", fn, img.Name, ErrChecksumMismatch)
+		return errors.Join(err, s.discard(file, img.Name))
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("%s: %w", fn, errors.Join(err, s.discard(file, img.Name)))
+	}
+	if err := os.Chtimes(s.tmpPath+img.Name, img.ModTime, img.ModTime); err != nil {
+		return fmt.Errorf("%s: %w", fn, errors.Join(err, s.discard(file, img.Name)))
+	}
+
+	if err := s.successUpload(ctx, img.Name); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if img.Meta == nil {
+		return nil
+	}
+	meta := img.Meta.clone()
+	meta.Name = img.Name
+	meta.SHA256 = img.SHA256
+	if err := s.saveMeta(ctx, meta); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package drive
+
+import (
+	"context"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSnapshotMovedImages(t *testing.T) {
+	tests := []struct {
+		name string
+		// change is applied while the first image is visited
+		change func(t *testing.T, s *Storage)
+		want   []string
+	}{
+		{name: "unchanged", change: func(t *testing.T, s *Storage) {}, want: []string{"a/x.png", "b/y.png"}},
+		{name: "moved to walked folder", change: func(t *testing.T, s *Storage) {
+			if _, err := s.Move(context.Background(), "b/y.png", "a"); err != nil {
+				t.Fatal(err)
+			}
+		}, want: []string{"a/x.png", "a/y.png"}},
+		{name: "visited moved", change: func(t *testing.T, s *Storage) {
+			if _, err := s.Move(context.Background(), "a/x.png", "b"); err != nil {
+				t.Fatal(err)
+			}
+		}, want: []string{"a/x.png", "b/y.png"}},
+		{name: "deleted", change: func(t *testing.T, s *Storage) {
+			if err := os.Remove(s.completedPath + "b/y.png"); err != nil {
+				t.Fatal(err)
+			}
+		}, want: []string{"a/x.png"}},
+		{name: "uploaded after start", change: func(t *testing.T, s *Storage) {
+			if err := os.WriteFile(s.completedPath+"c.png", []byte("c"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}, want: []string{"a/x.png", "b/y.png"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t, nil)
+			for _, dir := range []string{"a", "b"} {
+				if err := os.Mkdir(s.completedPath+dir, 0o755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, name := range []string{"a/x.png", "b/y.png"} {
+				if err := os.WriteFile(s.completedPath+name, []byte(name), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var got []string
+			problems, err := s.Snapshot(context.Background(), func(img SnapshotImage, content io.Reader) error {
+				if len(got) == 0 {
+					tt.change(t, s)
+				}
+				data, err := io.ReadAll(content)
+				if err != nil {
+					return err
+				}
+				// content is read from the image opened before the change
+				if img.Size != int64(len(data)) {
+					t.Errorf("%s: read %d bytes, size %d", img.Name, len(data), img.Size)
+				}
+				got = append(got, img.Name)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(problems) != 0 {
+				t.Fatalf("problems = %+v, want none", problems)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("visited %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package drive
+
+import "errors"
+
+// freeSpace isn't supported on the platform.
+func freeSpace(string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
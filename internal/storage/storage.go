@@ -1,7 +1,41 @@
 package storage
 
-import "errors"
+import (
+	"errors"
+	"path"
+	"strings"
+)
 
 var (
-	ErrFileExists = errors.New("file already exists")
+	ErrFileExists    = errors.New("file already exists")
+	ErrSimilarExists = errors.New("similar image already exists")
+	ErrInvalidImage  = errors.New("invalid image content")
+	ErrFolderExists  = errors.New("folder already exists")
+	ErrInvalidPath   = errors.New("invalid path")
 )
+
+// CleanPath normalizes slash separated image or folder path relative to the storage root.
+// Empty path is the root. Traversal, hidden segments and backslashes are rejected.
+func CleanPath(p string) (string, error) {
+	if strings.ContainsAny(p, "\\\x00") {
+		return "", ErrInvalidPath
+	}
+
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return "", nil
+	}
+
+	for _, segment := range strings.Split(p, "/") {
+		// ".." and hidden names, "." is dropped by path.Clean
+		if strings.HasPrefix(segment, ".") && segment != "." {
+			return "", ErrInvalidPath
+		}
+	}
+
+	p = path.Clean(p)
+	if p == "." {
+		return "", nil
+	}
+	return p, nil
+}
@@ -0,0 +1,70 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+func TestEnd(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus codes.Code
+		wantEvents int
+	}{
+		{name: "ok", wantStatus: codes.Unset},
+		{name: "error", err: errors.New("failed"), wantStatus: codes.Error, wantEvents: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+			traced := func() (err error) {
+				_, span := provider.Tracer("test").Start(context.Background(), "traced")
+				defer End(span, &err)
+				return tt.err
+			}
+			_ = traced()
+
+			spans := recorder.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("ended %d spans, want 1", len(spans))
+			}
+			if got := spans[0].Status().Code; got != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", got, tt.wantStatus)
+			}
+			if got := len(spans[0].Events()); got != tt.wantEvents {
+				t.Fatalf("events = %d, want %d", got, tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestSampleRatio(t *testing.T) {
+	tests := []struct {
+		name  string
+		ratio float64
+		want  bool
+	}{
+		{name: "all", ratio: 1, want: true},
+		{name: "none", ratio: 0, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSampler(sampler(tt.ratio)))
+			_, span := provider.Tracer("test").Start(context.Background(), "root")
+			defer span.End()
+
+			if got := span.SpanContext().IsSampled(); got != tt.want {
+				t.Fatalf("sampled = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -25,6 +25,16 @@ type CloudClient interface {
 	Upload(ctx context.Context, opts ...grpc.CallOption) (Cloud_UploadClient, error)
 	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
 	Download(ctx context.Context, in *DownloadRequest, opts ...grpc.CallOption) (Cloud_DownloadClient, error)
+	FindSimilar(ctx context.Context, in *FindSimilarRequest, opts ...grpc.CallOption) (*FindSimilarResponse, error)
+	SetMetadata(ctx context.Context, in *SetMetadataRequest, opts ...grpc.CallOption) (*ImageMetadata, error)
+	AddTags(ctx context.Context, in *TagsRequest, opts ...grpc.CallOption) (*ImageMetadata, error)
+	RemoveTags(ctx context.Context, in *TagsRequest, opts ...grpc.CallOption) (*ImageMetadata, error)
+	CreateFolder(ctx context.Context, in *CreateFolderRequest, opts ...grpc.CallOption) (*CreateFolderResponse, error)
+	ListFolder(ctx context.Context, in *ListFolderRequest, opts ...grpc.CallOption) (*ListFolderResponse, error)
+	MoveToFolder(ctx context.Context, in *MoveToFolderRequest, opts ...grpc.CallOption) (*MoveToFolderResponse, error)
+	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error)
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	CreateShareLink(ctx context.Context, in *CreateShareLinkRequest, opts ...grpc.CallOption) (*ShareLink, error)
 }
 
 type cloudClient struct {
@@ -110,6 +120,96 @@ func (x *cloudDownloadClient) Recv() (*DownloadResponse, error) {
 	return m, nil
 }
 
+func (c *cloudClient) FindSimilar(ctx context.Context, in *FindSimilarRequest, opts ...grpc.CallOption) (*FindSimilarResponse, error) {
+	out := new(FindSimilarResponse)
+	err := c.cc.Invoke(ctx, "/cloud.Cloud/FindSimilar", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cloudClient) SetMetadata(ctx context.Context, in *SetMetadataRequest, opts ...grpc.CallOption) (*ImageMetadata, error) {
+	out := new(ImageMetadata)
+	err := c.cc.Invoke(ctx, "/cloud.Cloud/SetMetadata", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cloudClient) AddTags(ctx context.Context, in *TagsRequest, opts ...grpc.CallOption) (*ImageMetadata, error) {
+	out := new(ImageMetadata)
+	err := c.cc.Invoke(ctx, "/cloud.Cloud/AddTags", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cloudClient) RemoveTags(ctx context.Context, in *TagsRequest, opts ...grpc.CallOption) (*ImageMetadata, error) {
+	out := new(ImageMetadata)
+	err := c.cc.Invoke(ctx, "/cloud.Cloud/RemoveTags", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cloudClient) CreateFolder(ctx context.Context, in *CreateFolderRequest, opts ...grpc.CallOption) (*CreateFolderResponse, error) {
+	out := new(CreateFolderResponse)
+	err := c.cc.Invoke(ctx, "/cloud.Cloud/CreateFolder", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cloudClient) ListFolder(ctx context.Context, in *ListFolderRequest, opts ...grpc.CallOption) (*ListFolderResponse, error) {
+	out := new(ListFolderResponse)
+	err := c.cc.Invoke(ctx, "/cloud.Cloud/ListFolder", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cloudClient) MoveToFolder(ctx context.Context, in *MoveToFolderRequest, opts ...grpc.CallOption) (*MoveToFolderResponse, error) {
+	out := new(MoveToFolderResponse)
+	err := c.cc.Invoke(ctx, "/cloud.Cloud/MoveToFolder", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cloudClient) Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error) {
+	out := new(SearchResponse)
+	err := c.cc.Invoke(ctx, "/cloud.Cloud/Search", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cloudClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, "/cloud.Cloud/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cloudClient) CreateShareLink(ctx context.Context, in *CreateShareLinkRequest, opts ...grpc.CallOption) (*ShareLink, error) {
+	out := new(ShareLink)
+	err := c.cc.Invoke(ctx, "/cloud.Cloud/CreateShareLink", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // CloudServer is the server API for Cloud service.
 // All implementations must embed UnimplementedCloudServer
 // for forward compatibility
@@ -117,6 +217,16 @@ type CloudServer interface {
 	Upload(Cloud_UploadServer) error
 	List(context.Context, *ListRequest) (*ListResponse, error)
 	Download(*DownloadRequest, Cloud_DownloadServer) error
+	FindSimilar(context.Context, *FindSimilarRequest) (*FindSimilarResponse, error)
+	SetMetadata(context.Context, *SetMetadataRequest) (*ImageMetadata, error)
+	AddTags(context.Context, *TagsRequest) (*ImageMetadata, error)
+	RemoveTags(context.Context, *TagsRequest) (*ImageMetadata, error)
+	CreateFolder(context.Context, *CreateFolderRequest) (*CreateFolderResponse, error)
+	ListFolder(context.Context, *ListFolderRequest) (*ListFolderResponse, error)
+	MoveToFolder(context.Context, *MoveToFolderRequest) (*MoveToFolderResponse, error)
+	Search(context.Context, *SearchRequest) (*SearchResponse, error)
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	CreateShareLink(context.Context, *CreateShareLinkRequest) (*ShareLink, error)
 	mustEmbedUnimplementedCloudServer()
 }
 
@@ -133,6 +243,36 @@ func (UnimplementedCloudServer) List(context.Context, *ListRequest) (*ListRespon
 func (UnimplementedCloudServer) Download(*DownloadRequest, Cloud_DownloadServer) error {
 	return status.Errorf(codes.Unimplemented, "method Download not implemented")
 }
+func (UnimplementedCloudServer) FindSimilar(context.Context, *FindSimilarRequest) (*FindSimilarResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FindSimilar not implemented")
+}
+func (UnimplementedCloudServer) SetMetadata(context.Context, *SetMetadataRequest) (*ImageMetadata, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetMetadata not implemented")
+}
+func (UnimplementedCloudServer) AddTags(context.Context, *TagsRequest) (*ImageMetadata, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddTags not implemented")
+}
+func (UnimplementedCloudServer) RemoveTags(context.Context, *TagsRequest) (*ImageMetadata, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveTags not implemented")
+}
+func (UnimplementedCloudServer) CreateFolder(context.Context, *CreateFolderRequest) (*CreateFolderResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateFolder not implemented")
+}
+func (UnimplementedCloudServer) ListFolder(context.Context, *ListFolderRequest) (*ListFolderResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListFolder not implemented")
+}
+func (UnimplementedCloudServer) MoveToFolder(context.Context, *MoveToFolderRequest) (*MoveToFolderResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MoveToFolder not implemented")
+}
+func (UnimplementedCloudServer) Search(context.Context, *SearchRequest) (*SearchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+func (UnimplementedCloudServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedCloudServer) CreateShareLink(context.Context, *CreateShareLinkRequest) (*ShareLink, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateShareLink not implemented")
+}
 func (UnimplementedCloudServer) mustEmbedUnimplementedCloudServer() {}
 
 // UnsafeCloudServer may be embedded to opt out of forward compatibility for this service.
@@ -211,6 +351,186 @@ func (x *cloudDownloadServer) Send(m *DownloadResponse) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _Cloud_FindSimilar_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FindSimilarRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CloudServer).FindSimilar(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cloud.Cloud/FindSimilar",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CloudServer).FindSimilar(ctx, req.(*FindSimilarRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cloud_SetMetadata_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetMetadataRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CloudServer).SetMetadata(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cloud.Cloud/SetMetadata",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CloudServer).SetMetadata(ctx, req.(*SetMetadataRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cloud_AddTags_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TagsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CloudServer).AddTags(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cloud.Cloud/AddTags",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CloudServer).AddTags(ctx, req.(*TagsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cloud_RemoveTags_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TagsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CloudServer).RemoveTags(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cloud.Cloud/RemoveTags",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CloudServer).RemoveTags(ctx, req.(*TagsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cloud_CreateFolder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateFolderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CloudServer).CreateFolder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cloud.Cloud/CreateFolder",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CloudServer).CreateFolder(ctx, req.(*CreateFolderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cloud_ListFolder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFolderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CloudServer).ListFolder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cloud.Cloud/ListFolder",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CloudServer).ListFolder(ctx, req.(*ListFolderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cloud_MoveToFolder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MoveToFolderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CloudServer).MoveToFolder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cloud.Cloud/MoveToFolder",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CloudServer).MoveToFolder(ctx, req.(*MoveToFolderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cloud_Search_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CloudServer).Search(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cloud.Cloud/Search",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CloudServer).Search(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cloud_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CloudServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cloud.Cloud/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CloudServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cloud_CreateShareLink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateShareLinkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CloudServer).CreateShareLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cloud.Cloud/CreateShareLink",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CloudServer).CreateShareLink(ctx, req.(*CreateShareLinkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Cloud_ServiceDesc is the grpc.ServiceDesc for Cloud service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -222,6 +542,46 @@ var Cloud_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "List",
 			Handler:    _Cloud_List_Handler,
 		},
+		{
+			MethodName: "FindSimilar",
+			Handler:    _Cloud_FindSimilar_Handler,
+		},
+		{
+			MethodName: "SetMetadata",
+			Handler:    _Cloud_SetMetadata_Handler,
+		},
+		{
+			MethodName: "AddTags",
+			Handler:    _Cloud_AddTags_Handler,
+		},
+		{
+			MethodName: "RemoveTags",
+			Handler:    _Cloud_RemoveTags_Handler,
+		},
+		{
+			MethodName: "CreateFolder",
+			Handler:    _Cloud_CreateFolder_Handler,
+		},
+		{
+			MethodName: "ListFolder",
+			Handler:    _Cloud_ListFolder_Handler,
+		},
+		{
+			MethodName: "MoveToFolder",
+			Handler:    _Cloud_MoveToFolder_Handler,
+		},
+		{
+			MethodName: "Search",
+			Handler:    _Cloud_Search_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _Cloud_Delete_Handler,
+		},
+		{
+			MethodName: "CreateShareLink",
+			Handler:    _Cloud_CreateShareLink_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -237,3 +597,305 @@ var Cloud_ServiceDesc = grpc.ServiceDesc{
 	},
 	Metadata: "cloudv1/cloudv1.proto",
 }
+
+// CloudAdminClient is the client API for CloudAdmin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CloudAdminClient interface {
+	ListTransfers(ctx context.Context, in *ListTransfersRequest, opts ...grpc.CallOption) (*ListTransfersResponse, error)
+	CancelTransfer(ctx context.Context, in *CancelTransferRequest, opts ...grpc.CallOption) (*CancelTransferResponse, error)
+	SetReadOnly(ctx context.Context, in *SetReadOnlyRequest, opts ...grpc.CallOption) (*ReadOnlyState, error)
+	GetConfig(ctx context.Context, in *GetConfigRequest, opts ...grpc.CallOption) (*GetConfigResponse, error)
+	CleanTmp(ctx context.Context, in *CleanTmpRequest, opts ...grpc.CallOption) (*CleanTmpResponse, error)
+	Reindex(ctx context.Context, in *ReindexRequest, opts ...grpc.CallOption) (*ReindexResponse, error)
+	GetLimits(ctx context.Context, in *GetLimitsRequest, opts ...grpc.CallOption) (*GetLimitsResponse, error)
+}
+
+type cloudAdminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCloudAdminClient(cc grpc.ClientConnInterface) CloudAdminClient {
+	return &cloudAdminClient{cc}
+}
+
+func (c *cloudAdminClient) ListTransfers(ctx context.Context, in *ListTransfersRequest, opts ...grpc.CallOption) (*ListTransfersResponse, error) {
+	out := new(ListTransfersResponse)
+	err := c.cc.Invoke(ctx, "/cloud.CloudAdmin/ListTransfers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cloudAdminClient) CancelTransfer(ctx context.Context, in *CancelTransferRequest, opts ...grpc.CallOption) (*CancelTransferResponse, error) {
+	out := new(CancelTransferResponse)
+	err := c.cc.Invoke(ctx, "/cloud.CloudAdmin/CancelTransfer", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cloudAdminClient) SetReadOnly(ctx context.Context, in *SetReadOnlyRequest, opts ...grpc.CallOption) (*ReadOnlyState, error) {
+	out := new(ReadOnlyState)
+	err := c.cc.Invoke(ctx, "/cloud.CloudAdmin/SetReadOnly", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cloudAdminClient) GetConfig(ctx context.Context, in *GetConfigRequest, opts ...grpc.CallOption) (*GetConfigResponse, error) {
+	out := new(GetConfigResponse)
+	err := c.cc.Invoke(ctx, "/cloud.CloudAdmin/GetConfig", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cloudAdminClient) CleanTmp(ctx context.Context, in *CleanTmpRequest, opts ...grpc.CallOption) (*CleanTmpResponse, error) {
+	out := new(CleanTmpResponse)
+	err := c.cc.Invoke(ctx, "/cloud.CloudAdmin/CleanTmp", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cloudAdminClient) Reindex(ctx context.Context, in *ReindexRequest, opts ...grpc.CallOption) (*ReindexResponse, error) {
+	out := new(ReindexResponse)
+	err := c.cc.Invoke(ctx, "/cloud.CloudAdmin/Reindex", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cloudAdminClient) GetLimits(ctx context.Context, in *GetLimitsRequest, opts ...grpc.CallOption) (*GetLimitsResponse, error) {
+	out := new(GetLimitsResponse)
+	err := c.cc.Invoke(ctx, "/cloud.CloudAdmin/GetLimits", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CloudAdminServer is the server API for CloudAdmin service.
+// All implementations must embed UnimplementedCloudAdminServer
+// for forward compatibility
+type CloudAdminServer interface {
+	ListTransfers(context.Context, *ListTransfersRequest) (*ListTransfersResponse, error)
+	CancelTransfer(context.Context, *CancelTransferRequest) (*CancelTransferResponse, error)
+	SetReadOnly(context.Context, *SetReadOnlyRequest) (*ReadOnlyState, error)
+	GetConfig(context.Context, *GetConfigRequest) (*GetConfigResponse, error)
+	CleanTmp(context.Context, *CleanTmpRequest) (*CleanTmpResponse, error)
+	Reindex(context.Context, *ReindexRequest) (*ReindexResponse, error)
+	GetLimits(context.Context, *GetLimitsRequest) (*GetLimitsResponse, error)
+	mustEmbedUnimplementedCloudAdminServer()
+}
+
+// UnimplementedCloudAdminServer must be embedded to have forward compatible implementations.
+type UnimplementedCloudAdminServer struct {
+}
+
+func (UnimplementedCloudAdminServer) ListTransfers(context.Context, *ListTransfersRequest) (*ListTransfersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTransfers not implemented")
+}
+func (UnimplementedCloudAdminServer) CancelTransfer(context.Context, *CancelTransferRequest) (*CancelTransferResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelTransfer not implemented")
+}
+func (UnimplementedCloudAdminServer) SetReadOnly(context.Context, *SetReadOnlyRequest) (*ReadOnlyState, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetReadOnly not implemented")
+}
+func (UnimplementedCloudAdminServer) GetConfig(context.Context, *GetConfigRequest) (*GetConfigResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetConfig not implemented")
+}
+func (UnimplementedCloudAdminServer) CleanTmp(context.Context, *CleanTmpRequest) (*CleanTmpResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CleanTmp not implemented")
+}
+func (UnimplementedCloudAdminServer) Reindex(context.Context, *ReindexRequest) (*ReindexResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Reindex not implemented")
+}
+func (UnimplementedCloudAdminServer) GetLimits(context.Context, *GetLimitsRequest) (*GetLimitsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLimits not implemented")
+}
+func (UnimplementedCloudAdminServer) mustEmbedUnimplementedCloudAdminServer() {}
+
+// UnsafeCloudAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CloudAdminServer will
+// result in compilation errors.
+type UnsafeCloudAdminServer interface {
+	mustEmbedUnimplementedCloudAdminServer()
+}
+
+func RegisterCloudAdminServer(s grpc.ServiceRegistrar, srv CloudAdminServer) {
+	s.RegisterService(&CloudAdmin_ServiceDesc, srv)
+}
+
+func _CloudAdmin_ListTransfers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTransfersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CloudAdminServer).ListTransfers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cloud.CloudAdmin/ListTransfers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CloudAdminServer).ListTransfers(ctx, req.(*ListTransfersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CloudAdmin_CancelTransfer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelTransferRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CloudAdminServer).CancelTransfer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cloud.CloudAdmin/CancelTransfer",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CloudAdminServer).CancelTransfer(ctx, req.(*CancelTransferRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CloudAdmin_SetReadOnly_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetReadOnlyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CloudAdminServer).SetReadOnly(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cloud.CloudAdmin/SetReadOnly",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CloudAdminServer).SetReadOnly(ctx, req.(*SetReadOnlyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CloudAdmin_GetConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CloudAdminServer).GetConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cloud.CloudAdmin/GetConfig",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CloudAdminServer).GetConfig(ctx, req.(*GetConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CloudAdmin_CleanTmp_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CleanTmpRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CloudAdminServer).CleanTmp(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cloud.CloudAdmin/CleanTmp",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CloudAdminServer).CleanTmp(ctx, req.(*CleanTmpRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CloudAdmin_Reindex_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReindexRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CloudAdminServer).Reindex(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cloud.CloudAdmin/Reindex",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CloudAdminServer).Reindex(ctx, req.(*ReindexRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CloudAdmin_GetLimits_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLimitsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CloudAdminServer).GetLimits(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cloud.CloudAdmin/GetLimits",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CloudAdminServer).GetLimits(ctx, req.(*GetLimitsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// CloudAdmin_ServiceDesc is the grpc.ServiceDesc for CloudAdmin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CloudAdmin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "cloud.CloudAdmin",
+	HandlerType: (*CloudAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListTransfers",
+			Handler:    _CloudAdmin_ListTransfers_Handler,
+		},
+		{
+			MethodName: "CancelTransfer",
+			Handler:    _CloudAdmin_CancelTransfer_Handler,
+		},
+		{
+			MethodName: "SetReadOnly",
+			Handler:    _CloudAdmin_SetReadOnly_Handler,
+		},
+		{
+			MethodName: "GetConfig",
+			Handler:    _CloudAdmin_GetConfig_Handler,
+		},
+		{
+			MethodName: "CleanTmp",
+			Handler:    _CloudAdmin_CleanTmp_Handler,
+		},
+		{
+			MethodName: "Reindex",
+			Handler:    _CloudAdmin_Reindex_Handler,
+		},
+		{
+			MethodName: "GetLimits",
+			Handler:    _CloudAdmin_GetLimits_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "cloudv1/cloudv1.proto",
+}